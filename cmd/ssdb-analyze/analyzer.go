@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// sizeCommands count the elements of a container.
+var sizeCommands = map[ssdb.DataType]string{
+	ssdb.TypeHash: "hsize", ssdb.TypeZset: "zsize", ssdb.TypeQueue: "qsize",
+}
+
+type groupKey struct {
+	t      ssdb.DataType
+	prefix string
+}
+
+// Group is the statistics of the names of a type sharing a prefix.
+type Group struct {
+	Type       ssdb.DataType `json:"type"`
+	Prefix     string        `json:"prefix"`
+	Names      int64         `json:"names"`
+	KeyBytes   int64         `json:"key_bytes"`
+	ValueBytes int64         `json:"value_bytes,omitempty"` // keys only
+	Elements   int64         `json:"elements,omitempty"`    // hashes, zsets and queues
+	Max        int64         `json:"max"`                   // largest value bytes or element count
+	NoTTL      int64         `json:"no_ttl,omitempty"`      // keys without a TTL
+}
+
+// size is what the group is ordered by.
+func (g *Group) size() int64 {
+	if g.Type == ssdb.TypeKV {
+		return g.KeyBytes + g.ValueBytes
+	}
+	return g.Elements
+}
+
+func (g *Group) add(o *Group) {
+	g.Names += o.Names
+	g.KeyBytes += o.KeyBytes
+	g.ValueBytes += o.ValueBytes
+	g.Elements += o.Elements
+	g.NoTTL += o.NoTTL
+	if o.Max > g.Max {
+		g.Max = o.Max
+	}
+}
+
+// Item is a key with its value size or a container with its element count.
+type Item struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// topList keeps the n largest items, largest first.
+type topList struct {
+	n     int
+	items []Item
+}
+
+func (l *topList) add(it Item) {
+	if len(l.items) == l.n && (l.n == 0 || it.Size <= l.items[len(l.items)-1].Size) {
+		return
+	}
+	i := sort.Search(len(l.items), func(i int) bool { return l.items[i].Size < it.Size })
+	l.items = append(l.items, Item{})
+	copy(l.items[i+1:], l.items[i:])
+	l.items[i] = it
+	if len(l.items) > l.n {
+		l.items = l.items[:l.n]
+	}
+}
+
+// Analyzer walks the names of a server and aggregates them by prefix.
+type Analyzer struct {
+	c      *ssdb.Client
+	Prefix string  // only names with this prefix
+	Depth  int     // separated parts of a name that make its group
+	Sep    string  // separator of the parts
+	Sample float64 // fraction of the names looked at, 1 for all
+	Top    int     // largest keys, hashes, zsets and queues kept
+	Page   int
+
+	rnd     *rand.Rand
+	groups  map[groupKey]*Group
+	largest map[ssdb.DataType]*topList
+	noTTL   []string
+
+	// updated atomically, progress reports read them
+	listed  int64
+	sampled int64
+}
+
+func NewAnalyzer(c *ssdb.Client, seed int64) *Analyzer {
+	return &Analyzer{
+		c:       c,
+		Depth:   1,
+		Sep:     ":",
+		Sample:  1,
+		Top:     10,
+		Page:    1000,
+		rnd:     rand.New(rand.NewSource(seed)),
+		groups:  make(map[groupKey]*Group),
+		largest: make(map[ssdb.DataType]*topList),
+	}
+}
+
+// groupOf returns the first Depth parts of name followed by the separator
+// and *, or name itself when it has no more parts.
+func (a *Analyzer) groupOf(name string) string {
+	if a.Depth <= 0 || a.Sep == "" {
+		return "*"
+	}
+	parts := strings.SplitN(name, a.Sep, a.Depth+1)
+	if len(parts) <= a.Depth {
+		return name
+	}
+	return strings.Join(parts[:a.Depth], a.Sep) + a.Sep + "*"
+}
+
+func (a *Analyzer) sample(names []string) []string {
+	atomic.AddInt64(&a.listed, int64(len(names)))
+	if a.Sample >= 1 {
+		atomic.AddInt64(&a.sampled, int64(len(names)))
+		return names
+	}
+	var out []string
+	for _, name := range names {
+		if a.rnd.Float64() < a.Sample {
+			out = append(out, name)
+		}
+	}
+	atomic.AddInt64(&a.sampled, int64(len(out)))
+	return out
+}
+
+func (a *Analyzer) record(t ssdb.DataType, name string, size int64, noTTL bool) {
+	k := groupKey{t, a.groupOf(name)}
+	g := a.groups[k]
+	if g == nil {
+		g = &Group{Type: t, Prefix: k.prefix}
+		a.groups[k] = g
+	}
+	g.Names++
+	g.KeyBytes += int64(len(name))
+	if t == ssdb.TypeKV {
+		g.ValueBytes += size
+	} else {
+		g.Elements += size
+	}
+	if size > g.Max {
+		g.Max = size
+	}
+	if noTTL {
+		g.NoTTL++
+		if len(a.noTTL) < a.Top {
+			a.noTTL = append(a.noTTL, name)
+		}
+	}
+	l := a.largest[t]
+	if l == nil {
+		l = &topList{n: a.Top}
+		a.largest[t] = l
+	}
+	l.add(Item{name, size})
+}
+
+// Analyze walks the names of a type. Keys are measured with strlen and ttl,
+// containers with their size command, values are never transferred.
+func (a *Analyzer) Analyze(t ssdb.DataType) error {
+	return a.c.ScanNames(t, a.Prefix, a.Page, func(names []string) error {
+		names = a.sample(names)
+		if len(names) == 0 {
+			return nil
+		}
+		cmds := make([][]interface{}, len(names))
+		for i, name := range names {
+			if t == ssdb.TypeKV {
+				cmds[i] = []interface{}{"strlen", name}
+			} else {
+				cmds[i] = []interface{}{sizeCommands[t], name}
+			}
+		}
+		sizes, err := a.sizes(cmds)
+		if err != nil {
+			return err
+		}
+		var ttls []int64
+		if t == ssdb.TypeKV {
+			if ttls, err = a.c.TTLs(names); err != nil {
+				return err
+			}
+		}
+		for i, name := range names {
+			a.record(t, name, sizes[i], ttls != nil && ttls[i] < 0)
+		}
+		return nil
+	})
+}
+
+// sizes runs size commands in one round trip, names deleted meanwhile are 0.
+func (a *Analyzer) sizes(cmds [][]interface{}) ([]int64, error) {
+	resps, err := a.c.Pipeline(cmds)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(cmds))
+	for i, resp := range resps {
+		if len(resp) == 2 && resp[0] == "ok" {
+			sizes[i] = parseInt(resp[1])
+		}
+	}
+	return sizes, nil
+}
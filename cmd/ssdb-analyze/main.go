@@ -0,0 +1,108 @@
+// ssdb-analyze reports which key prefixes use an SSDB server: the number of
+// keys, hashes, zsets and queues per prefix, their value sizes and element
+// counts, the largest of each and the keys without a TTL.
+//
+//	ssdb-analyze -src 127.0.0.1:8888
+//	ssdb-analyze -src 127.0.0.1:8888 -depth 2 -sample 0.01 -json
+//
+// Names are listed with keys, hlist, zlist and qlist and measured with
+// strlen, ttl and the size commands, values are never read. With -sample
+// only that fraction of the names is measured and the counts are scaled up.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		src, auth, prefix, types, sep string
+		depth, top, groups, page      int
+		sample                        float64
+		seed                          int64
+		progress                      time.Duration
+		jsonOut, versionFlag          bool
+	)
+	flag.StringVar(&src, "src", "127.0.0.1:8888", "server host:port")
+	flag.StringVar(&auth, "auth", "", "server password")
+	flag.StringVar(&prefix, "prefix", "", "analyze only names with this prefix")
+	flag.StringVar(&types, "types", "", "comma separated data types to analyze, of kv,hash,zset,queue, all when empty")
+	flag.IntVar(&depth, "depth", 1, "parts of a name that make its prefix group, 0 for a single group")
+	flag.StringVar(&sep, "sep", ":", "separator of the parts of a name")
+	flag.Float64Var(&sample, "sample", 1, "fraction of the names to measure, 1 measures all")
+	flag.Int64Var(&seed, "seed", 0, "random seed of the sample, 0 picks one")
+	flag.IntVar(&top, "top", 10, "largest keys, hashes, zsets and queues listed")
+	flag.IntVar(&groups, "groups", 50, "prefix groups listed per type, the others are summed, 0 lists all")
+	flag.IntVar(&page, "page", 1000, "names fetched per request")
+	flag.BoolVar(&jsonOut, "json", false, "print the report as JSON")
+	flag.DurationVar(&progress, "progress", 5*time.Second, "progress report interval, 0 disables it")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if sample <= 0 || sample > 1 {
+		log.Fatalln("-sample must be in (0, 1]")
+	}
+	dataTypes, err := ssdb.ParseDataTypes(types)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	host, p, err := net.SplitHostPort(src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		log.Fatalf("bad port in %s\n", src)
+	}
+	c, err := ssdb.Connect(host, port, auth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer c.Close()
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	a := NewAnalyzer(c, seed)
+	a.Prefix, a.Depth, a.Sep, a.Sample, a.Top, a.Page = prefix, depth, sep, sample, top, page
+	start := time.Now()
+	if progress > 0 {
+		ticker := time.NewTicker(progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				log.Printf("analyzing: %d names listed, %d analyzed\n", atomic.LoadInt64(&a.listed), atomic.LoadInt64(&a.sampled))
+			}
+		}()
+	}
+	for _, t := range dataTypes {
+		if err := a.Analyze(t); err != nil {
+			log.Fatalf("analyze %s: %v\n", t, err)
+		}
+	}
+	r := a.Report(dataTypes, groups)
+	r.Addr = src
+	r.Seconds = time.Since(start).Seconds()
+	if jsonOut {
+		if err := r.WriteJSON(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	r.WriteText(os.Stdout)
+}
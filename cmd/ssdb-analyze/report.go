@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// Report is the result of an analysis. With sampling the group counts and
+// sums are estimates for the whole server, Max and Largest are not.
+type Report struct {
+	Addr      string                   `json:"addr"`
+	Prefix    string                   `json:"prefix,omitempty"`
+	Depth     int                      `json:"depth"`
+	Separator string                   `json:"separator"`
+	Sample    float64                  `json:"sample"`
+	Seconds   float64                  `json:"seconds"`
+	Listed    int64                    `json:"listed"`
+	Sampled   int64                    `json:"sampled"`
+	Totals    []Group                  `json:"totals"`
+	Groups    []Group                  `json:"groups"`
+	Largest   map[ssdb.DataType][]Item `json:"largest"`
+	NoTTL     []string                 `json:"no_ttl_keys,omitempty"`
+}
+
+func parseInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func scale(n int64, sample float64) int64 {
+	if sample >= 1 {
+		return n
+	}
+	return int64(math.Round(float64(n) / sample))
+}
+
+// Report builds the report with the types in order, each type with at most
+// maxGroups groups, the smaller ones are summed in an "(other)" group.
+func (a *Analyzer) Report(types []ssdb.DataType, maxGroups int) *Report {
+	r := &Report{
+		Prefix:    a.Prefix,
+		Depth:     a.Depth,
+		Separator: a.Sep,
+		Sample:    a.Sample,
+		Listed:    a.listed,
+		Sampled:   a.sampled,
+		Largest:   make(map[ssdb.DataType][]Item),
+		NoTTL:     a.noTTL,
+	}
+	for _, t := range types {
+		var groups []*Group
+		for k, g := range a.groups {
+			if k.t == t {
+				groups = append(groups, g)
+			}
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if groups[i].size() != groups[j].size() {
+				return groups[i].size() > groups[j].size()
+			}
+			return groups[i].Prefix < groups[j].Prefix
+		})
+		total := Group{Type: t, Prefix: "*"}
+		other := Group{Type: t, Prefix: "(other)"}
+		for i, g := range groups {
+			total.add(g)
+			if maxGroups > 0 && i >= maxGroups {
+				other.add(g)
+			} else {
+				r.Groups = append(r.Groups, a.scaled(*g))
+			}
+		}
+		if other.Names > 0 {
+			r.Groups = append(r.Groups, a.scaled(other))
+		}
+		r.Totals = append(r.Totals, a.scaled(total))
+		if l := a.largest[t]; l != nil {
+			r.Largest[t] = l.items
+		}
+	}
+	return r
+}
+
+func (a *Analyzer) scaled(g Group) Group {
+	g.Names = scale(g.Names, a.Sample)
+	g.KeyBytes = scale(g.KeyBytes, a.Sample)
+	g.ValueBytes = scale(g.ValueBytes, a.Sample)
+	g.Elements = scale(g.Elements, a.Sample)
+	g.NoTTL = scale(g.NoTTL, a.Sample)
+	return g
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// printable quotes names that would garble the table.
+func printable(s string) string {
+	if !utf8.ValidString(s) {
+		return strconv.Quote(s)
+	}
+	for _, c := range s {
+		if c < ' ' || c == 0x7f || c == '\t' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// humanBytes formats a byte count with a binary unit.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, i := float64(n), -1
+	for f >= unit && i < 5 {
+		f /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", f, "KMGTPE"[i])
+}
+
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: %d names listed, %d analyzed in %.2fs", r.Addr, r.Listed, r.Sampled, r.Seconds)
+	if r.Sample < 1 {
+		fmt.Fprintf(w, ", sample %g, counts and sums are estimates", r.Sample)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "type\tprefix\tnames\tkey bytes\tvalue bytes\telements\tavg\tmax\tno ttl\t")
+	row := func(g Group) {
+		avg, values, elements, noTTL := "", "-", "-", "-"
+		if g.Type == ssdb.TypeKV {
+			values, noTTL = humanBytes(g.ValueBytes), strconv.FormatInt(g.NoTTL, 10)
+			if g.Names > 0 {
+				avg = humanBytes(g.ValueBytes / g.Names)
+			}
+		} else {
+			elements = strconv.FormatInt(g.Elements, 10)
+			if g.Names > 0 {
+				avg = strconv.FormatInt(g.Elements/g.Names, 10)
+			}
+		}
+		max := strconv.FormatInt(g.Max, 10)
+		if g.Type == ssdb.TypeKV {
+			max = humanBytes(g.Max)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			g.Type, printable(g.Prefix), g.Names, humanBytes(g.KeyBytes), values, elements, avg, max, noTTL)
+	}
+	for _, total := range r.Totals {
+		for _, g := range r.Groups {
+			if g.Type == total.Type {
+				row(g)
+			}
+		}
+		row(total)
+	}
+	tw.Flush()
+
+	for _, total := range r.Totals {
+		items := r.Largest[total.Type]
+		if len(items) == 0 {
+			continue
+		}
+		unit := "elements"
+		if total.Type == ssdb.TypeKV {
+			unit = "value bytes"
+		}
+		fmt.Fprintf(w, "\nlargest %s by %s\n", total.Type, unit)
+		for _, it := range items {
+			fmt.Fprintf(w, "  %12d  %s\n", it.Size, printable(it.Name))
+		}
+	}
+	if len(r.NoTTL) > 0 {
+		fmt.Fprintln(w, "\nkeys without a TTL")
+		for _, k := range r.NoTTL {
+			fmt.Fprintln(w, " ", printable(k))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maximum error messages kept for the report
+const maxErrorSamples = 10
+
+// Benchmark runs the workload on every connection at once.
+type Benchmark struct {
+	Workload  *Workload
+	Conns     []Conn
+	Addr      string
+	Transport string
+	Depth     int           // commands per round trip
+	Ops       int64         // total commands when Duration is 0
+	Duration  time.Duration // run time, takes precedence over Ops
+
+	claimed int64 // commands claimed by the workers
+	done    int64 // commands finished
+	stopped int32
+
+	mu      sync.Mutex
+	samples []string
+}
+
+// worker holds the per-operation results of one connection.
+type worker struct {
+	hists  []histogram
+	errors []uint64
+}
+
+func (b *Benchmark) Stop() {
+	atomic.StoreInt32(&b.stopped, 1)
+}
+
+// claim returns how many commands the next batch may send, 0 when done.
+func (b *Benchmark) claim(deadline time.Time) int {
+	if atomic.LoadInt32(&b.stopped) == 1 {
+		return 0
+	}
+	if b.Duration > 0 {
+		if time.Now().After(deadline) {
+			return 0
+		}
+		return b.Depth
+	}
+	end := atomic.AddInt64(&b.claimed, int64(b.Depth))
+	if over := end - b.Ops; over > 0 {
+		if over >= int64(b.Depth) {
+			return 0
+		}
+		return b.Depth - int(over)
+	}
+	return b.Depth
+}
+
+func (b *Benchmark) sample(err string) {
+	b.mu.Lock()
+	if len(b.samples) < maxErrorSamples {
+		b.samples = append(b.samples, err)
+	}
+	b.mu.Unlock()
+}
+
+func (b *Benchmark) Run() *Report {
+	nops := len(b.Workload.Ops())
+	workers := make([]*worker, len(b.Conns))
+	start := time.Now()
+	deadline := start.Add(b.Duration)
+	var wg sync.WaitGroup
+	for i, c := range b.Conns {
+		wk := &worker{hists: make([]histogram, nops), errors: make([]uint64, nops)}
+		workers[i] = wk
+		wg.Add(1)
+		go func(c Conn, seed int64) {
+			defer wg.Done()
+			b.work(c, wk, rand.New(rand.NewSource(seed)), deadline)
+		}(c, start.UnixNano()+int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := &worker{hists: make([]histogram, nops), errors: make([]uint64, nops)}
+	for _, wk := range workers {
+		for i := range wk.hists {
+			total.hists[i].Merge(&wk.hists[i])
+			total.errors[i] += wk.errors[i]
+		}
+	}
+	return b.report(total, elapsed)
+}
+
+func (b *Benchmark) work(c Conn, wk *worker, r *rand.Rand, deadline time.Time) {
+	idx := make([]int, b.Depth)
+	cmds := make([][]interface{}, b.Depth)
+	for {
+		n := b.claim(deadline)
+		if n == 0 {
+			return
+		}
+		for i := 0; i < n; i++ {
+			idx[i], cmds[i] = b.Workload.Next(r)
+		}
+		start := time.Now()
+		var resps [][]string
+		var err error
+		if n == 1 {
+			var resp []string
+			resp, err = c.Do(cmds[0]...)
+			resps = [][]string{resp}
+		} else {
+			resps, err = c.Pipeline(cmds[:n])
+		}
+		elapsed := time.Since(start)
+		for i := 0; i < n; i++ {
+			op := idx[i]
+			wk.hists[op].Record(elapsed)
+			switch {
+			case err != nil:
+				wk.errors[op]++
+				b.sample(err.Error())
+			case len(resps[i]) == 0:
+				wk.errors[op]++
+				b.sample("empty response")
+			case resps[i][0] != "ok" && resps[i][0] != "not_found":
+				wk.errors[op]++
+				b.sample(fmt.Sprintf("%v: %v", cmds[i][0], resps[i]))
+			}
+		}
+		atomic.AddInt64(&b.done, int64(n))
+		if err != nil {
+			// the connection reconnects in the background
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// progress writes the running count every second.
+func (b *Benchmark) progress(w io.Writer) {
+	var last int64
+	for range time.Tick(time.Second) {
+		done := atomic.LoadInt64(&b.done)
+		fmt.Fprintf(w, "%d ops, %d ops/s\n", done, done-last)
+		last = done
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// latencies below subBuckets microseconds get a bucket each
+const subBuckets = 32
+
+// histogram counts latencies in microseconds in log-linear buckets, 16 per
+// power of two, so a percentile is off by less than 1/16.
+type histogram struct {
+	counts []uint64
+	total  uint64
+	max    time.Duration
+}
+
+func bucketOf(us uint64) int {
+	if us < subBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(us) - 5 // us >> exp is in [16, 32)
+	return exp*16 + int(us>>uint(exp))
+}
+
+// upper returns the largest latency of a bucket.
+func upper(b int) time.Duration {
+	if b < subBuckets {
+		return time.Duration(b) * time.Microsecond
+	}
+	exp := b/16 - 1
+	mant := uint64(b%16 + 16)
+	return time.Duration(((mant+1)<<uint(exp))-1) * time.Microsecond
+}
+
+func (h *histogram) Record(d time.Duration) {
+	b := bucketOf(uint64(d / time.Microsecond))
+	if b >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, b+1-len(h.counts))...)
+	}
+	h.counts[b]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) Merge(o *histogram) {
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, len(o.counts)-len(h.counts))...)
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.total += o.total
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// Percentile returns the latency below which p percent of the samples fall.
+func (h *histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(p / 100 * float64(h.total))
+	if rank >= h.total {
+		return h.max
+	}
+	var seen uint64
+	for b, n := range h.counts {
+		seen += n
+		if seen > rank {
+			if d := upper(b); d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// Bucket is a row of the latency distribution, the share of samples at or below Le.
+type Bucket struct {
+	LeMs    float64 `json:"le_ms"`
+	Count   uint64  `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// Distribution counts the samples at or below each power of two from 0.125ms.
+func (h *histogram) Distribution() []Bucket {
+	var out []Bucket
+	var seen uint64
+	b := 0
+	for le := 125 * time.Microsecond; h.total > 0; le *= 2 {
+		for ; b < len(h.counts) && upper(b) <= le; b++ {
+			seen += h.counts[b]
+		}
+		out = append(out, Bucket{ms(le), seen, 100 * float64(seen) / float64(h.total)})
+		if seen == h.total {
+			break
+		}
+	}
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
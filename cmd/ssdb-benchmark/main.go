@@ -0,0 +1,156 @@
+// ssdb-benchmark measures the throughput and latency of an SSDB server.
+//
+//	ssdb-benchmark -h 127.0.0.1 -p 8888 -c 50 -n 1000000 -mix get:80,set:20
+//	ssdb-benchmark -s /tmp/ssdb.sock -c 8 -P 16 -d 30s -size 512 -json
+//
+// Each client has its own connection and sends -P commands per round trip,
+// so with pipelining a command's latency is that of its whole batch.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		host, socket, auth, mix, prefix string
+		port, clients, depth            int
+		keys, fields, valueSize         int
+		ops                             int64
+		duration                        time.Duration
+		jsonOut, versionFlag            bool
+	)
+	flag.StringVar(&host, "h", "127.0.0.1", "server host")
+	flag.IntVar(&port, "p", 8888, "server port")
+	flag.StringVar(&socket, "s", "", "unix socket path, used instead of -h/-p")
+	flag.StringVar(&auth, "a", "", "password")
+	flag.IntVar(&clients, "c", 50, "concurrent clients")
+	flag.IntVar(&depth, "P", 1, "pipeline depth, commands per round trip")
+	flag.Int64Var(&ops, "n", 100000, "total operations, unless -d is set")
+	flag.DurationVar(&duration, "d", 0, "run for this long instead of -n operations")
+	flag.StringVar(&mix, "mix", "get:50,set:50", "operations and weights, of get,set,hset,hgetall,zset,qpush")
+	flag.IntVar(&keys, "keys", 100000, "key space size")
+	flag.IntVar(&fields, "fields", 10, "fields per hash and members per zset")
+	flag.IntVar(&valueSize, "size", 64, "value size in bytes")
+	flag.StringVar(&prefix, "prefix", "bench:", "prefix of every key")
+	flag.BoolVar(&jsonOut, "json", false, "print the report as JSON")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	w, err := NewWorkload(mix, prefix, keys, fields, valueSize)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if clients < 1 || depth < 1 {
+		log.Fatalln("-c and -P must be at least 1")
+	}
+	// the client logs every connect, keep the report readable
+	log.SetOutput(ioutil.Discard)
+
+	b := &Benchmark{Workload: w, Depth: depth, Ops: ops, Duration: duration}
+	b.Addr, b.Transport = fmt.Sprintf("%s:%d", host, port), "tcp"
+	if socket != "" {
+		b.Addr, b.Transport = socket, "unix"
+	}
+	for i := 0; i < clients; i++ {
+		c, err := dial(host, port, socket, auth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "connect %s: %v\n", b.Addr, err)
+			os.Exit(1)
+		}
+		b.Conns = append(b.Conns, c)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		b.Stop()
+	}()
+	if !jsonOut {
+		go b.progress(os.Stderr)
+	}
+	report := b.Run()
+	for _, c := range b.Conns {
+		c.Close()
+	}
+	if jsonOut {
+		report.WriteJSON(os.Stdout)
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if report.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// Conn sends commands to the server.
+type Conn interface {
+	Do(args ...interface{}) ([]string, error)
+	Pipeline(args [][]interface{}) ([][]string, error)
+	Close() error
+}
+
+// unixConn pipelines over an ssdb.UnixClient.
+type unixConn struct {
+	*ssdb.UnixClient
+}
+
+func (c unixConn) Pipeline(args [][]interface{}) ([][]string, error) {
+	for _, a := range args {
+		if err := c.Send(a...); err != nil {
+			return nil, err
+		}
+	}
+	resps := make([][]string, len(args))
+	for i := range args {
+		resp, err := c.Recv()
+		if err != nil {
+			return nil, err
+		}
+		resps[i] = resp
+	}
+	return resps, nil
+}
+
+func dial(host string, port int, socket, auth string) (Conn, error) {
+	var conn Conn
+	if socket != "" {
+		c, err := ssdb.Unixconnect(socket, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		conn = unixConn{c}
+	} else {
+		c, err := ssdb.Connect(host, port, "")
+		if err != nil {
+			return nil, err
+		}
+		conn = c
+	}
+	if auth != "" {
+		resp, err := conn.Do("auth", auth)
+		if err == nil && (len(resp) == 0 || resp[0] != "ok") {
+			err = fmt.Errorf("auth: %v", resp)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Latency percentiles in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+func latencyOf(h *histogram) Latency {
+	return Latency{ms(h.Percentile(50)), ms(h.Percentile(95)), ms(h.Percentile(99)), ms(h.max)}
+}
+
+// OpReport is the result of one operation of the mix.
+type OpReport struct {
+	Op         string  `json:"op"`
+	Ops        uint64  `json:"ops"`
+	Errors     uint64  `json:"errors"`
+	Throughput float64 `json:"ops_per_sec"`
+	Latency    Latency `json:"latency"`
+}
+
+// Report is the result of a run.
+type Report struct {
+	Addr         string     `json:"addr"`
+	Transport    string     `json:"transport"`
+	Clients      int        `json:"clients"`
+	Pipeline     int        `json:"pipeline"`
+	KeySpace     int        `json:"keys"`
+	ValueSize    int        `json:"value_size"`
+	Seconds      float64    `json:"seconds"`
+	Ops          uint64     `json:"ops"`
+	Errors       uint64     `json:"errors"`
+	Throughput   float64    `json:"ops_per_sec"`
+	Latency      Latency    `json:"latency"`
+	PerOp        []OpReport `json:"per_op"`
+	Distribution []Bucket   `json:"distribution"`
+	ErrorSamples []string   `json:"error_samples,omitempty"`
+}
+
+func (b *Benchmark) report(total *worker, elapsed time.Duration) *Report {
+	r := &Report{
+		Addr:         b.Addr,
+		Transport:    b.Transport,
+		Clients:      len(b.Conns),
+		Pipeline:     b.Depth,
+		KeySpace:     b.Workload.Keys,
+		ValueSize:    len(b.Workload.Value),
+		Seconds:      elapsed.Seconds(),
+		ErrorSamples: b.samples,
+	}
+	all := &histogram{}
+	for i, op := range b.Workload.Ops() {
+		h := &total.hists[i]
+		all.Merge(h)
+		r.Errors += total.errors[i]
+		r.PerOp = append(r.PerOp, OpReport{
+			Op:         op,
+			Ops:        h.total,
+			Errors:     total.errors[i],
+			Throughput: float64(h.total) / elapsed.Seconds(),
+			Latency:    latencyOf(h),
+		})
+	}
+	r.Ops = all.total
+	r.Throughput = float64(all.total) / elapsed.Seconds()
+	r.Latency = latencyOf(all)
+	r.Distribution = all.Distribution()
+	return r
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s over %s, %d clients, pipeline %d, %d keys, %d byte values\n",
+		r.Addr, r.Transport, r.Clients, r.Pipeline, r.KeySpace, r.ValueSize)
+	fmt.Fprintf(w, "%d ops in %.2fs, %.0f ops/s, %d errors\n\n", r.Ops, r.Seconds, r.Throughput, r.Errors)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tops\terrors\tops/s\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	row := func(name string, ops, errors uint64, tput float64, l Latency) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", name, ops, errors, tput, l.P50, l.P95, l.P99, l.Max)
+	}
+	for _, op := range r.PerOp {
+		row(op.Op, op.Ops, op.Errors, op.Throughput, op.Latency)
+	}
+	row("all", r.Ops, r.Errors, r.Throughput, r.Latency)
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nlatency distribution")
+	for _, b := range r.Distribution {
+		fmt.Fprintf(w, "  <= %8.3f ms  %6.2f%%  %d\n", b.LeMs, b.Percent, b.Count)
+	}
+	if len(r.ErrorSamples) > 0 {
+		fmt.Fprintln(w, "\nerrors")
+		for _, e := range r.ErrorSamples {
+			fmt.Fprintln(w, " ", e)
+		}
+	}
+}
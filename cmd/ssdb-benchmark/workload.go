@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// operations a workload can mix
+var opNames = []string{"get", "set", "hset", "hgetall", "zset", "qpush"}
+
+// Workload picks operations by weight and builds their commands.
+type Workload struct {
+	Prefix string
+	Keys   int // key space size of every operation
+	Fields int // fields of each hash and members of each zset
+	Value  string
+
+	ops     []string
+	weights []int // cumulative
+	total   int
+}
+
+// parseMix parses "get:50,set:30,hgetall:20".
+func parseMix(mix string) (ops []string, weights []int, err error) {
+	seen := make(map[string]bool)
+	total := 0
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight := part, 1
+		if i := strings.IndexByte(part, ':'); i >= 0 {
+			name = part[:i]
+			if weight, err = strconv.Atoi(part[i+1:]); err != nil || weight < 0 {
+				return nil, nil, fmt.Errorf("bad weight in %q", part)
+			}
+		}
+		if !validOp(name) {
+			return nil, nil, fmt.Errorf("unknown operation %q, want one of %s", name, strings.Join(opNames, ","))
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("operation %q given twice", name)
+		}
+		seen[name] = true
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		ops = append(ops, name)
+		weights = append(weights, total)
+	}
+	if total == 0 {
+		return nil, nil, fmt.Errorf("the mix has no operations")
+	}
+	return ops, weights, nil
+}
+
+func validOp(name string) bool {
+	for _, op := range opNames {
+		if op == name {
+			return true
+		}
+	}
+	return false
+}
+
+func NewWorkload(mix, prefix string, keys, fields, valueSize int) (*Workload, error) {
+	ops, weights, err := parseMix(mix)
+	if err != nil {
+		return nil, err
+	}
+	if keys < 1 || fields < 1 {
+		return nil, fmt.Errorf("the key space and fields must be at least 1")
+	}
+	return &Workload{
+		Prefix:  prefix,
+		Keys:    keys,
+		Fields:  fields,
+		Value:   strings.Repeat("x", valueSize),
+		ops:     ops,
+		weights: weights,
+		total:   weights[len(weights)-1],
+	}, nil
+}
+
+// Ops returns the operations of the mix.
+func (w *Workload) Ops() []string {
+	return w.ops
+}
+
+// Next picks an operation and returns its index in Ops and its command.
+func (w *Workload) Next(r *rand.Rand) (int, []interface{}) {
+	n := r.Intn(w.total)
+	i := sort.SearchInts(w.weights, n+1)
+	key := strconv.Itoa(r.Intn(w.Keys))
+	field := strconv.Itoa(r.Intn(w.Fields))
+	switch w.ops[i] {
+	case "get":
+		return i, []interface{}{"get", w.Prefix + "kv:" + key}
+	case "set":
+		return i, []interface{}{"set", w.Prefix + "kv:" + key, w.Value}
+	case "hset":
+		return i, []interface{}{"hset", w.Prefix + "h:" + key, "f" + field, w.Value}
+	case "hgetall":
+		return i, []interface{}{"hgetall", w.Prefix + "h:" + key}
+	case "zset":
+		return i, []interface{}{"zset", w.Prefix + "z:" + key, "m" + field, r.Int63n(1 << 32)}
+	default: // qpush
+		return i, []interface{}{"qpush_back", w.Prefix + "q:" + key, w.Value}
+	}
+}
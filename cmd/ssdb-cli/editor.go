@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxHistory is the number of lines kept in the history file.
+const maxHistory = 1000
+
+var errInterrupt = errors.New("interrupted")
+
+// editor reads lines from a terminal in raw mode with cursor movement and
+// history. Without a terminal it reads plain lines.
+type editor struct {
+	in       *os.File
+	r        *bufio.Reader
+	out      io.Writer
+	history  []string
+	histFile string
+}
+
+func newEditor(in *os.File, out io.Writer, histFile string) *editor {
+	e := &editor{in: in, r: bufio.NewReader(in), out: out, histFile: histFile}
+	if data, err := os.ReadFile(histFile); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				e.history = append(e.history, line)
+			}
+		}
+	}
+	return e
+}
+
+// Add appends a line to the history, skipping repeats of the last one.
+func (e *editor) Add(line string) {
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+}
+
+// Save writes the newest lines of the history to the history file.
+func (e *editor) Save() {
+	if e.histFile == "" {
+		return
+	}
+	h := e.history
+	if len(h) > maxHistory {
+		h = h[len(h)-maxHistory:]
+	}
+	os.WriteFile(e.histFile, []byte(strings.Join(h, "\n")+"\n"), 0600)
+}
+
+// ReadLine shows the prompt and returns the edited line. Ctrl-C returns
+// errInterrupt, Ctrl-D on an empty line io.EOF.
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.r.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	var buf []rune
+	pos := 0
+	hist := len(e.history)
+	saved := "" // the line being edited while walking the history
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+		refresh()
+	}
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+				refresh()
+			}
+		case 1: // Ctrl-A
+			pos = 0
+			refresh()
+		case 5: // Ctrl-E
+			pos = len(buf)
+			refresh()
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+				refresh()
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+				refresh()
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+			refresh()
+		case 21: // Ctrl-U
+			buf = append([]rune{}, buf[pos:]...)
+			pos = 0
+			refresh()
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+			refresh()
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			refresh()
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+				refresh()
+			}
+		case 16, 14: // Ctrl-P, Ctrl-N
+			e.walk(r == 16, &hist, &saved, string(buf), setLine)
+		case 27: // escape sequences
+			switch e.escape() {
+			case "[A", "OA":
+				e.walk(true, &hist, &saved, string(buf), setLine)
+			case "[B", "OB":
+				e.walk(false, &hist, &saved, string(buf), setLine)
+			case "[C", "OC":
+				if pos < len(buf) {
+					pos++
+					refresh()
+				}
+			case "[D", "OD":
+				if pos > 0 {
+					pos--
+					refresh()
+				}
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+				refresh()
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(buf)
+				refresh()
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+					refresh()
+				}
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+			refresh()
+		}
+	}
+}
+
+// walk moves through the history, up when older is true.
+func (e *editor) walk(older bool, hist *int, saved *string, cur string, set func(string)) {
+	if older {
+		if *hist == 0 {
+			return
+		}
+		if *hist == len(e.history) {
+			*saved = cur
+		}
+		*hist--
+		set(e.history[*hist])
+		return
+	}
+	if *hist == len(e.history) {
+		return
+	}
+	*hist++
+	if *hist == len(e.history) {
+		set(*saved)
+	} else {
+		set(e.history[*hist])
+	}
+}
+
+// escape reads the rest of an escape sequence, e.g. "[A" for the up arrow.
+func (e *editor) escape() string {
+	b, err := e.r.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return ""
+	}
+	seq := []byte{b}
+	for {
+		c, err := e.r.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, c)
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c == '~' {
+			return string(seq)
+		}
+	}
+}
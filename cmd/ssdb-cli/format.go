@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type outputMode int
+
+const (
+	modePretty outputMode = iota
+	modeRaw
+	modeJSON
+)
+
+// replyKind is the shape of a command's response values.
+type replyKind int
+
+const (
+	replyValue  replyKind = iota // a single string
+	replyInt                     // a single integer
+	replyList                    // a list of keys or items
+	replyPairs                   // key/value pairs
+	replyScores                  // member/score pairs of a zset, in order
+	replyInfo                    // "ssdb-server" followed by name/value pairs
+)
+
+var replyKinds = map[string]replyKind{
+	"set": replyInt, "setx": replyInt, "del": replyInt, "auth": replyInt,
+	"incr": replyInt, "decr": replyInt, "exists": replyInt, "ttl": replyInt, "expire": replyInt,
+	"setnx": replyInt, "setbit": replyInt, "getbit": replyInt, "bitcount": replyInt, "countbit": replyInt,
+	"strlen": replyInt, "multi_set": replyInt, "multi_del": replyInt, "dbsize": replyInt,
+	"hincr": replyInt, "hdecr": replyInt, "hexists": replyInt, "hsize": replyInt, "hclear": replyInt,
+	"multi_hset": replyInt, "multi_hdel": replyInt, "hset": replyInt, "hdel": replyInt,
+	"zget": replyInt, "zincr": replyInt, "zdecr": replyInt, "zexists": replyInt, "zsize": replyInt,
+	"zclear": replyInt, "zrank": replyInt, "zrrank": replyInt, "zcount": replyInt, "zsum": replyInt,
+	"zremrangebyrank": replyInt, "zremrangebyscore": replyInt, "multi_zset": replyInt, "multi_zdel": replyInt,
+	"zset": replyInt, "zdel": replyInt,
+	"qsize": replyInt, "qclear": replyInt, "qpush": replyInt, "qpush_back": replyInt, "qpush_front": replyInt,
+	"qtrim_front": replyInt, "qtrim_back": replyInt,
+
+	"keys": replyList, "rkeys": replyList, "hkeys": replyList, "hlist": replyList, "hrlist": replyList,
+	"zkeys": replyList, "zlist": replyList, "zrlist": replyList, "qlist": replyList, "qrlist": replyList,
+	"qrange": replyList, "qslice": replyList, "qpop": replyList, "qpop_front": replyList, "qpop_back": replyList,
+	"list_allow_ip": replyList, "list_deny_ip": replyList,
+
+	"scan": replyPairs, "rscan": replyPairs, "multi_get": replyPairs, "hgetall": replyPairs,
+	"hscan": replyPairs, "hrscan": replyPairs, "multi_hget": replyPairs,
+
+	"zscan": replyScores, "zrscan": replyScores, "zrange": replyScores, "zrrange": replyScores,
+	"multi_zget": replyScores, "zpop_front": replyScores, "zpop_back": replyScores,
+
+	"info": replyInfo,
+}
+
+// display quotes values that would not print cleanly.
+func display(s string) string {
+	if !utf8.ValidString(s) || strings.ContainsAny(s, "\"\\") || strings.IndexFunc(s, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (sh *shell) print(name string, args, resp []string, err error, elapsed time.Duration) {
+	switch sh.mode {
+	case modeRaw:
+		sh.printRaw(resp, err)
+	case modeJSON:
+		sh.printJSON(name, args, resp, err, elapsed)
+		return
+	default:
+		sh.printPretty(name, resp, err)
+	}
+	if sh.timing {
+		fmt.Fprintf(sh.out, "(%.3f ms)\n", float64(elapsed.Microseconds())/1000)
+	}
+}
+
+func (sh *shell) printRaw(resp []string, err error) {
+	switch {
+	case err != nil:
+		fmt.Fprintln(sh.out, "ERR", err)
+	case resp[0] != "ok":
+		fmt.Fprintln(sh.out, strings.Join(resp, " "))
+	default:
+		for _, v := range resp[1:] {
+			fmt.Fprintln(sh.out, v)
+		}
+	}
+}
+
+func (sh *shell) printPretty(name string, resp []string, err error) {
+	w := sh.out
+	if err != nil {
+		fmt.Fprintln(w, "(error)", err)
+		return
+	}
+	if resp[0] != "ok" {
+		if len(resp) > 1 {
+			fmt.Fprintf(w, "(%s) %s\n", resp[0], strings.Join(resp[1:], " "))
+		} else {
+			fmt.Fprintf(w, "(%s)\n", resp[0])
+		}
+		return
+	}
+	values := resp[1:]
+	kind, known := replyKinds[name]
+	if !known && len(values) > 1 {
+		kind = replyList
+	}
+	switch {
+	case len(values) == 0 && kind != replyList && kind != replyPairs && kind != replyScores:
+		fmt.Fprintln(w, "ok")
+	case kind == replyInt && len(values) == 1:
+		fmt.Fprintf(w, "(integer) %s\n", values[0])
+	case kind == replyList || (kind == replyInt && len(values) > 1):
+		if len(values) == 0 {
+			fmt.Fprintln(w, "(empty list)")
+			return
+		}
+		rows := make([][]string, len(values))
+		for i, v := range values {
+			rows[i] = []string{strconv.Itoa(i + 1), display(v)}
+		}
+		sh.table([]string{"#", "value"}, rows)
+	case kind == replyPairs || kind == replyScores:
+		if len(values) < 2 {
+			fmt.Fprintln(w, "(empty list)")
+			return
+		}
+		header := []string{"#", "key", "value"}
+		if kind == replyScores {
+			header = []string{"#", "member", "score"}
+		}
+		var rows [][]string
+		for i := 0; i+1 < len(values); i += 2 {
+			rows = append(rows, []string{strconv.Itoa(i/2 + 1), display(values[i]), display(values[i+1])})
+		}
+		sh.table(header, rows)
+	case kind == replyInfo:
+		if len(values) > 0 {
+			fmt.Fprintln(w, values[0])
+		}
+		var rows [][]string
+		for i := 1; i+1 < len(values); i += 2 {
+			// binlogs and replication values span several lines
+			name := values[i]
+			for _, l := range strings.Split(strings.TrimSpace(values[i+1]), "\n") {
+				rows = append(rows, []string{name, strings.TrimSpace(l)})
+				name = ""
+			}
+		}
+		sh.table([]string{"name", "value"}, rows)
+	default:
+		fmt.Fprintln(w, strconv.Quote(values[0]))
+	}
+}
+
+// table prints rows in aligned columns.
+func (sh *shell) table(header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(cells []string) {
+		for i, cell := range cells {
+			if i == len(cells)-1 {
+				fmt.Fprintln(sh.out, cell)
+				break
+			}
+			fmt.Fprint(sh.out, cell, strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+		}
+	}
+	line(header)
+	sep := make([]string, len(header))
+	for i, w := range widths {
+		sep[i] = strings.Repeat("-", w)
+	}
+	line(sep)
+	for _, row := range rows {
+		line(row)
+	}
+}
+
+type jsonReply struct {
+	Command []string    `json:"command"`
+	Status  string      `json:"status"`
+	Result  interface{} `json:"result"`
+	Error   string      `json:"error,omitempty"`
+	Ms      float64     `json:"time_ms"`
+}
+
+type jsonPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type jsonScore struct {
+	Member string `json:"member"`
+	Score  int64  `json:"score"`
+}
+
+func (sh *shell) printJSON(name string, args, resp []string, err error, elapsed time.Duration) {
+	r := jsonReply{Command: args, Ms: float64(elapsed.Microseconds()) / 1000}
+	switch {
+	case err != nil:
+		r.Status, r.Error = "error", err.Error()
+	case resp[0] != "ok":
+		r.Status, r.Error = resp[0], strings.Join(resp[1:], " ")
+	default:
+		r.Status = "ok"
+		r.Result = typedResult(name, resp[1:])
+	}
+	b, _ := json.Marshal(r)
+	sh.out.Write(b)
+	sh.out.WriteByte('\n')
+}
+
+func typedResult(name string, values []string) interface{} {
+	kind, known := replyKinds[name]
+	switch {
+	case len(values) == 0:
+		if known && kind != replyValue && kind != replyInt && kind != replyInfo {
+			return []string{}
+		}
+		return nil
+	case kind == replyInt && len(values) == 1:
+		if n, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+			return n
+		}
+		return values[0]
+	case kind == replyPairs:
+		pairs := []jsonPair{}
+		for i := 0; i+1 < len(values); i += 2 {
+			pairs = append(pairs, jsonPair{values[i], values[i+1]})
+		}
+		return pairs
+	case kind == replyScores:
+		scores := []jsonScore{}
+		for i := 0; i+1 < len(values); i += 2 {
+			n, _ := strconv.ParseInt(values[i+1], 10, 64)
+			scores = append(scores, jsonScore{values[i], n})
+		}
+		return scores
+	case kind == replyInfo:
+		info := map[string]string{"server": values[0]}
+		for i := 1; i+1 < len(values); i += 2 {
+			info[values[i]] = values[i+1]
+		}
+		return info
+	case kind == replyList || len(values) > 1:
+		return values
+	}
+	return values[0]
+}
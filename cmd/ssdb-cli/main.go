@@ -0,0 +1,236 @@
+// ssdb-cli is an interactive shell for SSDB.
+//
+//	ssdb-cli -h 127.0.0.1 -p 8888 -a password
+//	ssdb-cli -s /tmp/ssdb.sock
+//	ssdb-cli zrange rank 0 10
+//	ssdb-cli -json -f commands.txt
+//	echo "get a" | ssdb-cli -raw
+//
+// Commands are read from the arguments, from -f, from stdin when it is not a
+// terminal, or else from a line editor with history.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+// Conn is an ssdb.Client or ssdb.UnixClient.
+type Conn interface {
+	Do(args ...interface{}) ([]string, error)
+	Close() error
+}
+
+func main() {
+	var (
+		host, socket, auth, file string
+		port                     int
+		raw, jsonOut, timing     bool
+		debug, versionFlag       bool
+	)
+	flag.StringVar(&host, "h", "127.0.0.1", "server host")
+	flag.IntVar(&port, "p", 8888, "server port")
+	flag.StringVar(&socket, "s", "", "unix socket path, used instead of -h/-p")
+	flag.StringVar(&auth, "a", "", "password")
+	flag.StringVar(&file, "f", "", "read commands from this file")
+	flag.BoolVar(&raw, "raw", false, "print the response values one per line")
+	flag.BoolVar(&jsonOut, "json", false, "print one JSON object per command")
+	flag.BoolVar(&timing, "timing", false, "print the time of each command, always on in the shell")
+	flag.BoolVar(&debug, "debug", false, "show the client log")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if !debug {
+		log.SetOutput(ioutil.Discard)
+	}
+	conn, err := dial(host, port, socket, auth)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect:", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	mode := modePretty
+	if raw {
+		mode = modeRaw
+	} else if jsonOut {
+		mode = modeJSON
+	}
+	sh := &shell{conn: conn, out: bufio.NewWriter(os.Stdout), mode: mode, timing: timing}
+	defer sh.out.Flush()
+
+	switch {
+	case flag.NArg() > 0:
+		sh.run(flag.Args())
+	case file != "":
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		sh.batch(f)
+		f.Close()
+	case !isTerminal(os.Stdin.Fd()):
+		sh.batch(os.Stdin)
+	default:
+		sh.timing = true
+		addr := fmt.Sprintf("%s:%d", host, port)
+		if socket != "" {
+			addr = socket
+		}
+		sh.interactive(addr)
+	}
+	sh.out.Flush()
+	if sh.failed {
+		os.Exit(1)
+	}
+}
+
+func dial(host string, port int, socket, auth string) (Conn, error) {
+	var conn Conn
+	var err error
+	if socket != "" {
+		var c *ssdb.UnixClient
+		c, err = ssdb.Unixconnect(socket, 0, "")
+		conn = c
+	} else {
+		var c *ssdb.Client
+		c, err = ssdb.Connect(host, port, "")
+		conn = c
+	}
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		resp, err := conn.Do("auth", auth)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if len(resp) == 0 || resp[0] != "ok" {
+			conn.Close()
+			return nil, fmt.Errorf("auth: %s", strings.Join(resp, " "))
+		}
+	}
+	return conn, nil
+}
+
+type shell struct {
+	conn   Conn
+	out    *bufio.Writer
+	mode   outputMode
+	timing bool
+	failed bool // a command failed, the exit code is 1
+}
+
+// batch runs one command per line, blank lines and # comments are skipped.
+func (sh *shell) batch(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		args, err := splitLine(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", line, err)
+			sh.failed = true
+			continue
+		}
+		if !sh.run(args) {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		sh.failed = true
+	}
+}
+
+func (sh *shell) interactive(addr string) {
+	home, _ := os.UserHomeDir()
+	ed := newEditor(os.Stdin, os.Stdout, filepath.Join(home, ".ssdb_cli_history"))
+	defer ed.Save()
+	fmt.Printf("ssdb-cli %s connected to %s, type help for help\n", APP_VERSION, addr)
+	prompt := addr + "> "
+	for {
+		line, err := ed.ReadLine(prompt)
+		if errors.Is(err, errInterrupt) {
+			continue
+		}
+		if err != nil {
+			fmt.Println()
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ed.Add(line)
+		args, err := splitLine(line)
+		if err != nil {
+			fmt.Println("(error)", err)
+			continue
+		}
+		if !sh.run(args) {
+			return
+		}
+		sh.out.Flush()
+	}
+}
+
+// run executes one command, it returns false when the shell should exit.
+func (sh *shell) run(args []string) bool {
+	name := strings.ToLower(args[0])
+	switch name {
+	case "quit", "exit":
+		return false
+	case "help":
+		fmt.Fprint(sh.out, helpText)
+		return true
+	}
+	cmd := make([]interface{}, len(args))
+	for i, a := range args {
+		cmd[i] = a
+	}
+	cmd[0] = name
+	start := time.Now()
+	resp, err := sh.conn.Do(cmd...)
+	elapsed := time.Since(start)
+	if err == nil && len(resp) == 0 {
+		err = fmt.Errorf("empty response")
+	}
+	if err != nil || resp[0] != "ok" {
+		sh.failed = true
+	}
+	sh.print(name, args, resp, err, elapsed)
+	return true
+}
+
+const helpText = `Type an SSDB command and its arguments, e.g. "hset h field value".
+Arguments may be quoted with "..." (escapes \n \t \" \\ \xHH) or '...'.
+  help        this text
+  quit, exit  leave the shell
+Up/Down walk the history, Ctrl-A/Ctrl-E jump to the start/end of the line,
+Ctrl-U/Ctrl-K cut before/after the cursor, Ctrl-W cuts a word, Ctrl-D exits.
+`
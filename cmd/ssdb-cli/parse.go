@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitLine splits a command line into arguments. "..." understands the
+// escapes \n \r \t \" \\ and \xHH, '...' is taken literally.
+func splitLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '"':
+			inArg = true
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] != '\\' {
+					cur.WriteByte(line[i])
+					continue
+				}
+				i++
+				if i == len(line) {
+					break
+				}
+				switch line[i] {
+				case 'n':
+					cur.WriteByte('\n')
+				case 'r':
+					cur.WriteByte('\r')
+				case 't':
+					cur.WriteByte('\t')
+				case 'x':
+					if i+2 >= len(line) {
+						return nil, fmt.Errorf("bad \\x escape")
+					}
+					b, err := strconv.ParseUint(line[i+1:i+3], 16, 8)
+					if err != nil {
+						return nil, fmt.Errorf("bad \\x escape")
+					}
+					cur.WriteByte(byte(b))
+					i += 2
+				default:
+					cur.WriteByte(line[i])
+				}
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unbalanced quotes")
+			}
+		case c == '\'':
+			inArg = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unbalanced quotes")
+			}
+			cur.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		default:
+			inArg = true
+			cur.WriteByte(c)
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+// Without termios the shell reads plain lines.
+
+func isTerminal(fd uintptr) bool {
+	return true
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode not supported")
+}
@@ -0,0 +1,146 @@
+// ssdb-diff compares the keys, hashes, zsets and queues of two SSDB servers
+// and lists what is missing from, extra in or different on the destination.
+//
+//	ssdb-diff -src 10.0.0.1:8888 -dst 10.0.0.2:8888
+//	ssdb-diff -src 10.0.0.1:8888 -dst 10.0.0.2:8888 -prefix user: -repair
+//
+// Both servers are walked in key order and every page of both is
+// transferred, SSDB has no server-side digest. Pages covering the same
+// range are digested here and only the pages that differ are compared item
+// by item. The exit status is 1 when something differs. With -repair the
+// destination gets the source version of what differs.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		src, srcAuth, dst, dstAuth string
+		prefix, start, end, types  string
+		report                     string
+		page, max                  int
+		progress                   time.Duration
+		repair, versionFlag        bool
+	)
+	flag.StringVar(&src, "src", "127.0.0.1:8888", "source server host:port, the reference")
+	flag.StringVar(&srcAuth, "src-auth", "", "source server password")
+	flag.StringVar(&dst, "dst", "", "destination server host:port")
+	flag.StringVar(&dstAuth, "dst-auth", "", "destination server password")
+	flag.StringVar(&prefix, "prefix", "", "compare only names with this prefix")
+	flag.StringVar(&start, "start", "", "compare only names after this one")
+	flag.StringVar(&end, "end", "", "compare only names up to this one")
+	flag.StringVar(&types, "types", "", "comma separated data types to compare, of kv,hash,zset,queue, all when empty")
+	flag.IntVar(&page, "page", 1000, "items per request")
+	flag.IntVar(&max, "max", 1000, "differences listed, the others are only counted")
+	flag.BoolVar(&repair, "repair", false, "write the source version of what differs to the destination")
+	flag.StringVar(&report, "report", "", "write the report as JSON to this file")
+	flag.DurationVar(&progress, "progress", 5*time.Second, "progress report interval, 0 disables it")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if dst == "" {
+		log.Fatalln("-dst is required")
+	}
+	dataTypes, err := ssdb.ParseDataTypes(types)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	srcClient, err := connect(src, srcAuth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer srcClient.Close()
+	dstClient, err := connect(dst, dstAuth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dstClient.Close()
+
+	d := ssdb.NewDiff(srcClient, dstClient)
+	d.Range = ssdb.KeyRange{Prefix: prefix, Start: start, End: end}
+	d.Types = dataTypes
+	d.Page = page
+	d.Repair = repair
+	d.MaxMismatches = max
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("stopping")
+		cancel()
+	}()
+	if progress > 0 {
+		ticker := time.NewTicker(progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				logStats("comparing", d.Stats())
+			}
+		}()
+	}
+	r, err := d.Run(ctx)
+	if report != "" {
+		if werr := writeReport(report, r); werr != nil {
+			log.Println(werr)
+		}
+	}
+	for _, mm := range r.Mismatches {
+		fmt.Printf("%s\t%q\t%q\t%s\tsource=%q\tdest=%q\n", mm.Type, mm.Key, mm.Field, mm.Reason, mm.Source, mm.Dest)
+	}
+	if err != nil {
+		logStats("failed", r.DiffStats)
+		log.Fatalln(err)
+	}
+	logStats("done", r.DiffStats)
+	if r.Mismatched > 0 {
+		os.Exit(1)
+	}
+}
+
+func connect(addr, auth string) (*ssdb.Client, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("bad port in %s", addr)
+	}
+	return ssdb.Connect(host, port, auth)
+}
+
+func logStats(state string, s ssdb.DiffStats) {
+	log.Printf("%s: %d names, %d of %d pages equal, %d differences, %d repaired in %s\n", state,
+		s.Names, s.PagesEqual, s.Pages, s.Mismatched, s.Repaired, s.Elapsed.Truncate(time.Second))
+}
+
+func writeReport(file string, r *ssdb.DiffReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
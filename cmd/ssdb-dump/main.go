@@ -0,0 +1,211 @@
+// ssdb-dump writes the keys, hashes, zsets and queues of an SSDB server to a
+// compressed, checksummed dump file that ssdb-restore loads back.
+//
+//	ssdb-dump -src 127.0.0.1:8888 -o backup.ssdb.gz
+//	ssdb-dump -src 127.0.0.1:8888 -prefix user: -types kv,hash -o - | ssh backup 'cat > users.gz'
+//
+// The server keeps serving writes while it is dumped, so the dump is not a
+// point in time snapshot: keys changed during the dump may be old or new.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		src, auth, out, prefix, types string
+		page                          int
+		progress                      time.Duration
+		versionFlag                   bool
+	)
+	flag.StringVar(&src, "src", "127.0.0.1:8888", "server host:port")
+	flag.StringVar(&auth, "auth", "", "server password")
+	flag.StringVar(&out, "o", "-", "dump file, - for stdout")
+	flag.StringVar(&prefix, "prefix", "", "dump only keys, hashes, zsets and queues with this prefix")
+	flag.StringVar(&types, "types", "", "comma separated data types to dump, of kv,hash,zset,queue, all when empty")
+	flag.IntVar(&page, "page", 1000, "items fetched per request")
+	flag.DurationVar(&progress, "progress", 5*time.Second, "progress report interval, 0 disables it")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	dataTypes, err := ssdb.ParseDataTypes(types)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	host, p, err := net.SplitHostPort(src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		log.Fatalf("bad port in %s\n", src)
+	}
+	c, err := ssdb.Connect(host, port, auth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer c.Close()
+
+	var w io.Writer = os.Stdout
+	var tmp *os.File
+	if out != "-" {
+		// write next to the target and rename at the end, a failed dump
+		// never replaces a good one
+		tmp, err = ioutil.TempFile(filepath.Dir(out), filepath.Base(out)+".tmp")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		w = tmp
+	}
+	fail := func(err error) {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		log.Fatalln(err)
+	}
+	dw, err := ssdb.NewDumpWriter(w, src)
+	if err != nil {
+		fail(err)
+	}
+	d := &dumper{c: c, w: dw, prefix: prefix, page: page, start: time.Now()}
+	if progress > 0 {
+		ticker := time.NewTicker(progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				d.report("dumping")
+			}
+		}()
+	}
+	for _, t := range dataTypes {
+		if err := d.dump(t); err != nil {
+			fail(fmt.Errorf("dump %s: %v", t, err))
+		}
+	}
+	if err := dw.Close(); err != nil {
+		fail(err)
+	}
+	if tmp != nil {
+		if err := tmp.Sync(); err != nil {
+			fail(err)
+		}
+		tmp.Close()
+		if err := os.Rename(tmp.Name(), out); err != nil {
+			fail(err)
+		}
+	}
+	d.report("done")
+}
+
+type dumper struct {
+	c      *ssdb.Client
+	w      *ssdb.DumpWriter
+	prefix string
+	page   int
+	start  time.Time
+	// updated atomically, progress reports read them
+	names   int64 // keys, hashes, zsets and queues dumped
+	records int64
+}
+
+func (d *dumper) report(state string) {
+	elapsed := time.Since(d.start)
+	log.Printf("%s: %d keys and containers, %d records in %s\n", state,
+		atomic.LoadInt64(&d.names), atomic.LoadInt64(&d.records), elapsed.Truncate(time.Second))
+}
+
+func (d *dumper) write(r ssdb.DumpRecord) error {
+	if err := d.w.Write(r); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.records, 1)
+	return nil
+}
+
+func (d *dumper) dump(t ssdb.DataType) error {
+	if t == ssdb.TypeKV {
+		return d.c.ScanKV(d.prefix, d.page, func(kvs []ssdb.KeyValue) error {
+			keys := make([]string, len(kvs))
+			for i, kv := range kvs {
+				keys[i] = kv.Key
+			}
+			ttls, err := d.c.TTLs(keys)
+			if err != nil {
+				return err
+			}
+			now := time.Now().Unix()
+			for i, kv := range kvs {
+				var expireAt int64
+				if ttls[i] >= 0 {
+					expireAt = now + ttls[i]
+				}
+				if err := d.write(ssdb.DumpRecord{Type: ssdb.TypeKV, Key: kv.Key, Value: kv.Value, ExpireAt: expireAt}); err != nil {
+					return err
+				}
+			}
+			atomic.AddInt64(&d.names, int64(len(kvs)))
+			return nil
+		})
+	}
+	return d.c.ScanNames(t, d.prefix, d.page, func(names []string) error {
+		for _, name := range names {
+			if err := d.container(t, name); err != nil {
+				return err
+			}
+			atomic.AddInt64(&d.names, 1)
+		}
+		return nil
+	})
+}
+
+func (d *dumper) container(t ssdb.DataType, name string) error {
+	switch t {
+	case ssdb.TypeHash:
+		return d.c.ScanHash(name, d.page, func(fields []ssdb.KeyValue) error {
+			for _, f := range fields {
+				if err := d.write(ssdb.DumpRecord{Type: t, Key: name, Field: f.Key, Value: f.Value}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case ssdb.TypeZset:
+		return d.c.ScanZset(name, d.page, func(items []ssdb.ZsetItem) error {
+			for _, it := range items {
+				if err := d.write(ssdb.DumpRecord{Type: t, Key: name, Field: it.Member, Score: it.Score}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return d.c.ScanQueue(name, d.page, func(offset int64, items []string) error {
+			for i, item := range items {
+				if err := d.write(ssdb.DumpRecord{Type: t, Key: name, Position: offset + int64(i), Value: item}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
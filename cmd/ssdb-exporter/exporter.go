@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// Target is a server scraped by the exporter.
+type Target struct {
+	Addr string
+	c    *ssdb.Client
+
+	busy   int32  // a scrape is running, a hung server doesn't pile them up
+	errors uint64 // failed scrapes, updated atomically
+}
+
+func NewTarget(addr string, c *ssdb.Client) *Target {
+	return &Target{Addr: addr, c: c}
+}
+
+// sizeCommands count the elements of a container.
+var sizeCommands = map[ssdb.DataType]string{
+	ssdb.TypeHash: "hsize", ssdb.TypeZset: "zsize", ssdb.TypeQueue: "qsize",
+}
+
+// Container is a hash, zset or queue whose size is exported.
+type Container struct {
+	Type ssdb.DataType
+	Name string
+}
+
+// Exporter serves the info of its targets in the Prometheus text format,
+// every server is scraped when the exporter is.
+type Exporter struct {
+	Targets    []*Target
+	DbSize     bool // also run the dbsize command
+	Containers []Container
+	Timeout    time.Duration
+}
+
+// result is one scrape of a target.
+type result struct {
+	t        *Target
+	info     *ssdb.Info
+	dbsize   int64
+	sizes    []int64 // of Containers, -1 when unknown
+	err      error
+	duration time.Duration
+}
+
+func (e *Exporter) scrape(t *Target) *result {
+	r := &result{t: t, dbsize: -1}
+	start := time.Now()
+	r.info, r.err = t.c.Info()
+	if r.err == nil {
+		r.err = e.extra(t, r)
+	}
+	r.duration = time.Since(start)
+	return r
+}
+
+// extra reads dbsize and the container sizes in one round trip.
+func (e *Exporter) extra(t *Target, r *result) error {
+	var cmds [][]interface{}
+	if e.DbSize {
+		cmds = append(cmds, []interface{}{"dbsize"})
+	}
+	for _, c := range e.Containers {
+		cmds = append(cmds, []interface{}{sizeCommands[c.Type], c.Name})
+	}
+	r.sizes = make([]int64, len(e.Containers))
+	for i := range r.sizes {
+		r.sizes[i] = -1
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	resps, err := t.c.Pipeline(cmds)
+	if err != nil {
+		return err
+	}
+	value := func(i int) (int64, error) {
+		resp := resps[i]
+		if len(resp) != 2 || resp[0] != "ok" {
+			return -1, fmt.Errorf("%v: %v", cmds[i][0], resp)
+		}
+		return strconv.ParseInt(resp[1], 10, 64)
+	}
+	i := 0
+	if e.DbSize {
+		if r.dbsize, err = value(0); err != nil {
+			return err
+		}
+		i++
+	}
+	for j := range e.Containers {
+		if r.sizes[j], err = value(i + j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect scrapes every target in parallel, a target that doesn't answer
+// in time is reported as down.
+func (e *Exporter) collect() []*result {
+	results := make([]*result, len(e.Targets))
+	var wg sync.WaitGroup
+	for i, t := range e.Targets {
+		if !atomic.CompareAndSwapInt32(&t.busy, 0, 1) {
+			results[i] = &result{t: t, err: fmt.Errorf("previous scrape still running")}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t *Target) {
+			defer wg.Done()
+			done := make(chan *result, 1)
+			go func() {
+				done <- e.scrape(t)
+				atomic.StoreInt32(&t.busy, 0)
+			}()
+			select {
+			case r := <-done:
+				results[i] = r
+			case <-time.After(e.Timeout):
+				results[i] = &result{t: t, err: fmt.Errorf("timeout after %s", e.Timeout), duration: e.Timeout}
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r.err != nil {
+			atomic.AddUint64(&r.t.errors, 1)
+		}
+	}
+	return results
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.write(w, e.collect())
+}
+
+// quote quotes a label value, escaping backslash, quote and newline only.
+func quote(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
+
+func labels(instance string, kv ...string) string {
+	l := []string{"instance=" + quote(instance)}
+	for i := 0; i+1 < len(kv); i += 2 {
+		l = append(l, kv[i]+"="+quote(kv[i+1]))
+	}
+	return strings.Join(l, ",")
+}
+
+func family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (e *Exporter) write(w io.Writer, results []*result) {
+	family(w, "ssdb_up", "gauge", "Whether the last info of the server succeeded.")
+	for _, r := range results {
+		up := 0
+		if r.info != nil {
+			up = 1
+		}
+		fmt.Fprintf(w, "ssdb_up{%s} %d\n", labels(r.t.Addr), up)
+	}
+	family(w, "ssdb_scrape_error", "gauge", "Whether the last scrape of the server failed.")
+	for _, r := range results {
+		failed := 0
+		if r.err != nil {
+			failed = 1
+		}
+		fmt.Fprintf(w, "ssdb_scrape_error{%s} %d\n", labels(r.t.Addr), failed)
+	}
+	family(w, "ssdb_scrape_errors_total", "counter", "Failed scrapes of the server.")
+	for _, r := range results {
+		fmt.Fprintf(w, "ssdb_scrape_errors_total{%s} %d\n", labels(r.t.Addr), atomic.LoadUint64(&r.t.errors))
+	}
+	family(w, "ssdb_scrape_duration_seconds", "gauge", "Time the last scrape of the server took.")
+	for _, r := range results {
+		fmt.Fprintf(w, "ssdb_scrape_duration_seconds{%s} %g\n", labels(r.t.Addr), r.duration.Seconds())
+	}
+
+	var up []*result
+	for _, r := range results {
+		if r.info != nil {
+			up = append(up, r)
+		}
+	}
+	family(w, "ssdb_info", "gauge", "Version of the server, always 1.")
+	for _, r := range up {
+		fmt.Fprintf(w, "ssdb_info{%s} 1\n", labels(r.t.Addr, "version", r.info.Version))
+	}
+	gauges := []struct {
+		name, typ, help string
+		value           func(i *ssdb.Info) uint64
+	}{
+		{"ssdb_links", "gauge", "Client connections.", func(i *ssdb.Info) uint64 { return uint64(i.Links) }},
+		{"ssdb_calls_total", "counter", "Commands served.", func(i *ssdb.Info) uint64 { return i.TotalCalls }},
+		{"ssdb_binlog_capacity", "gauge", "Binlog records kept.", func(i *ssdb.Info) uint64 { return i.Binlog.Capacity }},
+		{"ssdb_binlog_min_seq", "gauge", "Oldest binlog sequence.", func(i *ssdb.Info) uint64 { return i.Binlog.MinSeq }},
+		{"ssdb_binlog_max_seq", "gauge", "Newest binlog sequence.", func(i *ssdb.Info) uint64 { return i.Binlog.MaxSeq }},
+	}
+	for _, g := range gauges {
+		family(w, g.name, g.typ, g.help)
+		for _, r := range up {
+			fmt.Fprintf(w, "%s{%s} %d\n", g.name, labels(r.t.Addr), g.value(r.info))
+		}
+	}
+	if e.DbSize {
+		family(w, "ssdb_dbsize_bytes", "gauge", "Estimated size of the data set from the dbsize command.")
+		for _, r := range up {
+			if r.dbsize >= 0 {
+				fmt.Fprintf(w, "ssdb_dbsize_bytes{%s} %d\n", labels(r.t.Addr), r.dbsize)
+			}
+		}
+	}
+	e.writeReplication(w, up)
+	if len(e.Containers) > 0 {
+		family(w, "ssdb_container_size", "gauge", "Elements of a configured hash, zset or queue.")
+		for _, r := range up {
+			for i, c := range e.Containers {
+				if r.sizes != nil && r.sizes[i] >= 0 {
+					fmt.Fprintf(w, "ssdb_container_size{%s} %d\n", labels(r.t.Addr, "type", string(c.Type), "name", c.Name), r.sizes[i])
+				}
+			}
+		}
+	}
+}
+
+// writeReplication writes an entry per slave of a server (role client) and
+// per master it replicates from (role slaveof).
+func (e *Exporter) writeReplication(w io.Writer, up []*result) {
+	type entry struct {
+		r *result
+		s ssdb.ReplicationStatus
+	}
+	var entries []entry
+	for _, r := range up {
+		for _, s := range r.info.Slaves {
+			entries = append(entries, entry{r, s})
+		}
+		for _, s := range r.info.Masters {
+			entries = append(entries, entry{r, s})
+		}
+	}
+	lbl := func(en entry, kv ...string) string {
+		return labels(en.r.t.Addr, append([]string{"role", en.s.Role, "peer", en.s.Addr, "id", en.s.Id}, kv...)...)
+	}
+	family(w, "ssdb_replication_status", "gauge", "Replication status of a slave or master, always 1.")
+	for _, en := range entries {
+		fmt.Fprintf(w, "ssdb_replication_status{%s} 1\n", lbl(en, "type", en.s.Type, "status", en.s.Status))
+	}
+	family(w, "ssdb_replication_last_seq", "gauge", "Last binlog sequence of the master replicated.")
+	for _, en := range entries {
+		fmt.Fprintf(w, "ssdb_replication_last_seq{%s} %d\n", lbl(en), en.s.LastSeq)
+	}
+	family(w, "ssdb_replication_lag", "gauge", "Binlog records a slave is behind this server.")
+	for _, en := range entries {
+		if en.s.Role != "slaveof" {
+			fmt.Fprintf(w, "ssdb_replication_lag{%s} %d\n", lbl(en), en.s.Lag(en.r.info.Binlog.MaxSeq))
+		}
+	}
+	family(w, "ssdb_replication_copy_count_total", "counter", "Records sent by the full copy.")
+	for _, en := range entries {
+		fmt.Fprintf(w, "ssdb_replication_copy_count_total{%s} %d\n", lbl(en), en.s.CopyCount)
+	}
+	family(w, "ssdb_replication_sync_count_total", "counter", "Binlog records replicated.")
+	for _, en := range entries {
+		fmt.Fprintf(w, "ssdb_replication_sync_count_total{%s} %d\n", lbl(en), en.s.SyncCount)
+	}
+}
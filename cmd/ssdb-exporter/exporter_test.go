@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func target(t *testing.T, addr string) *Target {
+	t.Helper()
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	// a server that is down is retried in the background, like main does
+	c, _ := ssdb.Connect(host, port, "")
+	return NewTarget(addr, c)
+}
+
+func scrape(e *Exporter) string {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestExporter(t *testing.T) {
+	master, slave, slow := ssdbtest.NewServer(), ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer master.Close()
+	defer slave.Close()
+	defer slow.Close()
+	down := ssdbtest.NewServer()
+	down.Close()
+
+	host, port, _ := net.SplitHostPort(master.Addr())
+	if resp := slave.Exec([]string{"slaveof", "m1", host, port}); resp[0] != "ok" {
+		t.Fatal(resp)
+	}
+	master.Exec([]string{"set", "a", "1"})
+	deadline := time.Now().Add(2 * time.Second)
+	for slave.Exec([]string{"get", "a"})[0] != "ok" {
+		if time.Now().After(deadline) {
+			t.Fatal("slave didn't replicate")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	block := make(chan struct{})
+	defer close(block)
+	slow.Handle("info", func(args []string) []string {
+		<-block
+		return []string{"ok"}
+	})
+
+	e := &Exporter{DbSize: true, Timeout: 200 * time.Millisecond}
+	for _, addr := range []string{master.Addr(), slave.Addr(), down.Addr(), slow.Addr()} {
+		e.Targets = append(e.Targets, target(t, addr))
+	}
+	out := scrape(e)
+	instance := func(addr string) string { return `{instance="` + addr + `"}` }
+	for _, want := range []string{
+		"ssdb_up" + instance(master.Addr()) + " 1\n",
+		"ssdb_up" + instance(slave.Addr()) + " 1\n",
+		"ssdb_up" + instance(down.Addr()) + " 0\n",
+		"ssdb_up" + instance(slow.Addr()) + " 0\n",
+		"ssdb_scrape_error" + instance(master.Addr()) + " 0\n",
+		"ssdb_scrape_error" + instance(slave.Addr()) + " 0\n",
+		"ssdb_scrape_error" + instance(down.Addr()) + " 1\n",
+		"ssdb_scrape_error" + instance(slow.Addr()) + " 1\n",
+		"ssdb_scrape_errors_total" + instance(down.Addr()) + " 1\n",
+		"ssdb_scrape_duration_seconds" + instance(slow.Addr()) + " 0.2\n",
+		"ssdb_dbsize_bytes" + instance(master.Addr()) + " 1\n",
+		`ssdb_replication_copy_count_total{instance="` + slave.Addr() + `",role="slaveof",peer="` + master.Addr() + `",id="m1"}`,
+		`ssdb_replication_sync_count_total{instance="` + slave.Addr() + `",role="slaveof",peer="` + master.Addr() + `",id="m1"}`,
+		`ssdb_replication_last_seq{instance="` + master.Addr() + `",role="client"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	for _, addr := range []string{down.Addr(), slow.Addr()} {
+		if strings.Contains(out, "ssdb_links"+instance(addr)) {
+			t.Errorf("info series of %s, which is down", addr)
+		}
+	}
+
+	// the hung scrape is still running, the next one doesn't wait for it
+	start := time.Now()
+	out = scrape(e)
+	if time.Since(start) >= e.Timeout {
+		t.Fatalf("second scrape took %v", time.Since(start))
+	}
+	if want := "ssdb_scrape_errors_total" + instance(slow.Addr()) + " 2\n"; !strings.Contains(out, want) {
+		t.Errorf("missing %q in\n%s", want, out)
+	}
+}
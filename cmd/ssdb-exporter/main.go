@@ -0,0 +1,89 @@
+// ssdb-exporter serves the info of SSDB servers to Prometheus: links,
+// calls, the binlog, replication and lag of every server, with the dbsize
+// and the sizes of chosen hashes, zsets and queues on request.
+//
+//	ssdb-exporter -servers 10.0.0.1:8888,10.0.0.2:8888 -listen :9142
+//	ssdb-exporter -servers 127.0.0.1:8888 -dbsize -zset rank -queue jobs:mail
+//
+// Servers are scraped when the exporter is, every series has the server as
+// its instance label. A server that fails has ssdb_up 0, ssdb_scrape_error 1
+// and its ssdb_scrape_errors_total counts up.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var (
+		listen, path, servers, auth string
+		hashes, zsets, queues       listFlag
+		timeout                     time.Duration
+		dbsize, versionFlag         bool
+	)
+	flag.StringVar(&listen, "listen", ":9142", "HTTP listen address")
+	flag.StringVar(&path, "path", "/metrics", "HTTP path of the metrics")
+	flag.StringVar(&servers, "servers", "127.0.0.1:8888", "comma separated host:port of the servers to scrape")
+	flag.StringVar(&auth, "auth", "", "server password")
+	flag.BoolVar(&dbsize, "dbsize", false, "also export the dbsize command")
+	flag.Var(&hashes, "hash", "export the size of this hash (repeatable)")
+	flag.Var(&zsets, "zset", "export the size of this zset (repeatable)")
+	flag.Var(&queues, "queue", "export the size of this queue (repeatable)")
+	flag.DurationVar(&timeout, "timeout", 5*time.Second, "scrape timeout per server")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	e := &Exporter{DbSize: dbsize, Timeout: timeout}
+	for _, c := range []struct {
+		t     ssdb.DataType
+		names []string
+	}{{ssdb.TypeHash, hashes}, {ssdb.TypeZset, zsets}, {ssdb.TypeQueue, queues}} {
+		for _, name := range c.names {
+			e.Containers = append(e.Containers, Container{c.t, name})
+		}
+	}
+	for _, addr := range strings.Split(servers, ",") {
+		addr = strings.TrimSpace(addr)
+		host, p, err := net.SplitHostPort(addr)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			log.Fatalf("bad port in %s\n", addr)
+		}
+		// a server that is down is retried in the background and exported as down
+		c, err := ssdb.Connect(host, port, auth)
+		if err != nil {
+			log.Printf("server %s: %v, retrying in the background\n", addr, err)
+		}
+		e.Targets = append(e.Targets, NewTarget(addr, c))
+	}
+	http.Handle(path, e)
+	log.Printf("ssdb-exporter %s listening on %s%s, %d servers\n", APP_VERSION, listen, path, len(e.Targets))
+	log.Fatalln(http.ListenAndServe(listen, nil))
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// largest request body
+const maxBody = 64 << 20
+
+// Gateway serves the REST endpoints.
+type Gateway struct {
+	Pool     *ssdb.Pool
+	ReadOnly bool
+	Tokens   map[string]bool // accepted bearer tokens, no auth when empty
+}
+
+func (g *Gateway) Handler() http.Handler {
+	return g.guard(http.HandlerFunc(g.route))
+}
+
+// route dispatches on the resource and the escaped path segments, so keys
+// may contain "/" as %2F.
+func (g *Gateway) route(w http.ResponseWriter, r *http.Request) {
+	var parts []string
+	for _, seg := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		v, err := url.PathUnescape(seg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		parts = append(parts, v)
+	}
+	var h http.HandlerFunc
+	switch {
+	case len(parts) == 1 && parts[0] == "cmd":
+		h = methods(r, map[string]http.HandlerFunc{"POST": g.cmd})
+	case len(parts) == 2 && parts[0] == "kv":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getKV, "PUT": g.putKV, "DELETE": g.deleteKV})
+	case len(parts) == 2 && parts[0] == "hash":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getHash})
+	case len(parts) == 3 && parts[0] == "hash":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getHashField, "PUT": g.putHashField, "DELETE": g.deleteHashField})
+	case len(parts) == 2 && parts[0] == "zset":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getZset})
+	case len(parts) == 3 && parts[0] == "zset":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getZsetMember, "PUT": g.putZsetMember, "DELETE": g.deleteZsetMember})
+	case len(parts) == 2 && parts[0] == "queue":
+		h = methods(r, map[string]http.HandlerFunc{"GET": g.getQueue, "POST": g.pushQueue, "DELETE": g.popQueue})
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), pathKey{}, parts[1:]))
+	h(w, r)
+}
+
+type pathKey struct{}
+
+// pathValue returns the i-th path segment after the resource name.
+func pathValue(r *http.Request, i int) string {
+	return r.Context().Value(pathKey{}).([]string)[i]
+}
+
+// methods picks the handler for the request method, or answers 405.
+func methods(r *http.Request, handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	if h, ok := handlers[r.Method]; ok {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var allow []string
+		for m := range handlers {
+			allow = append(allow, m)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// guard checks the token and the read-only mode. POST /cmd is checked by cmd.
+func (g *Gateway) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(g.Tokens) > 0 && !g.validToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		if g.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/cmd" {
+			writeError(w, http.StatusForbidden, "read-only gateway")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *Gateway) validToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for t := range g.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// statusCode maps an SSDB response status to an HTTP status.
+func statusCode(status string) int {
+	switch status {
+	case "ok":
+		return http.StatusOK
+	case "not_found":
+		return http.StatusNotFound
+	case "client_error":
+		return http.StatusBadRequest
+	case "noauth":
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// do runs a command and returns its response when the status is ok,
+// otherwise it writes the error reply and returns nil.
+func (g *Gateway) do(w http.ResponseWriter, args ...interface{}) []string {
+	resp, err := g.Pool.Do(args...)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return nil
+	}
+	if len(resp) == 0 {
+		writeError(w, http.StatusBadGateway, "empty response")
+		return nil
+	}
+	if resp[0] != "ok" {
+		msg := resp[0]
+		if len(resp) > 1 {
+			msg = resp[1]
+		}
+		writeJSON(w, statusCode(resp[0]), map[string]string{"error": msg, "status": resp[0]})
+		return nil
+	}
+	return resp
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return "", false
+	}
+	return string(body), true
+}
+
+// intParam returns an integer query parameter, def when it is missing.
+func intParam(w http.ResponseWriter, r *http.Request, name string, def int64) (int64, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be an integer", name))
+		return 0, false
+	}
+	return n, true
+}
+
+func (g *Gateway) getKV(w http.ResponseWriter, r *http.Request) {
+	key := pathValue(r, 0)
+	if resp := g.do(w, "get", key); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]string{"key": key, "value": resp[1]})
+	}
+}
+
+func (g *Gateway) putKV(w http.ResponseWriter, r *http.Request) {
+	key := pathValue(r, 0)
+	value, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	ttl, ok := intParam(w, r, "ttl", 0)
+	if !ok {
+		return
+	}
+	args := []interface{}{"set", key, value}
+	if ttl > 0 {
+		args = []interface{}{"setx", key, value, ttl}
+	}
+	if resp := g.do(w, args...); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+func (g *Gateway) deleteKV(w http.ResponseWriter, r *http.Request) {
+	if resp := g.do(w, "del", pathValue(r, 0)); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+func (g *Gateway) getHash(w http.ResponseWriter, r *http.Request) {
+	name := pathValue(r, 0)
+	resp := g.do(w, "hgetall", name)
+	if resp == nil {
+		return
+	}
+	fields := make(map[string]string)
+	for i := 1; i+1 < len(resp); i += 2 {
+		fields[resp[i]] = resp[i+1]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "fields": fields})
+}
+
+func (g *Gateway) getHashField(w http.ResponseWriter, r *http.Request) {
+	name, field := pathValue(r, 0), pathValue(r, 1)
+	if resp := g.do(w, "hget", name, field); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]string{"name": name, "field": field, "value": resp[1]})
+	}
+}
+
+func (g *Gateway) putHashField(w http.ResponseWriter, r *http.Request) {
+	value, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	if resp := g.do(w, "hset", pathValue(r, 0), pathValue(r, 1), value); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+func (g *Gateway) deleteHashField(w http.ResponseWriter, r *http.Request) {
+	if resp := g.do(w, "hdel", pathValue(r, 0), pathValue(r, 1)); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+type zsetItem struct {
+	Member string `json:"member"`
+	Score  int64  `json:"score"`
+}
+
+// getZset lists members by rank, lowest score first unless reverse is set.
+func (g *Gateway) getZset(w http.ResponseWriter, r *http.Request) {
+	name := pathValue(r, 0)
+	start, ok := intParam(w, r, "start", 0)
+	if !ok {
+		return
+	}
+	limit, ok := intParam(w, r, "limit", 100)
+	if !ok {
+		return
+	}
+	cmd := "zrange"
+	if v := r.URL.Query().Get("reverse"); v == "1" || v == "true" {
+		cmd = "zrrange"
+	}
+	resp := g.do(w, cmd, name, start, limit)
+	if resp == nil {
+		return
+	}
+	items := []zsetItem{}
+	for i := 1; i+1 < len(resp); i += 2 {
+		score, _ := strconv.ParseInt(resp[i+1], 10, 64)
+		items = append(items, zsetItem{resp[i], score})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "items": items})
+}
+
+func (g *Gateway) getZsetMember(w http.ResponseWriter, r *http.Request) {
+	name, member := pathValue(r, 0), pathValue(r, 1)
+	resp := g.do(w, "zget", name, member)
+	if resp == nil {
+		return
+	}
+	score, _ := strconv.ParseInt(resp[1], 10, 64)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "member": member, "score": score})
+}
+
+func (g *Gateway) putZsetMember(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	score, err := strconv.ParseInt(strings.TrimSpace(body), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "the score must be an integer")
+		return
+	}
+	if resp := g.do(w, "zset", pathValue(r, 0), pathValue(r, 1), score); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+func (g *Gateway) deleteZsetMember(w http.ResponseWriter, r *http.Request) {
+	if resp := g.do(w, "zdel", pathValue(r, 0), pathValue(r, 1)); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	}
+}
+
+func (g *Gateway) getQueue(w http.ResponseWriter, r *http.Request) {
+	name := pathValue(r, 0)
+	start, ok := intParam(w, r, "start", 0)
+	if !ok {
+		return
+	}
+	limit, ok := intParam(w, r, "limit", 100)
+	if !ok {
+		return
+	}
+	if limit <= 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "items": []string{}})
+		return
+	}
+	if resp := g.do(w, "qrange", name, start, limit); resp != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "items": append([]string{}, resp[1:]...)})
+	}
+}
+
+// queueEnd returns the front/back command variant selected by ?end=.
+func queueEnd(w http.ResponseWriter, r *http.Request, front, back, def string) (string, bool) {
+	switch r.URL.Query().Get("end") {
+	case "":
+		return def, true
+	case "front":
+		return front, true
+	case "back":
+		return back, true
+	}
+	writeError(w, http.StatusBadRequest, "end must be front or back")
+	return "", false
+}
+
+func (g *Gateway) pushQueue(w http.ResponseWriter, r *http.Request) {
+	cmd, ok := queueEnd(w, r, "qpush_front", "qpush_back", "qpush_back")
+	if !ok {
+		return
+	}
+	value, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	if resp := g.do(w, cmd, pathValue(r, 0), value); resp != nil {
+		size, _ := strconv.ParseInt(resp[1], 10, 64)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"size": size})
+	}
+}
+
+func (g *Gateway) popQueue(w http.ResponseWriter, r *http.Request) {
+	cmd, ok := queueEnd(w, r, "qpop_front", "qpop_back", "qpop_front")
+	if !ok {
+		return
+	}
+	n, ok := intParam(w, r, "n", 1)
+	if !ok {
+		return
+	}
+	resp := g.do(w, cmd, pathValue(r, 0), n)
+	if resp == nil {
+		return
+	}
+	if len(resp) == 1 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "queue is empty", "status": "not_found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": resp[1:]})
+}
+
+// cmd runs any command: {"args": ["hget", "h", "f"]} or ["hget", "h", "f"].
+// The reply is {"status": "ok", "data": [...]} with the status mapped to the HTTP code.
+func (g *Gateway) cmd(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Args []interface{} `json:"args"`
+	}
+	if strings.HasPrefix(strings.TrimSpace(body), "[") {
+		err := json.Unmarshal([]byte(body), &req.Args)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad JSON: "+err.Error())
+			return
+		}
+	} else if err := json.Unmarshal([]byte(body), &req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad JSON: "+err.Error())
+		return
+	}
+	if len(req.Args) == 0 {
+		writeError(w, http.StatusBadRequest, "args is empty")
+		return
+	}
+	args := make([]interface{}, len(req.Args))
+	for i, v := range req.Args {
+		switch v := v.(type) {
+		case string:
+			args[i] = v
+		case float64:
+			args[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			args[i] = v
+		case nil:
+			args[i] = ""
+		default:
+			writeError(w, http.StatusBadRequest, "args must be strings, numbers or booleans")
+			return
+		}
+	}
+	name := fmt.Sprintf("%v", args[0])
+	if g.ReadOnly && !ssdb.IsReadCommand(name) && name != "ping" && name != "info" && name != "dbsize" {
+		writeError(w, http.StatusForbidden, "read-only gateway: "+name)
+		return
+	}
+	resp, err := g.Pool.Do(args...)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if len(resp) == 0 {
+		writeError(w, http.StatusBadGateway, "empty response")
+		return
+	}
+	writeJSON(w, statusCode(resp[0]), map[string]interface{}{"status": resp[0], "data": append([]string{}, resp[1:]...)})
+}
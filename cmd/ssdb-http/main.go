@@ -0,0 +1,87 @@
+// ssdb-http is an HTTP/JSON gateway to an SSDB server.
+//
+//	GET    /kv/{key}                      value of a key
+//	PUT    /kv/{key}?ttl=60               set a key, the body is the value
+//	DELETE /kv/{key}
+//	GET    /hash/{name}                   every field of a hash
+//	GET    /hash/{name}/{field}
+//	PUT    /hash/{name}/{field}           the body is the value
+//	DELETE /hash/{name}/{field}
+//	GET    /zset/{name}?start=0&limit=100&reverse=1
+//	GET    /zset/{name}/{member}          score of a member
+//	PUT    /zset/{name}/{member}          the body is the integer score
+//	DELETE /zset/{name}/{member}
+//	GET    /queue/{name}?start=0&limit=100
+//	POST   /queue/{name}?end=back         push the body, end is back or front
+//	DELETE /queue/{name}?end=front&n=1    pop items
+//	POST   /cmd                           {"args": ["zrange", "z", 0, 10]}
+//
+// Missing keys answer 404, SSDB client errors 400, server errors 500 and an
+// unreachable server 502. With -token every request needs
+// "Authorization: Bearer <token>", -readonly only allows reads.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var (
+		listen, backend, auth string
+		tokens                listFlag
+		poolSize              int
+		readOnly, versionFlag bool
+	)
+	flag.StringVar(&listen, "listen", ":8080", "HTTP address")
+	flag.StringVar(&backend, "backend", "127.0.0.1:8888", "SSDB server host:port")
+	flag.StringVar(&auth, "auth", "", "SSDB server password")
+	flag.Var(&tokens, "token", "bearer token accepted from clients (repeatable), no auth when unset")
+	flag.IntVar(&poolSize, "pool", 8, "connections to the SSDB server")
+	flag.BoolVar(&readOnly, "readonly", false, "reject writes")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	host, port, err := net.SplitHostPort(backend)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatalf("bad backend port:%s\n", port)
+	}
+	pool, err := ssdb.NewPool(ssdb.Node{Ip: host, Port: portNum, Password: auth}, poolSize)
+	if err != nil {
+		log.Printf("backend %s: %v, retrying in the background\n", backend, err)
+	}
+	defer pool.Close()
+
+	g := &Gateway{Pool: pool, ReadOnly: readOnly, Tokens: make(map[string]bool)}
+	for _, t := range tokens {
+		g.Tokens[t] = true
+	}
+	log.Printf("ssdb-http %s listening on %s, backend %s\n", APP_VERSION, listen, backend)
+	log.Fatalln(http.ListenAndServe(listen, g.Handler()))
+}
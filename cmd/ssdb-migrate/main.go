@@ -0,0 +1,155 @@
+// ssdb-migrate copies the keys, hashes, zsets and queues matching a prefix
+// or a key range from one SSDB server to another, keeping key TTLs.
+//
+//	ssdb-migrate -src 10.0.0.1:8888 -dst 10.0.0.2:8888 -prefix user:
+//	ssdb-migrate -src 10.0.0.1:8888 -dst 10.0.0.2:8888 -start user:m -end user:z -rate 20000 -delete
+//
+// Every copied page is read back from the destination. Mismatches are
+// listed at the end and make the exit status 1, -report also writes them
+// to a JSON file. With -delete the source copy of a key or container is
+// removed once it compares equal to the destination.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		src, srcAuth, dst, dstAuth string
+		prefix, start, end, types  string
+		report                     string
+		workers, rate, page        int
+		progress                   time.Duration
+		deleteSource, versionFlag  bool
+	)
+	flag.StringVar(&src, "src", "127.0.0.1:8888", "source server host:port")
+	flag.StringVar(&srcAuth, "src-auth", "", "source server password")
+	flag.StringVar(&dst, "dst", "", "destination server host:port")
+	flag.StringVar(&dstAuth, "dst-auth", "", "destination server password")
+	flag.StringVar(&prefix, "prefix", "", "migrate only names with this prefix")
+	flag.StringVar(&start, "start", "", "migrate only names after this one")
+	flag.StringVar(&end, "end", "", "migrate only names up to this one")
+	flag.StringVar(&types, "types", "", "comma separated data types to migrate, of kv,hash,zset,queue, all when empty")
+	flag.IntVar(&workers, "workers", 4, "key pages and containers copied in parallel")
+	flag.IntVar(&rate, "rate", 0, "items copied per second, 0 is unlimited")
+	flag.IntVar(&page, "page", 1000, "items per request")
+	flag.BoolVar(&deleteSource, "delete", false, "delete what is copied from the source once verified")
+	flag.StringVar(&report, "report", "", "write the report as JSON to this file")
+	flag.DurationVar(&progress, "progress", 5*time.Second, "progress report interval, 0 disables it")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if dst == "" {
+		log.Fatalln("-dst is required")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	dataTypes, err := ssdb.ParseDataTypes(types)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	srcPool, err := openPool(src, srcAuth, workers)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer srcPool.Close()
+	dstPool, err := openPool(dst, dstAuth, workers)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dstPool.Close()
+
+	m := ssdb.NewPoolMigration(srcPool, dstPool)
+	m.Range = ssdb.KeyRange{Prefix: prefix, Start: start, End: end}
+	m.Types = dataTypes
+	m.Workers = workers
+	m.Rate = rate
+	m.Page = page
+	m.DeleteSource = deleteSource
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("stopping")
+		cancel()
+	}()
+	if progress > 0 {
+		ticker := time.NewTicker(progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				logStats("migrating", m.Stats())
+			}
+		}()
+	}
+	r, err := m.Run(ctx)
+	if report != "" {
+		if werr := writeReport(report, r); werr != nil {
+			log.Println(werr)
+		}
+	}
+	for _, mm := range r.Mismatches {
+		fmt.Printf("%s\t%q\t%q\t%s\tsource=%q\tdest=%q\n", mm.Type, mm.Key, mm.Field, mm.Reason, mm.Source, mm.Dest)
+	}
+	if err != nil {
+		logStats("failed", r.MigrateStats)
+		log.Fatalln(err)
+	}
+	logStats("done", r.MigrateStats)
+	if r.Mismatched > 0 {
+		os.Exit(1)
+	}
+}
+
+func openPool(addr, auth string, size int) (*ssdb.Pool, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("bad port in %s", addr)
+	}
+	pool, err := ssdb.NewPool(ssdb.Node{Ip: host, Port: port, Password: auth}, size)
+	if err != nil {
+		// don't migrate over a half connected pool
+		return nil, err
+	}
+	return pool, nil
+}
+
+func logStats(state string, s ssdb.MigrateStats) {
+	log.Printf("%s: %d names, %d items copied, %d deleted, %d mismatches in %s\n", state,
+		s.Names, s.Items, s.Deleted, s.Mismatched, s.Elapsed.Truncate(time.Second))
+}
+
+func writeReport(file string, r *ssdb.MigrateReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,236 @@
+// ssdb-proxy accepts native SSDB protocol connections and multiplexes them
+// onto a small pool of backend connections. With several backends the keys
+// are sharded across them by consistent hashing, like ssdb.Cluster.
+//
+//	ssdb-proxy -listen :8889 -backend 10.0.0.1:8888,10.0.0.2:8888 -pool 4 \
+//		-users users.txt -allow get,set,hget,hset -stats :8890
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+// Backend runs a command on the backend servers, an ssdb.Pool or ssdb.Cluster.
+type Backend interface {
+	Do(args ...interface{}) ([]string, error)
+	Clients() []*ssdb.Client
+	Stats() []ssdb.Stats
+	Close() error
+}
+
+// commands over the whole key space, which a sharded backend can't answer
+var keyspaceCmds = map[string]bool{
+	"scan": true, "rscan": true, "keys": true, "rkeys": true,
+	"hlist": true, "hrlist": true, "zlist": true, "zrlist": true, "qlist": true, "qrlist": true,
+	"dbsize": true, "info": true, "flushdb": true,
+}
+
+// commands the proxy never forwards
+var deniedCmds = map[string]bool{
+	"sync140": true, "slaveof": true, "flushdb": true, "clear_binlog": true,
+}
+
+func main() {
+	var (
+		listen, backends, backendAuth string
+		usersFile, allow, statsAddr   string
+		poolSize                      int
+		versionFlag                   bool
+	)
+	flag.StringVar(&listen, "listen", ":8889", "address for SSDB clients")
+	flag.StringVar(&backends, "backend", "127.0.0.1:8888", "backend host:port, a comma separated list shards keys across them")
+	flag.StringVar(&backendAuth, "backend-auth", "", "backend password")
+	flag.IntVar(&poolSize, "pool", 4, "connections per backend")
+	flag.StringVar(&usersFile, "users", "", "file of \"name password [cmd,cmd...]\" lines, clients must auth as one of them")
+	flag.StringVar(&allow, "allow", "", "comma separated commands clients may run, all when empty")
+	flag.StringVar(&statsAddr, "stats", "", "serve /stats (JSON) and /metrics (Prometheus) on this address")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	var users []*User
+	if usersFile != "" {
+		var err error
+		if users, err = loadUsers(usersFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	backend, sharded, err := connect(backends, backendAuth, poolSize)
+	if err != nil {
+		log.Printf("backend: %v, retrying in the background\n", err)
+	}
+	defer backend.Close()
+
+	p := &Proxy{
+		Backend: backend,
+		Sharded: sharded,
+		Users:   users,
+		Allow:   commandSet(allow),
+		stats:   newStats(),
+	}
+	if statsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/stats", p.serveStats)
+			mux.HandleFunc("/metrics", p.serveMetrics)
+			log.Printf("stats on http://%s/stats\n", statsAddr)
+			if err := http.ListenAndServe(statsAddr, mux); err != nil {
+				log.Printf("stats server error:%v\n", err)
+			}
+		}()
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("ssdb-proxy %s listening on %s, backend %s\n", APP_VERSION, listen, backends)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		go p.serve(c)
+	}
+}
+
+func connect(backends, auth string, poolSize int) (Backend, bool, error) {
+	var nodes []ssdb.Node
+	for _, addr := range strings.Split(backends, ",") {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(addr))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			log.Fatalf("bad backend port in %s\n", addr)
+		}
+		nodes = append(nodes, ssdb.Node{Ip: host, Port: portNum, Password: auth})
+	}
+	if len(nodes) == 1 {
+		pool, err := ssdb.NewPool(nodes[0], poolSize)
+		return pool, false, err
+	}
+	cluster, err := ssdb.NewClusterPool(nodes, poolSize)
+	return cluster, true, err
+}
+
+func commandSet(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// Proxy serves the client connections.
+type Proxy struct {
+	Backend Backend
+	Sharded bool
+	Users   []*User         // clients must auth as one of them, none when empty
+	Allow   map[string]bool // commands allowed to every client, all when nil
+	stats   *proxyStats
+}
+
+func (p *Proxy) serve(c net.Conn) {
+	atomic.AddInt64(&p.stats.active, 1)
+	atomic.AddUint64(&p.stats.connections, 1)
+	defer func() {
+		atomic.AddInt64(&p.stats.active, -1)
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	var user *User
+	for {
+		frame, err := ssdb.ReadFrame(r)
+		if err != nil {
+			return
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		args := make([]interface{}, len(frame))
+		for i, v := range frame {
+			args[i] = v
+		}
+		name := strings.ToLower(string(frame[0]))
+		var resp []string
+		if name == "auth" {
+			resp, user = p.auth(frame)
+		} else {
+			resp = p.exec(user, name, args)
+		}
+		blocks := make([][]byte, len(resp))
+		for i, v := range resp {
+			blocks[i] = []byte(v)
+		}
+		if err := ssdb.WriteFrame(c, blocks...); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) auth(frame [][]byte) ([]string, *User) {
+	if len(p.Users) == 0 {
+		return []string{"ok", "1"}, nil
+	}
+	if len(frame) == 2 {
+		for _, u := range p.Users {
+			if u.Password == string(frame[1]) {
+				return []string{"ok", "1"}, u
+			}
+		}
+	}
+	p.stats.reject("auth", "")
+	return []string{"error", "invalid password"}, nil
+}
+
+func (p *Proxy) exec(user *User, name string, args []interface{}) []string {
+	userName := ""
+	if user != nil {
+		userName = user.Name
+	}
+	if len(p.Users) > 0 && user == nil {
+		p.stats.reject(name, userName)
+		return []string{"noauth", "authentication required"}
+	}
+	if deniedCmds[name] || (p.Allow != nil && !p.Allow[name]) || (user != nil && !user.Allowed(name)) {
+		p.stats.reject(name, userName)
+		return []string{"client_error", "command not allowed: " + name}
+	}
+	if name == "ping" {
+		p.stats.record(name, userName, false)
+		return []string{"ok"}
+	}
+	if p.Sharded && (keyspaceCmds[name] || len(args) < 2) {
+		p.stats.reject(name, userName)
+		return []string{"client_error", "command not supported by a sharded proxy: " + name}
+	}
+	resp, err := p.Backend.Do(args...)
+	if err != nil {
+		p.stats.record(name, userName, true)
+		return []string{"error", "backend: " + err.Error()}
+	}
+	p.stats.record(name, userName, len(resp) == 0 || (resp[0] != "ok" && resp[0] != "not_found"))
+	return resp
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+type commandStats struct {
+	Calls    uint64
+	Errors   uint64
+	Rejected uint64
+}
+
+type proxyStats struct {
+	started     time.Time
+	active      int64
+	connections uint64
+
+	mu       sync.Mutex
+	commands map[string]*commandStats
+	users    map[string]uint64
+}
+
+func newStats() *proxyStats {
+	return &proxyStats{
+		started:  time.Now(),
+		commands: make(map[string]*commandStats),
+		users:    make(map[string]uint64),
+	}
+}
+
+func (s *proxyStats) command(name string) *commandStats {
+	c, ok := s.commands[name]
+	if !ok {
+		c = &commandStats{}
+		s.commands[name] = c
+	}
+	return c
+}
+
+func (s *proxyStats) record(name, user string, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.command(name)
+	c.Calls++
+	if failed {
+		c.Errors++
+	}
+	s.users[user]++
+}
+
+func (s *proxyStats) reject(name, user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.command(name).Rejected++
+}
+
+// Stats is the document served on /stats.
+type Stats struct {
+	Uptime           string
+	ActiveConns      int64
+	TotalConnections uint64
+	Commands         map[string]commandStats
+	Users            map[string]uint64 // commands run per user, "" without users
+	Backends         []ssdb.Stats
+}
+
+func (p *Proxy) Stats() Stats {
+	s := p.stats
+	st := Stats{
+		Uptime:           time.Since(s.started).Truncate(time.Second).String(),
+		ActiveConns:      atomic.LoadInt64(&s.active),
+		TotalConnections: atomic.LoadUint64(&s.connections),
+		Commands:         make(map[string]commandStats),
+		Users:            make(map[string]uint64),
+		Backends:         p.Backend.Stats(),
+	}
+	s.mu.Lock()
+	for name, c := range s.commands {
+		st.Commands[name] = *c
+	}
+	for name, n := range s.users {
+		st.Users[name] = n
+	}
+	s.mu.Unlock()
+	return st
+}
+
+func (p *Proxy) serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(p.Stats())
+}
+
+func (p *Proxy) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	ssdb.MetricsHandler(p.Backend.Clients()...).ServeHTTP(w, r)
+	st := p.Stats()
+	fmt.Fprintf(w, "ssdb_proxy_active_connections %d\n", st.ActiveConns)
+	fmt.Fprintf(w, "ssdb_proxy_connections_total %d\n", st.TotalConnections)
+	var names []string
+	for name := range st.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := st.Commands[name]
+		fmt.Fprintf(w, "ssdb_proxy_commands_total{command=%q} %d\n", name, c.Calls)
+		fmt.Fprintf(w, "ssdb_proxy_command_errors_total{command=%q} %d\n", name, c.Errors)
+		fmt.Fprintf(w, "ssdb_proxy_commands_rejected_total{command=%q} %d\n", name, c.Rejected)
+	}
+	names = names[:0]
+	for name := range st.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "ssdb_proxy_user_commands_total{user=%q} %d\n", name, st.Users[name])
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// User is a client account of the proxy.
+type User struct {
+	Name     string
+	Password string
+	Allow    map[string]bool // commands this user may run, all when nil
+}
+
+func (u *User) Allowed(cmd string) bool {
+	return u.Allow == nil || u.Allow[cmd]
+}
+
+// loadUsers reads "name password [cmd,cmd...]" lines, # starts a comment.
+func loadUsers(file string) ([]*User, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var users []*User
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: want \"name password [cmd,cmd...]\"", file, line)
+		}
+		if seen[fields[1]] {
+			return nil, fmt.Errorf("%s:%d: password of %s is used twice", file, line, fields[0])
+		}
+		seen[fields[1]] = true
+		u := &User{Name: fields[0], Password: fields[1]}
+		if len(fields) == 3 {
+			u.Allow = commandSet(fields[2])
+		}
+		users = append(users, u)
+	}
+	return users, scanner.Err()
+}
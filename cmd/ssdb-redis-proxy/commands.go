@@ -0,0 +1,962 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// page size of scans and the limit of unbounded ranges
+const (
+	scanPage = 1000
+	maxLimit = 2000000000
+)
+
+type command struct {
+	minArgs int // arguments after the command name
+	maxArgs int // -1 for any
+	fn      func(p *proxy, name string, a []string) ssdb.RESPValue
+}
+
+var commands = map[string]command{
+	"ping":    {0, 1, cmdPing},
+	"echo":    {1, 1, func(p *proxy, name string, a []string) ssdb.RESPValue { return bulk(a[0]) }},
+	"select":  {1, 1, cmdSelect},
+	"command": {0, -1, func(p *proxy, name string, a []string) ssdb.RESPValue { return array(nil) }},
+	"client":  {1, -1, func(p *proxy, name string, a []string) ssdb.RESPValue { return okReply }},
+	"info":    {0, 1, cmdInfo},
+	"dbsize":  {0, 0, cmdDbSize},
+
+	// keys
+	"get":     {1, 1, cmdGet},
+	"set":     {2, -1, cmdSet},
+	"setex":   {3, 3, cmdSetEx},
+	"setnx":   {2, 2, cmdSetNx},
+	"getset":  {2, 2, cmdGetSet},
+	"mget":    {1, -1, cmdMGet},
+	"mset":    {2, -1, cmdMSet},
+	"del":     {1, -1, cmdDel},
+	"exists":  {1, -1, cmdExists},
+	"incr":    {1, 1, cmdIncr},
+	"decr":    {1, 1, cmdIncr},
+	"incrby":  {2, 2, cmdIncr},
+	"decrby":  {2, 2, cmdIncr},
+	"strlen":  {1, 1, cmdStrlen},
+	"expire":  {2, 2, cmdExpire},
+	"pexpire": {2, 2, cmdExpire},
+	"ttl":     {1, 1, cmdTTL},
+	"pttl":    {1, 1, cmdTTL},
+	"keys":    {1, 1, cmdKeys},
+
+	// hashes
+	"hget":    {2, 2, cmdHGet},
+	"hset":    {3, -1, cmdHSet},
+	"hmset":   {3, -1, cmdHMSet},
+	"hsetnx":  {3, 3, cmdHSetNx},
+	"hmget":   {2, -1, cmdHMGet},
+	"hdel":    {2, -1, cmdHDel},
+	"hexists": {2, 2, cmdHExists},
+	"hlen":    {1, 1, cmdHLen},
+	"hincrby": {3, 3, cmdHIncrBy},
+	"hgetall": {1, 1, cmdHGetAll},
+	"hkeys":   {1, 1, cmdHGetAll},
+	"hvals":   {1, 1, cmdHGetAll},
+
+	// sorted sets, SSDB scores are 64 bit integers
+	"zadd":             {3, -1, cmdZAdd},
+	"zscore":           {2, 2, cmdZScore},
+	"zincrby":          {3, 3, cmdZIncrBy},
+	"zrem":             {2, -1, cmdZRem},
+	"zcard":            {1, 1, cmdZCard},
+	"zrank":            {2, 2, cmdZRank},
+	"zrevrank":         {2, 2, cmdZRank},
+	"zrange":           {3, 4, cmdZRange},
+	"zrevrange":        {3, 4, cmdZRange},
+	"zrangebyscore":    {3, 7, cmdZRangeByScore},
+	"zrevrangebyscore": {3, 7, cmdZRangeByScore},
+	"zcount":           {3, 3, cmdZCount},
+
+	// lists, stored as SSDB queues
+	"lpush":  {2, -1, cmdPush},
+	"rpush":  {2, -1, cmdPush},
+	"lpop":   {1, 1, cmdPop},
+	"rpop":   {1, 1, cmdPop},
+	"llen":   {1, 1, cmdLLen},
+	"lrange": {3, 3, cmdLRange},
+	"lindex": {2, 2, cmdLIndex},
+	"lset":   {3, 3, cmdLSet},
+}
+
+var okReply = ssdb.RESPValue{Type: '+', Str: "OK"}
+var nilReply = ssdb.RESPValue{Type: '$', Null: true}
+
+func errReply(msg string) ssdb.RESPValue {
+	return ssdb.RESPValue{Type: '-', Str: msg}
+}
+
+func errValue(err error) ssdb.RESPValue {
+	return errReply("ERR " + err.Error())
+}
+
+func bulk(s string) ssdb.RESPValue {
+	return ssdb.RESPValue{Type: '$', Str: s}
+}
+
+func integer(n int64) ssdb.RESPValue {
+	return ssdb.RESPValue{Type: ':', Int: n}
+}
+
+func array(items []string) ssdb.RESPValue {
+	v := ssdb.RESPCommand(items)
+	if v.Array == nil {
+		v.Array = []ssdb.RESPValue{}
+	}
+	return v
+}
+
+var errNotInteger = fmt.Errorf("value is not an integer or out of range")
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+// call runs an SSDB command, a response other than ok or not_found is an error.
+func (p *proxy) call(args ...interface{}) ([]string, error) {
+	resp, err := p.pool.Do(args...)
+	if err != nil {
+		return nil, fmt.Errorf("backend: %v", err)
+	}
+	return checkResp(resp)
+}
+
+func checkResp(resp []string) ([]string, error) {
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("backend: empty response")
+	}
+	if resp[0] != "ok" && resp[0] != "not_found" {
+		if len(resp) > 1 {
+			return nil, fmt.Errorf("%s", resp[1])
+		}
+		return nil, fmt.Errorf("%s", resp[0])
+	}
+	return resp, nil
+}
+
+// pipeline runs several SSDB commands in one round trip.
+func (p *proxy) pipeline(args [][]interface{}) ([][]string, error) {
+	resps, err := p.pool.Pipeline(args)
+	if err != nil {
+		return nil, fmt.Errorf("backend: %v", err)
+	}
+	for _, resp := range resps {
+		if _, err := checkResp(resp); err != nil {
+			return nil, err
+		}
+	}
+	return resps, nil
+}
+
+// countOnes counts the responses "ok 1", the answers of the exists commands.
+func countOnes(resps [][]string) int64 {
+	var n int64
+	for _, resp := range resps {
+		if len(resp) > 1 && resp[1] == "1" {
+			n++
+		}
+	}
+	return n
+}
+
+// value returns the single value of a response, nil when not found.
+func value(resp []string) ssdb.RESPValue {
+	if resp[0] == "not_found" || len(resp) < 2 {
+		return nilReply
+	}
+	return bulk(resp[1])
+}
+
+// intValue returns the single value of a response as an integer.
+func intValue(resp []string) ssdb.RESPValue {
+	if len(resp) < 2 {
+		return integer(0)
+	}
+	n, err := strconv.ParseInt(resp[1], 10, 64)
+	if err != nil {
+		return errValue(errNotInteger)
+	}
+	return integer(n)
+}
+
+func cmdPing(p *proxy, name string, a []string) ssdb.RESPValue {
+	if len(a) == 1 {
+		return bulk(a[0])
+	}
+	if _, err := p.call("ping"); err != nil {
+		return errValue(err)
+	}
+	return ssdb.RESPValue{Type: '+', Str: "PONG"}
+}
+
+func cmdSelect(p *proxy, name string, a []string) ssdb.RESPValue {
+	if a[0] != "0" {
+		return errReply("ERR SSDB has a single database")
+	}
+	return okReply
+}
+
+func cmdInfo(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("info")
+	if err != nil {
+		return errValue(err)
+	}
+	var b strings.Builder
+	b.WriteString("# SSDB\r\n")
+	for i := 2; i+1 < len(resp); i += 2 {
+		v := strings.Join(strings.Fields(resp[i+1]), " ")
+		fmt.Fprintf(&b, "%s:%s\r\n", resp[i], v)
+	}
+	return bulk(b.String())
+}
+
+func cmdDbSize(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("dbsize")
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdGet(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("get", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+// SET key value [EX seconds|PX milliseconds] [NX]
+func cmdSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	var ttl int64
+	nx := false
+	for i := 2; i < len(a); i++ {
+		switch strings.ToLower(a[i]) {
+		case "nx":
+			nx = true
+		case "ex", "px":
+			if i+1 >= len(a) {
+				return errReply("ERR syntax error")
+			}
+			n, err := parseInt(a[i+1])
+			if err != nil || n <= 0 {
+				return errReply("ERR invalid expire time in 'set' command")
+			}
+			if strings.ToLower(a[i]) == "px" {
+				n = (n + 999) / 1000
+			}
+			ttl = n
+			i++
+		default:
+			return errReply(fmt.Sprintf("ERR unsupported SET option '%s'", a[i]))
+		}
+	}
+	if nx {
+		resp, err := p.call("setnx", a[0], a[1])
+		if err != nil {
+			return errValue(err)
+		}
+		if len(resp) < 2 || resp[1] != "1" {
+			return nilReply
+		}
+		if ttl > 0 {
+			if _, err := p.call("expire", a[0], ttl); err != nil {
+				return errValue(err)
+			}
+		}
+		return okReply
+	}
+	var err error
+	if ttl > 0 {
+		_, err = p.call("setx", a[0], a[1], ttl)
+	} else {
+		_, err = p.call("set", a[0], a[1])
+	}
+	if err != nil {
+		return errValue(err)
+	}
+	return okReply
+}
+
+func cmdSetEx(p *proxy, name string, a []string) ssdb.RESPValue {
+	ttl, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	if _, err := p.call("setx", a[0], a[2], ttl); err != nil {
+		return errValue(err)
+	}
+	return okReply
+}
+
+func cmdSetNx(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("setnx", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdGetSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("getset", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+// pairValues orders the name/value pairs of a multi get response by names,
+// nil for the missing ones.
+func pairValues(resp []string, names []string) ssdb.RESPValue {
+	found := make(map[string]string)
+	for i := 1; i+1 < len(resp); i += 2 {
+		found[resp[i]] = resp[i+1]
+	}
+	v := ssdb.RESPValue{Type: '*', Array: make([]ssdb.RESPValue, len(names))}
+	for i, name := range names {
+		if val, ok := found[name]; ok {
+			v.Array[i] = bulk(val)
+		} else {
+			v.Array[i] = nilReply
+		}
+	}
+	return v
+}
+
+func cmdMGet(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("multi_get", a)
+	if err != nil {
+		return errValue(err)
+	}
+	return pairValues(resp, a)
+}
+
+func cmdMSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	if len(a)%2 != 0 {
+		return errReply("ERR wrong number of arguments for 'mset' command")
+	}
+	if _, err := p.call("multi_set", a); err != nil {
+		return errValue(err)
+	}
+	return okReply
+}
+
+// cmdDel checks which keys exist before deleting them, for the count Redis returns.
+func cmdDel(p *proxy, name string, a []string) ssdb.RESPValue {
+	var batch [][]interface{}
+	for _, k := range a {
+		batch = append(batch, []interface{}{"exists", k})
+	}
+	batch = append(batch, []interface{}{"multi_del", a})
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	return integer(countOnes(resps[:len(a)]))
+}
+
+func cmdExists(p *proxy, name string, a []string) ssdb.RESPValue {
+	var batch [][]interface{}
+	for _, k := range a {
+		batch = append(batch, []interface{}{"exists", k})
+	}
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	return integer(countOnes(resps))
+}
+
+// cmdIncr serves INCR, DECR, INCRBY and DECRBY.
+func cmdIncr(p *proxy, name string, a []string) ssdb.RESPValue {
+	by := int64(1)
+	if len(a) > 1 {
+		n, err := parseInt(a[1])
+		if err != nil {
+			return errValue(err)
+		}
+		by = n
+	}
+	if strings.HasPrefix(name, "decr") {
+		by = -by
+	}
+	resp, err := p.call("incr", a[0], by)
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdStrlen(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("strlen", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdExpire(p *proxy, name string, a []string) ssdb.RESPValue {
+	ttl, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	if name == "pexpire" {
+		ttl = (ttl + 999) / 1000
+	}
+	resp, err := p.call("expire", a[0], ttl)
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+// cmdTTL answers -2 for a missing key and -1 for a key without TTL, SSDB answers -1 for both.
+func cmdTTL(p *proxy, name string, a []string) ssdb.RESPValue {
+	resps, err := p.pipeline([][]interface{}{{"ttl", a[0]}, {"exists", a[0]}})
+	if err != nil {
+		return errValue(err)
+	}
+	n, err := parseInt(resps[0][1])
+	if err != nil {
+		return errValue(err)
+	}
+	if n < 0 {
+		if countOnes(resps[1:]) == 0 {
+			return integer(-2)
+		}
+		return integer(-1)
+	}
+	if name == "pttl" {
+		n *= 1000
+	}
+	return integer(n)
+}
+
+// cmdKeys scans the keys starting with the literal prefix of the pattern.
+func cmdKeys(p *proxy, name string, a []string) ssdb.RESPValue {
+	pattern := a[0]
+	prefix := pattern
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		prefix = pattern[:i]
+	}
+	var keys []string
+	if prefix != "" {
+		// the scan range starts after the prefix itself
+		resp, err := p.call("exists", prefix)
+		if err != nil {
+			return errValue(err)
+		}
+		if len(resp) > 1 && resp[1] == "1" && globMatch(pattern, prefix) {
+			keys = append(keys, prefix)
+		}
+	}
+	end := ""
+	if prefix != "" {
+		end = prefix + "\xff"
+	}
+	start := prefix
+	for {
+		resp, err := p.call("keys", start, end, scanPage)
+		if err != nil {
+			return errValue(err)
+		}
+		for _, k := range resp[1:] {
+			if globMatch(pattern, k) {
+				keys = append(keys, k)
+			}
+		}
+		if len(resp)-1 < scanPage {
+			break
+		}
+		start = resp[len(resp)-1]
+	}
+	return array(keys)
+}
+
+func cmdHGet(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("hget", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+// cmdHSet returns the number of new fields, SSDB's hset answers 1 for a new field.
+func cmdHSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	if len(a)%2 != 1 {
+		return errReply("ERR wrong number of arguments for 'hset' command")
+	}
+	var batch [][]interface{}
+	for i := 1; i < len(a); i += 2 {
+		batch = append(batch, []interface{}{"hset", a[0], a[i], a[i+1]})
+	}
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	return integer(countOnes(resps))
+}
+
+func cmdHMSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	if len(a)%2 != 1 {
+		return errReply("ERR wrong number of arguments for 'hmset' command")
+	}
+	if _, err := p.call("multi_hset", a[0], a[1:]); err != nil {
+		return errValue(err)
+	}
+	return okReply
+}
+
+func cmdHSetNx(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("hexists", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	if len(resp) > 1 && resp[1] == "1" {
+		return integer(0)
+	}
+	if _, err := p.call("hset", a[0], a[1], a[2]); err != nil {
+		return errValue(err)
+	}
+	return integer(1)
+}
+
+func cmdHMGet(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("multi_hget", a[0], a[1:])
+	if err != nil {
+		return errValue(err)
+	}
+	return pairValues(resp, a[1:])
+}
+
+func cmdHDel(p *proxy, name string, a []string) ssdb.RESPValue {
+	var batch [][]interface{}
+	for _, f := range a[1:] {
+		batch = append(batch, []interface{}{"hexists", a[0], f})
+	}
+	batch = append(batch, []interface{}{"multi_hdel", a[0], a[1:]})
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	return integer(countOnes(resps[:len(a)-1]))
+}
+
+func cmdHExists(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("hexists", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdHLen(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("hsize", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdHIncrBy(p *proxy, name string, a []string) ssdb.RESPValue {
+	by, err := parseInt(a[2])
+	if err != nil {
+		return errValue(err)
+	}
+	resp, err := p.call("hincr", a[0], a[1], by)
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+// cmdHGetAll serves HGETALL, HKEYS and HVALS.
+func cmdHGetAll(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("hgetall", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	items := resp[1:]
+	if name == "hgetall" {
+		return array(items)
+	}
+	var list []string
+	for i := 0; i+1 < len(items); i += 2 {
+		if name == "hkeys" {
+			list = append(list, items[i])
+		} else {
+			list = append(list, items[i+1])
+		}
+	}
+	return array(list)
+}
+
+// cmdZAdd supports ZADD key score member [score member ...] with integer scores.
+func cmdZAdd(p *proxy, name string, a []string) ssdb.RESPValue {
+	if len(a)%2 != 1 {
+		return errReply("ERR syntax error, ZADD options are not supported")
+	}
+	var batch [][]interface{}
+	var pairs []string
+	for i := 1; i < len(a); i += 2 {
+		if _, err := parseInt(a[i]); err != nil {
+			return errReply("ERR SSDB scores must be integers")
+		}
+		batch = append(batch, []interface{}{"zexists", a[0], a[i+1]})
+		pairs = append(pairs, a[i+1], a[i])
+	}
+	batch = append(batch, []interface{}{"multi_zset", a[0], pairs})
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	existing := countOnes(resps[:len(batch)-1])
+	return integer(int64(len(batch)-1) - existing)
+}
+
+func cmdZScore(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("zget", a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+func cmdZIncrBy(p *proxy, name string, a []string) ssdb.RESPValue {
+	by, err := parseInt(a[1])
+	if err != nil {
+		return errReply("ERR SSDB scores must be integers")
+	}
+	resp, err := p.call("zincr", a[0], a[2], by)
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+func cmdZRem(p *proxy, name string, a []string) ssdb.RESPValue {
+	var batch [][]interface{}
+	for _, m := range a[1:] {
+		batch = append(batch, []interface{}{"zexists", a[0], m})
+	}
+	batch = append(batch, []interface{}{"multi_zdel", a[0], a[1:]})
+	resps, err := p.pipeline(batch)
+	if err != nil {
+		return errValue(err)
+	}
+	return integer(countOnes(resps[:len(a)-1]))
+}
+
+func cmdZCard(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("zsize", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdZRank(p *proxy, name string, a []string) ssdb.RESPValue {
+	cmd := "zrank"
+	if name == "zrevrank" {
+		cmd = "zrrank"
+	}
+	resp, err := p.call(cmd, a[0], a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	if resp[0] == "not_found" || len(resp) < 2 || resp[1] == "-1" {
+		return nilReply
+	}
+	return intValue(resp)
+}
+
+// ZRANGE key start stop [WITHSCORES], and ZREVRANGE
+func cmdZRange(p *proxy, name string, a []string) ssdb.RESPValue {
+	withScores := false
+	if len(a) == 4 {
+		if strings.ToLower(a[3]) != "withscores" {
+			return errReply("ERR syntax error")
+		}
+		withScores = true
+	}
+	start, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	stop, err := parseInt(a[2])
+	if err != nil {
+		return errValue(err)
+	}
+	if start < 0 || stop < 0 {
+		resp, err := p.call("zsize", a[0])
+		if err != nil {
+			return errValue(err)
+		}
+		size, _ := strconv.ParseInt(resp[1], 10, 64)
+		if start < 0 {
+			start += size
+		}
+		if stop < 0 {
+			stop += size
+		}
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop < start {
+		return array(nil)
+	}
+	cmd := "zrange"
+	if name == "zrevrange" {
+		cmd = "zrrange"
+	}
+	resp, err := p.call(cmd, a[0], start, stop-start+1)
+	if err != nil {
+		return errValue(err)
+	}
+	return scoredItems(resp[1:], withScores)
+}
+
+// scoredItems turns member/score pairs into a reply, members only without scores.
+func scoredItems(items []string, withScores bool) ssdb.RESPValue {
+	if withScores {
+		return array(items)
+	}
+	var members []string
+	for i := 0; i < len(items); i += 2 {
+		members = append(members, items[i])
+	}
+	return array(members)
+}
+
+// scoreBound maps -inf, +inf and integer bounds, exclusive bounds are not supported.
+func scoreBound(s string) (string, error) {
+	switch s {
+	case "-inf", "+inf", "inf":
+		return "", nil
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+		return "", fmt.Errorf("min or max is not an integer, exclusive bounds are not supported")
+	}
+	return s, nil
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count], and
+// ZREVRANGEBYSCORE key max min ...
+func cmdZRangeByScore(p *proxy, name string, a []string) ssdb.RESPValue {
+	cmd := "zscan"
+	if name == "zrevrangebyscore" {
+		cmd = "zrscan"
+	}
+	min, err := scoreBound(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	max, err := scoreBound(a[2])
+	if err != nil {
+		return errValue(err)
+	}
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(a); i++ {
+		switch strings.ToLower(a[i]) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(a) {
+				return errReply("ERR syntax error")
+			}
+			if offset, err = parseInt(a[i+1]); err != nil {
+				return errValue(err)
+			}
+			if count, err = parseInt(a[i+2]); err != nil {
+				return errValue(err)
+			}
+			i += 2
+		default:
+			return errReply("ERR syntax error")
+		}
+	}
+	limit := int64(maxLimit)
+	if count >= 0 {
+		limit = offset + count
+	}
+	resp, err := p.call(cmd, a[0], "", min, max, limit)
+	if err != nil {
+		return errValue(err)
+	}
+	items := resp[1:]
+	if offset*2 >= int64(len(items)) {
+		items = nil
+	} else {
+		items = items[offset*2:]
+	}
+	return scoredItems(items, withScores)
+}
+
+func cmdZCount(p *proxy, name string, a []string) ssdb.RESPValue {
+	min, err := scoreBound(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	max, err := scoreBound(a[2])
+	if err != nil {
+		return errValue(err)
+	}
+	resp, err := p.call("zcount", a[0], min, max)
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+// cmdPush serves LPUSH and RPUSH, Redis lists are SSDB queues.
+func cmdPush(p *proxy, name string, a []string) ssdb.RESPValue {
+	cmd := "qpush_front"
+	if name == "rpush" {
+		cmd = "qpush_back"
+	}
+	resp, err := p.call(cmd, a[0], a[1:])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdPop(p *proxy, name string, a []string) ssdb.RESPValue {
+	cmd := "qpop_front"
+	if name == "rpop" {
+		cmd = "qpop_back"
+	}
+	resp, err := p.call(cmd, a[0], 1)
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+func cmdLLen(p *proxy, name string, a []string) ssdb.RESPValue {
+	resp, err := p.call("qsize", a[0])
+	if err != nil {
+		return errValue(err)
+	}
+	return intValue(resp)
+}
+
+func cmdLRange(p *proxy, name string, a []string) ssdb.RESPValue {
+	start, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	stop, err := parseInt(a[2])
+	if err != nil {
+		return errValue(err)
+	}
+	resp, err := p.call("qslice", a[0], start, stop)
+	if err != nil {
+		return errValue(err)
+	}
+	return array(resp[1:])
+}
+
+func cmdLIndex(p *proxy, name string, a []string) ssdb.RESPValue {
+	i, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	resp, err := p.call("qget", a[0], i)
+	if err != nil {
+		return errValue(err)
+	}
+	return value(resp)
+}
+
+func cmdLSet(p *proxy, name string, a []string) ssdb.RESPValue {
+	i, err := parseInt(a[1])
+	if err != nil {
+		return errValue(err)
+	}
+	if _, err := p.call("qset", a[0], i, a[2]); err != nil {
+		return errValue(err)
+	}
+	return okReply
+}
+
+// globMatch matches s against a Redis glob pattern: * ? [abc] [^a-z] and \x.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return false
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= s[0] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern, s = pattern[end+2:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
@@ -0,0 +1,122 @@
+// ssdb-redis-proxy lets Redis clients talk to SSDB. It listens for RESP
+// connections and translates the common Redis commands into SSDB commands,
+// sent over a pool of native connections.
+//
+//	ssdb-redis-proxy -listen :6380 -backend 127.0.0.1:8888 -pool 8
+//	redis-cli -p 6380 hgetall user:1
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		listen, backend, auth, requirePass string
+		poolSize                           int
+		versionFlag                        bool
+	)
+	flag.StringVar(&listen, "listen", ":6380", "address for Redis clients")
+	flag.StringVar(&backend, "backend", "127.0.0.1:8888", "SSDB server host:port")
+	flag.StringVar(&auth, "auth", "", "SSDB server password")
+	flag.StringVar(&requirePass, "requirepass", "", "password Redis clients must AUTH with")
+	flag.IntVar(&poolSize, "pool", 8, "connections to the SSDB server")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	host, port, err := net.SplitHostPort(backend)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatalf("bad backend port:%s\n", port)
+	}
+	pool, err := ssdb.NewPool(ssdb.Node{Ip: host, Port: portNum, Password: auth}, poolSize)
+	if err != nil {
+		log.Printf("backend %s: %v, retrying in the background\n", backend, err)
+	}
+	defer pool.Close()
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("ssdb-redis-proxy %s listening on %s, backend %s\n", APP_VERSION, listen, backend)
+	p := &proxy{pool: pool, password: requirePass}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		go p.serve(c)
+	}
+}
+
+type proxy struct {
+	pool     *ssdb.Pool
+	password string
+}
+
+func (p *proxy) serve(c net.Conn) {
+	defer c.Close()
+	r := ssdb.NewRESPReader(bufio.NewReader(c))
+	authed := p.password == ""
+	for {
+		v, err := r.Read()
+		if err != nil {
+			return
+		}
+		args := v.Strings()
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToLower(args[0])
+		var reply ssdb.RESPValue
+		switch {
+		case name == "quit":
+			ssdb.WriteRESP(c, okReply)
+			return
+		case name == "auth":
+			if len(args) == 2 && args[1] == p.password {
+				authed = true
+				reply = okReply
+			} else {
+				reply = errReply("ERR invalid password")
+			}
+		case !authed:
+			reply = errReply("NOAUTH Authentication required.")
+		default:
+			reply = p.exec(name, args[1:])
+		}
+		if err := ssdb.WriteRESP(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one Redis command, name in lower case.
+func (p *proxy) exec(name string, args []string) ssdb.RESPValue {
+	cmd, ok := commands[name]
+	if !ok {
+		return errReply(fmt.Sprintf("ERR unsupported command '%s'", name))
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		return errReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	return cmd.fn(p, name, args)
+}
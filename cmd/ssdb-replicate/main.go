@@ -0,0 +1,203 @@
+// ssdb-replicate tails the write stream of one SSDB instance, as a slave
+// does, and applies it to another instance or to a cluster of instances.
+//
+//	ssdb-replicate -src 10.0.0.1:8888 -dst 10.0.0.2:8888 -prefix user: \
+//		-rewrite user:=u: -checkpoint /var/lib/ssdb-replicate.json -metrics :9180
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Destination is an ssdb.Client or an ssdb.Cluster.
+type Destination interface {
+	Pipeline(args [][]interface{}) ([][]string, error)
+	Close() error
+}
+
+func main() {
+	var (
+		src, srcAuth, dst, dstAuth string
+		checkpointFile, metrics    string
+		batch                      int
+		flush                      time.Duration
+		prefixes, excludes, rules  listFlag
+		versionFlag                bool
+	)
+	flag.StringVar(&src, "src", "127.0.0.1:8888", "source instance host:port")
+	flag.StringVar(&srcAuth, "src-auth", "", "source password")
+	flag.StringVar(&dst, "dst", "", "destination host:port, a comma separated list is used as a cluster")
+	flag.StringVar(&dstAuth, "dst-auth", "", "destination password")
+	flag.Var(&prefixes, "prefix", "replicate only keys with this prefix (repeatable)")
+	flag.Var(&excludes, "exclude", "skip keys with this prefix (repeatable)")
+	flag.Var(&rules, "rewrite", "rename keys, from=to replaces the prefix from with to (repeatable)")
+	flag.IntVar(&batch, "batch", 100, "commands per pipeline")
+	flag.DurationVar(&flush, "flush", 100*time.Millisecond, "longest wait before a partial batch is applied")
+	flag.StringVar(&checkpointFile, "checkpoint", "", "file keeping the replication position across restarts")
+	flag.StringVar(&metrics, "metrics", "", "serve lag metrics on this address, e.g. :9180")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if dst == "" {
+		log.Fatalln("-dst is required")
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	r := &Rules{Include: prefixes, Exclude: excludes}
+	for _, rule := range rules {
+		if err := r.AddRewrite(rule); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	ip, port, err := splitAddr(src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	from, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	dest, err := connect(dst, dstAuth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dest.Close()
+
+	r.SetQueues(from.Queues)
+	consumer := ssdb.NewBinlogConsumer(ip, port, srcAuth, from.Checkpoint)
+	rep := &Replicator{
+		Consumer:   consumer,
+		Dest:       dest,
+		Rules:      r,
+		Batch:      batch,
+		Flush:      flush,
+		Checkpoint: checkpointFile,
+	}
+	rep.stats.appliedSeq = from.LastSeq
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("stopping")
+		cancel()
+	}()
+	if metrics != "" {
+		go serveMetrics(metrics, rep, dest)
+	}
+
+	log.Printf("replicating %s to %s from seq %d\n", src, dst, from.LastSeq)
+	if err := rep.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatalln(err)
+	}
+}
+
+func splitAddr(addr string) (string, int, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", 0, fmt.Errorf("bad port in %s", addr)
+	}
+	return host, port, nil
+}
+
+func connect(addrs, auth string) (Destination, error) {
+	var nodes []ssdb.Node
+	for _, addr := range strings.Split(addrs, ",") {
+		ip, port, err := splitAddr(strings.TrimSpace(addr))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, ssdb.Node{Ip: ip, Port: port, Password: auth})
+	}
+	if len(nodes) == 1 {
+		return ssdb.Connect(nodes[0].Ip, nodes[0].Port, auth)
+	}
+	return ssdb.NewCluster(nodes)
+}
+
+// checkpointFile is the position in the source stream and the state of the
+// replicated queues at that position.
+type checkpointFile struct {
+	ssdb.Checkpoint
+	Queues map[string]QueueState `json:"queues,omitempty"`
+}
+
+func loadCheckpoint(file string) (checkpointFile, error) {
+	var cp checkpointFile
+	if file == "" {
+		return cp, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("bad checkpoint file %s:%v", file, err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint writes the checkpoint to a temporary file and renames it,
+// so a crash never leaves a torn file behind.
+func saveCheckpoint(file string, cp checkpointFile) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), file)
+}
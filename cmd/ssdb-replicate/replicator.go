@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// Replicator applies the events of a BinlogConsumer to a Destination in
+// pipelined batches and saves the checkpoint after every applied batch.
+//
+// Batches are applied at least once: a batch whose pipeline fails is sent
+// again whole, and the destination may have run part of it. Sets, deletes
+// and qset are the same the second time, but queue pushes and pops already
+// applied run twice, so a queue can get duplicate or lose items when the
+// destination fails in the middle of a batch.
+type Replicator struct {
+	Consumer   *ssdb.BinlogConsumer
+	Dest       Destination
+	Rules      *Rules
+	Batch      int
+	Flush      time.Duration
+	Checkpoint string // checkpoint file, none when empty
+
+	stats replicatorStats
+}
+
+type replicatorStats struct {
+	mu         sync.Mutex
+	appliedSeq uint64
+	applied    uint64
+	filtered   uint64
+	errors     uint64
+	batches    uint64
+	lastApply  time.Time
+}
+
+// Run replicates until ctx is done or the consumer stops.
+func (r *Replicator) Run(ctx context.Context) error {
+	events := r.Consumer.Events(ctx, r.Batch*2)
+	ticker := time.NewTicker(r.Flush)
+	defer ticker.Stop()
+
+	var pending [][]interface{}
+	var cp ssdb.Checkpoint
+	dirty := false
+	flush := func() error {
+		if !dirty {
+			return nil
+		}
+		if err := r.apply(ctx, pending, checkpointFile{cp, r.Rules.Queues()}); err != nil {
+			return err
+		}
+		pending = pending[:0]
+		dirty = false
+		return nil
+	}
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// apply what was received before the stream ended
+				if err := flush(); err != nil && err != context.Canceled {
+					return err
+				}
+				return r.Consumer.Err()
+			}
+			switch ev.Op {
+			case "copy_begin":
+				log.Printf("full copy started at seq %d\n", ev.Seq)
+			case "copy_end":
+				log.Printf("full copy done at seq %d\n", ev.Seq)
+			}
+			if cmd := r.Rules.Command(ev); cmd != nil {
+				pending = append(pending, cmd)
+			} else if ev.Op != "copy_begin" && ev.Op != "copy_end" {
+				r.stats.mu.Lock()
+				r.stats.filtered++
+				r.stats.mu.Unlock()
+			}
+			cp = ev.Checkpoint
+			dirty = true
+			if len(pending) >= r.Batch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply sends one batch, retrying until the destination accepts it, so no
+// write is skipped while the destination is down.
+func (r *Replicator) apply(ctx context.Context, batch [][]interface{}, cp checkpointFile) error {
+	for len(batch) > 0 {
+		resps, err := r.Dest.Pipeline(batch)
+		if err == nil {
+			failed := 0
+			for i, resp := range resps {
+				if len(resp) == 0 || (resp[0] != "ok" && resp[0] != "not_found") {
+					failed++
+					log.Printf("apply %v failed:%v\n", batch[i], resp)
+				}
+			}
+			r.stats.mu.Lock()
+			r.stats.applied += uint64(len(batch) - failed)
+			r.stats.errors += uint64(failed)
+			r.stats.mu.Unlock()
+			break
+		}
+		log.Printf("apply batch of %d failed:%v, retry in 1s\n", len(batch), err)
+		r.stats.mu.Lock()
+		r.stats.errors++
+		r.stats.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	if r.Checkpoint != "" {
+		if err := saveCheckpoint(r.Checkpoint, cp); err != nil {
+			return fmt.Errorf("save checkpoint:%v", err)
+		}
+	}
+	r.stats.mu.Lock()
+	r.stats.appliedSeq = cp.LastSeq
+	r.stats.batches++
+	r.stats.lastApply = time.Now()
+	r.stats.mu.Unlock()
+	return nil
+}
+
+func serveMetrics(addr string, r *Replicator, dest Destination) {
+	var clients []*ssdb.Client
+	switch d := dest.(type) {
+	case *ssdb.Client:
+		clients = []*ssdb.Client{d}
+	case *ssdb.Cluster:
+		clients = d.Clients()
+	}
+	destMetrics := ssdb.MetricsHandler(clients...)
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		destMetrics.ServeHTTP(w, req)
+		r.writeMetrics(w)
+	})
+	log.Printf("metrics on http://%s/metrics\n", addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		log.Printf("metrics server error:%v\n", err)
+	}
+}
+
+func (r *Replicator) writeMetrics(w http.ResponseWriter) {
+	sourceSeq := r.Consumer.MasterSeq()
+	s := &r.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lag := uint64(0)
+	if sourceSeq > s.appliedSeq {
+		lag = sourceSeq - s.appliedSeq
+	}
+	fmt.Fprintf(w, "ssdb_replicate_source_seq %d\n", sourceSeq)
+	fmt.Fprintf(w, "ssdb_replicate_applied_seq %d\n", s.appliedSeq)
+	fmt.Fprintf(w, "ssdb_replicate_lag_seq %d\n", lag)
+	fmt.Fprintf(w, "ssdb_replicate_applied_events_total %d\n", s.applied)
+	fmt.Fprintf(w, "ssdb_replicate_filtered_events_total %d\n", s.filtered)
+	fmt.Fprintf(w, "ssdb_replicate_errors_total %d\n", s.errors)
+	fmt.Fprintf(w, "ssdb_replicate_batches_total %d\n", s.batches)
+	if !s.lastApply.IsZero() {
+		fmt.Fprintf(w, "ssdb_replicate_last_apply_timestamp_seconds %d\n", s.lastApply.Unix())
+	}
+	fmt.Fprintf(w, "ssdb_replicate_phase{phase=%q} 1\n", r.Consumer.Phase())
+}
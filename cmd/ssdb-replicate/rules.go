@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+type rewrite struct {
+	from, to string
+}
+
+// Rules select and rename the keys that are replicated.
+type Rules struct {
+	Include  []string // key prefixes to replicate, all when empty
+	Exclude  []string
+	Rewrites []rewrite
+
+	queues map[string]QueueState // replicated source queues by name
+}
+
+// QueueState is the front item sequence and the size of a source queue.
+// The binlog addresses queue items by sequence, qset takes an index from
+// the front, so the replicator follows every push and pop to translate.
+type QueueState struct {
+	Front uint64 `json:"front"`
+	Size  int64  `json:"size"`
+}
+
+// Queues returns a copy of the queue states, saved with the checkpoint.
+func (r *Rules) Queues() map[string]QueueState {
+	queues := make(map[string]QueueState, len(r.queues))
+	for name, q := range r.queues {
+		queues[name] = q
+	}
+	return queues
+}
+
+// SetQueues restores the queue states saved with a checkpoint.
+func (r *Rules) SetQueues(queues map[string]QueueState) {
+	r.queues = queues
+}
+
+// track follows the pushes and pops of a source queue. Items of the copy
+// come in sequence order, the first one of a queue is its front.
+func (r *Rules) track(ev ssdb.Event) {
+	if r.queues == nil {
+		r.queues = make(map[string]QueueState)
+	}
+	q, ok := r.queues[ev.Key]
+	switch ev.Op {
+	case "qset":
+		if !ev.Copy {
+			return
+		}
+		fallthrough
+	case "qpush_back":
+		if !ok || q.Size <= 0 || (ev.Copy && ev.QueueSeq != q.Front+uint64(q.Size)) {
+			q = QueueState{Front: ev.QueueSeq}
+		}
+		q.Size++
+	case "qpush_front":
+		if !ok || q.Size <= 0 {
+			q = QueueState{}
+		}
+		q.Front = ev.QueueSeq
+		q.Size++
+	case "qpop_front":
+		q.Front++
+		q.Size--
+	case "qpop_back":
+		q.Size--
+	default:
+		return
+	}
+	if q.Size <= 0 {
+		// an emptied queue starts over with its next push
+		delete(r.queues, ev.Key)
+		return
+	}
+	r.queues[ev.Key] = q
+}
+
+func (r *Rules) AddRewrite(rule string) error {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("bad rewrite rule %q, want from=to", rule)
+	}
+	r.Rewrites = append(r.Rewrites, rewrite{parts[0], parts[1]})
+	return nil
+}
+
+// Match reports whether key (a KV key or a hash, zset or queue name) is replicated.
+func (r *Rules) Match(key string) bool {
+	for _, p := range r.Exclude {
+		if strings.HasPrefix(key, p) {
+			return false
+		}
+	}
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, p := range r.Include {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rename applies the first matching rewrite rule.
+func (r *Rules) Rename(key string) string {
+	for _, rw := range r.Rewrites {
+		if strings.HasPrefix(key, rw.from) {
+			return rw.to + key[len(rw.from):]
+		}
+	}
+	return key
+}
+
+// Command returns the command replaying ev on the destination, nil when the
+// event is filtered out or has nothing to replay. It is called for every
+// event in stream order, queue events update the queue states.
+func (r *Rules) Command(ev ssdb.Event) []interface{} {
+	if ev.Key == ssdb.ExpireList && (ev.Op == "zset" || ev.Op == "zdel") {
+		return r.ttlCommand(ev)
+	}
+	if ev.Op == "copy_begin" || ev.Op == "copy_end" || !r.Match(ev.Key) {
+		return nil
+	}
+	key := r.Rename(ev.Key)
+	q, known := r.queues[ev.Key]
+	r.track(ev)
+	switch ev.Op {
+	case "set":
+		return []interface{}{"set", key, ev.Value}
+	case "del":
+		return []interface{}{"del", key}
+	case "hset":
+		return []interface{}{"hset", key, ev.Field, ev.Value}
+	case "hdel":
+		return []interface{}{"hdel", key, ev.Field}
+	case "zset":
+		return []interface{}{"zset", key, ev.Field, ev.Value}
+	case "zdel":
+		return []interface{}{"zdel", key, ev.Field}
+	case "qset":
+		if ev.Copy {
+			// the copy sends every item of a queue, front first
+			return []interface{}{"qpush_back", key, ev.Value}
+		}
+		if !known || ev.QueueSeq < q.Front || ev.QueueSeq-q.Front >= uint64(q.Size) {
+			log.Printf("skip qset %s seq %d: item not in the replicated queue\n", ev.Key, ev.QueueSeq)
+			return nil
+		}
+		return []interface{}{"qset", key, int64(ev.QueueSeq - q.Front), ev.Value}
+	case "qpush_back":
+		return []interface{}{"qpush_back", key, ev.Value}
+	case "qpush_front":
+		return []interface{}{"qpush_front", key, ev.Value}
+	case "qpop_back":
+		return []interface{}{"qpop_back", key, 1}
+	case "qpop_front":
+		return []interface{}{"qpop_front", key, 1}
+	}
+	return nil
+}
+
+// ttlCommand turns a write to the expiration list into expire on the destination,
+// which keeps its own expiration list in step.
+func (r *Rules) ttlCommand(ev ssdb.Event) []interface{} {
+	if ev.Op == "zdel" || !r.Match(ev.Field) {
+		return nil
+	}
+	at, err := strconv.ParseInt(ev.Value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	ttl := (at - time.Now().UnixNano()/int64(time.Millisecond) + 999) / 1000
+	if ttl <= 0 {
+		return []interface{}{"del", r.Rename(ev.Field)}
+	}
+	return []interface{}{"expire", r.Rename(ev.Field), ttl}
+}
@@ -0,0 +1,224 @@
+// ssdb-restore loads a dump written by ssdb-dump into an SSDB server.
+//
+//	ssdb-restore -dst 127.0.0.1:8888 -i backup.ssdb.gz
+//	ssdb-restore -dst 127.0.0.1:8888 -i backup.ssdb.gz -prefix user: -resume
+//	ssdb-restore -verify -i backup.ssdb.gz
+//
+// Progress is saved to a state file after every batch. When a restore fails
+// it can be rerun with -resume to continue where it stopped. Keys, hash
+// fields and zset members are overwritten, restored queues replace the
+// queues of the same name.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// State is the progress of a restore, saved in the state file.
+type State struct {
+	Source  string // header of the dump, to refuse resuming another dump
+	Created int64
+	Records int64 // records of the dump that are restored
+}
+
+func main() {
+	var (
+		dst, auth, in, stateFile string
+		prefixes                 listFlag
+		batch, retries           int
+		progress                 time.Duration
+		resume, verify           bool
+		versionFlag              bool
+	)
+	flag.StringVar(&dst, "dst", "127.0.0.1:8888", "server host:port")
+	flag.StringVar(&auth, "auth", "", "server password")
+	flag.StringVar(&in, "i", "-", "dump file, - for stdin")
+	flag.Var(&prefixes, "prefix", "restore only keys, hashes, zsets and queues with this prefix (repeatable)")
+	flag.IntVar(&batch, "batch", 500, "commands per pipeline")
+	flag.IntVar(&retries, "retries", 5, "attempts of a failing batch before giving up")
+	flag.StringVar(&stateFile, "state", "", "progress file, default is the dump file name with .state appended")
+	flag.BoolVar(&resume, "resume", false, "continue the restore recorded in the state file")
+	flag.BoolVar(&verify, "verify", false, "only check the dump, don't restore it")
+	flag.DurationVar(&progress, "progress", 5*time.Second, "progress report interval, 0 disables it")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	if retries < 1 {
+		retries = 1
+	}
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+		r = f
+		if stateFile == "" {
+			stateFile = in + ".state"
+		}
+	}
+	dr, err := ssdb.NewDumpReader(r)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if verify {
+		n, err := verifyDump(dr)
+		if err != nil {
+			log.Fatalf("%s: %v after %d records\n", in, err, n)
+		}
+		log.Printf("%s: %d records from %s at %s, checksum ok\n", in, n, dr.Source, dr.Created.Format(time.RFC3339))
+		return
+	}
+
+	state := State{Source: dr.Source, Created: dr.Created.Unix()}
+	if resume {
+		if stateFile == "" {
+			log.Fatalln("-resume needs -state or a dump file")
+		}
+		saved, err := loadState(stateFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if saved.Source != state.Source || saved.Created != state.Created {
+			log.Fatalf("%s belongs to the dump of %s at %s\n", stateFile, saved.Source, time.Unix(saved.Created, 0).Format(time.RFC3339))
+		}
+		state.Records = saved.Records
+	}
+
+	host, p, err := net.SplitHostPort(dst)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		log.Fatalf("bad port in %s\n", dst)
+	}
+	c, err := ssdb.Connect(host, port, auth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer c.Close()
+
+	rs := &restorer{
+		c:         c,
+		dump:      dr,
+		prefixes:  prefixes,
+		batch:     batch,
+		retries:   retries,
+		stateFile: stateFile,
+		state:     state,
+		start:     time.Now(),
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("stopping after the current batch")
+		atomic.StoreInt32(&rs.stopped, 1)
+	}()
+	if progress > 0 {
+		ticker := time.NewTicker(progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				rs.report("restoring")
+			}
+		}()
+	}
+	if state.Records > 0 {
+		log.Printf("resuming after record %d\n", state.Records)
+	}
+	if err := rs.Run(); err != nil {
+		rs.report("failed")
+		if stateFile != "" {
+			log.Fatalf("%v, rerun with -resume to continue\n", err)
+		}
+		log.Fatalln(err)
+	}
+	rs.report("done")
+	if stateFile != "" {
+		os.Remove(stateFile)
+	}
+}
+
+func verifyDump(dr *ssdb.DumpReader) (int64, error) {
+	for {
+		if _, err := dr.Next(); err == io.EOF {
+			return dr.Records(), nil
+		} else if err != nil {
+			return dr.Records(), err
+		}
+	}
+}
+
+func loadState(file string) (State, error) {
+	var s State
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("bad state file %s:%v", file, err)
+	}
+	return s, nil
+}
+
+// saveState writes the state to a temporary file and renames it, so a crash
+// never leaves a torn file behind.
+func saveState(file string, s State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func connect(t *testing.T, s *ssdbtest.Server) *ssdb.Client {
+	t.Helper()
+	host, p, _ := net.SplitHostPort(s.Addr())
+	port, _ := strconv.Atoi(p)
+	c, err := ssdb.Connect(host, port, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// dump writes every key, hash, zset and queue of c the way ssdb-dump does.
+func dump(t *testing.T, c *ssdb.Client) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := ssdb.NewDumpWriter(&b, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ScanKV("", 0, func(kvs []ssdb.KeyValue) error {
+		keys := make([]string, len(kvs))
+		for i, kv := range kvs {
+			keys[i] = kv.Key
+		}
+		ttls, err := c.TTLs(keys)
+		if err != nil {
+			return err
+		}
+		for i, kv := range kvs {
+			r := ssdb.DumpRecord{Type: ssdb.TypeKV, Key: kv.Key, Value: kv.Value}
+			if ttls[i] >= 0 {
+				r.ExpireAt = time.Now().Unix() + ttls[i]
+			}
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, typ := range ssdb.DataTypes[1:] {
+		if err != nil {
+			break
+		}
+		err = c.ScanNames(typ, "", 0, func(names []string) error {
+			for _, name := range names {
+				var err error
+				switch typ {
+				case ssdb.TypeHash:
+					err = c.ScanHash(name, 0, func(fields []ssdb.KeyValue) error {
+						for _, f := range fields {
+							w.Write(ssdb.DumpRecord{Type: typ, Key: name, Field: f.Key, Value: f.Value})
+						}
+						return nil
+					})
+				case ssdb.TypeZset:
+					err = c.ScanZset(name, 0, func(items []ssdb.ZsetItem) error {
+						for _, it := range items {
+							w.Write(ssdb.DumpRecord{Type: typ, Key: name, Field: it.Member, Score: it.Score})
+						}
+						return nil
+					})
+				default:
+					err = c.ScanQueue(name, 0, func(offset int64, items []string) error {
+						for i, item := range items {
+							w.Write(ssdb.DumpRecord{Type: typ, Key: name, Position: offset + int64(i), Value: item})
+						}
+						return nil
+					})
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func newRestorer(t *testing.T, c *ssdb.Client, data []byte, stateFile string, records int64) *restorer {
+	t.Helper()
+	dr, err := ssdb.NewDumpReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &restorer{
+		c:         c,
+		dump:      dr,
+		batch:     2,
+		retries:   1,
+		stateFile: stateFile,
+		state:     State{Source: dr.Source, Created: dr.Created.Unix(), Records: records},
+		start:     time.Now(),
+	}
+}
+
+// compare fails unless dst holds what src holds.
+func compare(t *testing.T, src, dst *ssdb.Client) {
+	t.Helper()
+	r, err := ssdb.NewDiff(src, dst).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Mismatches) != 0 {
+		t.Fatalf("restored data differs: %+v", r.Mismatches)
+	}
+}
+
+func fill(t *testing.T, s *ssdbtest.Server) {
+	t.Helper()
+	for _, cmd := range [][]string{
+		{"set", "a", "1"},
+		{"set", "b", "two words"},
+		{"setx", "c", "3", "100"},
+		{"hset", "h", "f", "v"},
+		{"hset", "h", "g", "\x00\xff"},
+		{"zset", "z", "m", "-5"},
+		{"qpush_back", "q", "q0", "q1", "q2", "q3", "q4"},
+	} {
+		if resp := s.Exec(cmd); resp[0] != "ok" {
+			t.Fatalf("%v: %v", cmd, resp)
+		}
+	}
+}
+
+// failPush makes qpush_back of item fail while fail is set, the pushes
+// before it in the same pipeline go through.
+func failPush(s *ssdbtest.Server, item string, fail *int32) {
+	s.Handle("qpush_back", func(args []string) []string {
+		if args[len(args)-1] == item && atomic.LoadInt32(fail) == 1 {
+			atomic.StoreInt32(fail, 0)
+			return []string{"error", "push failed"}
+		}
+		return s.Exec(append([]string{"qpush"}, args[1:]...))
+	})
+}
+
+func queue(s *ssdbtest.Server, name string) []string {
+	return s.Exec([]string{"qrange", name, "0", "100"})[1:]
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	fill(t, src)
+	dst.Exec([]string{"qpush_back", "q", "stale"})
+	c, d := connect(t, src), connect(t, dst)
+
+	rs := newRestorer(t, d, dump(t, c), "", 0)
+	if err := rs.Run(); err != nil {
+		t.Fatal(err)
+	}
+	compare(t, c, d)
+	if ttl := dst.Exec([]string{"ttl", "c"}); ttl[1] == "-1" {
+		t.Fatalf("restored key without its ttl: %v", ttl)
+	}
+	if rs.restored != rs.dump.Records() {
+		t.Fatalf("%d of %d records restored", rs.restored, rs.dump.Records())
+	}
+}
+
+func TestRestoreResume(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	fill(t, src)
+	c, d := connect(t, src), connect(t, dst)
+	data := dump(t, c)
+	stateFile := filepath.Join(t.TempDir(), "dump.state")
+
+	// the batch pushing q2 fails after q1 went through
+	fail := int32(1)
+	failPush(dst, "q2", &fail)
+	if err := newRestorer(t, d, data, stateFile, 0).Run(); err == nil {
+		t.Fatal("restore with a failing batch succeeded")
+	}
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the state points before the queue, the records after it are not restored
+	if state.Source != "test" || state.Records != 6 {
+		t.Fatalf("state %+v", state)
+	}
+
+	// what was restored before the failure isn't restored again
+	dst.Exec([]string{"del", "a"})
+	if err := newRestorer(t, d, data, stateFile, state.Records).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if resp := dst.Exec([]string{"get", "a"}); resp[0] != "not_found" {
+		t.Fatalf("resume restored a record before the state again: %v", resp)
+	}
+	// the queue started over
+	if got, want := queue(dst, "q"), queue(src, "q"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("queue after resume %v, want %v", got, want)
+	}
+	dst.Exec([]string{"set", "a", "1"})
+	compare(t, c, d)
+}
+
+func TestRestoreRetryRewindsQueue(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	fill(t, src)
+	c, d := connect(t, src), connect(t, dst)
+
+	// the first attempt of the batch continuing the queue pushes q1 and
+	// fails on q2, the retry must not push q1 twice
+	fail := int32(1)
+	failPush(dst, "q2", &fail)
+	rs := newRestorer(t, d, dump(t, c), "", 0)
+	rs.retries = 2
+	if err := rs.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queue(dst, "q"), queue(src, "q"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("queue after a retry %v, want %v", got, want)
+	}
+	compare(t, c, d)
+}
+
+func TestVerifyDamagedDump(t *testing.T) {
+	src := ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	fill(t, src)
+	data := dump(t, connect(t, src))
+
+	dr, err := ssdb.NewDumpReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := verifyDump(dr); err != nil || n != 11 {
+		t.Fatalf("verify %d records: %v", n, err)
+	}
+
+	zr, _ := gzip.NewReader(bytes.NewReader(data))
+	text, _ := ioutil.ReadAll(zr)
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(strings.Replace(string(text), "hash h f v", "hash h f w", 1)))
+	zw.Close()
+	if dr, err = ssdb.NewDumpReader(&b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyDump(dr); err != ssdb.ErrDumpCorrupt {
+		t.Fatalf("verify of a damaged dump: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+type restorer struct {
+	c         *ssdb.Client
+	dump      *ssdb.DumpReader
+	prefixes  []string
+	batch     int
+	retries   int
+	stateFile string
+	state     State
+	start     time.Time
+	stopped   int32
+
+	// the queue being restored and the record before its first item,
+	// resuming inside a queue starts the queue over
+	queue      string
+	queueStart int64
+	// the queue the batch goes on with from the previous batch and its
+	// size before the batch, the other queues of a batch start with qclear
+	cont     string
+	contSize int64
+
+	// updated atomically, progress reports read them
+	restored int64
+	skipped  int64 // filtered out or already restored before a resume
+	expired  int64
+}
+
+func (rs *restorer) report(state string) {
+	elapsed := time.Since(rs.start)
+	restored := atomic.LoadInt64(&rs.restored)
+	rate := float64(restored) / elapsed.Seconds()
+	log.Printf("%s: %d records restored, %d skipped, %d expired, %.0f records/s\n",
+		state, restored, atomic.LoadInt64(&rs.skipped), atomic.LoadInt64(&rs.expired), rate)
+}
+
+func (rs *restorer) match(key string) bool {
+	if len(rs.prefixes) == 0 {
+		return true
+	}
+	for _, p := range rs.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// command returns the commands restoring a record, none when it is skipped.
+func (rs *restorer) command(r ssdb.DumpRecord) [][]interface{} {
+	if !rs.match(r.Key) {
+		atomic.AddInt64(&rs.skipped, 1)
+		return nil
+	}
+	switch r.Type {
+	case ssdb.TypeKV:
+		if r.ExpireAt == 0 {
+			return [][]interface{}{{"set", r.Key, r.Value}}
+		}
+		ttl := r.ExpireAt - time.Now().Unix()
+		if ttl <= 0 {
+			atomic.AddInt64(&rs.expired, 1)
+			return nil
+		}
+		return [][]interface{}{{"setx", r.Key, r.Value, ttl}}
+	case ssdb.TypeHash:
+		return [][]interface{}{{"hset", r.Key, r.Field, r.Value}}
+	case ssdb.TypeZset:
+		return [][]interface{}{{"zset", r.Key, r.Field, r.Score}}
+	default:
+		if r.Position == 0 {
+			return [][]interface{}{{"qclear", r.Key}, {"qpush_back", r.Key, r.Value}}
+		}
+		return [][]interface{}{{"qpush_back", r.Key, r.Value}}
+	}
+}
+
+// Run restores the records after state.Records, saving the state after
+// every batch.
+func (rs *restorer) Run() error {
+	resumeAt := rs.state.Records
+	var cmds [][]interface{}
+	restored := int64(0) // records in cmds
+	for {
+		if atomic.LoadInt32(&rs.stopped) == 1 {
+			if err := rs.apply(cmds, restored); err != nil {
+				return err
+			}
+			return fmt.Errorf("interrupted after record %d", rs.state.Records)
+		}
+		r, err := rs.dump.Next()
+		if err == io.EOF {
+			return rs.apply(cmds, restored)
+		}
+		if err != nil {
+			// the records before the damage are restored, keep them
+			if aerr := rs.apply(cmds, restored); aerr != nil {
+				return aerr
+			}
+			return err
+		}
+		n := rs.dump.Records()
+		if r.Type == ssdb.TypeQueue {
+			if r.Key != rs.queue || r.Position == 0 {
+				rs.queue, rs.queueStart = r.Key, n-1
+			}
+		} else {
+			rs.queue = ""
+		}
+		if n <= resumeAt {
+			atomic.AddInt64(&rs.skipped, 1)
+			continue
+		}
+		if c := rs.command(r); len(c) > 0 {
+			if len(cmds) == 0 && r.Type == ssdb.TypeQueue && r.Position > 0 {
+				rs.cont, rs.contSize = r.Key, r.Position
+			}
+			cmds = append(cmds, c...)
+			restored++
+		}
+		if len(cmds) >= rs.batch {
+			if err := rs.apply(cmds, restored); err != nil {
+				return err
+			}
+			cmds, restored = cmds[:0], 0
+			rs.cont = ""
+		}
+	}
+}
+
+// apply runs a batch, retrying it, then saves the position of the last
+// record. Inside a queue the saved position is before the queue, its
+// items are appended so they can't be applied twice.
+//
+// A failed attempt may have pushed some items, before a retry the queue
+// continued from the previous batch is cut back to its size before the
+// batch. The queues starting in the batch are cleared by the retry itself.
+func (rs *restorer) apply(cmds [][]interface{}, records int64) error {
+	if len(cmds) > 0 {
+		var err error
+		for attempt := 1; attempt <= rs.retries; attempt++ {
+			if attempt > 1 {
+				err = rs.rewind()
+			}
+			if err == nil {
+				err = rs.pipeline(cmds)
+			}
+			if err == nil {
+				break
+			}
+			log.Printf("batch failed (attempt %d of %d): %v\n", attempt, rs.retries, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&rs.restored, records)
+	rs.state.Records = rs.dump.Records()
+	if rs.queue != "" {
+		rs.state.Records = rs.queueStart
+	}
+	if rs.stateFile == "" {
+		return nil
+	}
+	return saveState(rs.stateFile, rs.state)
+}
+
+func (rs *restorer) pipeline(cmds [][]interface{}) error {
+	resps, err := rs.c.Pipeline(cmds)
+	if err != nil {
+		return err
+	}
+	for i, resp := range resps {
+		if len(resp) == 0 || resp[0] != "ok" {
+			return fmt.Errorf("%v %q: %v", cmds[i][0], cmds[i][1], resp)
+		}
+	}
+	return nil
+}
+
+// rewind pops the items a failed attempt pushed to the continued queue.
+func (rs *restorer) rewind() error {
+	if rs.cont == "" {
+		return nil
+	}
+	resp, err := rs.c.Do("qsize", rs.cont)
+	if err != nil {
+		return err
+	}
+	if len(resp) < 2 || resp[0] != "ok" {
+		return fmt.Errorf("qsize %q: %v", rs.cont, resp)
+	}
+	size, err := strconv.ParseInt(resp[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("qsize %q: %v", rs.cont, resp)
+	}
+	if size <= rs.contSize {
+		return nil
+	}
+	resp, err = rs.c.Do("qpop_back", rs.cont, size-rs.contSize)
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return fmt.Errorf("qpop_back %q: %v", rs.cont, resp)
+	}
+	return nil
+}
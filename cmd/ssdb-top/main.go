@@ -0,0 +1,119 @@
+// ssdb-top is a live dashboard of one or many SSDB servers: commands per
+// second from total_calls, links, dbsize, the binlog position and the
+// replication state and lag, refreshed every second with sparklines.
+//
+//	ssdb-top -servers 127.0.0.1:8888
+//	ssdb-top -servers 10.0.0.1:8888,10.0.0.2:8888,10.0.0.3:8888 -i 2s
+//	ssdb-top -servers 127.0.0.1:8888 -batch -n 10 > top.log
+//
+// The lag of a slave is known when its master is watched too.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+const APP_VERSION = "0.1"
+
+func main() {
+	var (
+		servers, auth      string
+		interval           time.Duration
+		width, count       int
+		batch, versionFlag bool
+	)
+	flag.StringVar(&servers, "servers", "127.0.0.1:8888", "comma separated host:port of the servers to watch")
+	flag.StringVar(&auth, "auth", "", "server password")
+	flag.DurationVar(&interval, "i", time.Second, "refresh interval")
+	flag.IntVar(&width, "width", 30, "samples shown in the sparklines")
+	flag.IntVar(&count, "n", 0, "stop after this many refreshes, 0 runs until interrupted")
+	flag.BoolVar(&batch, "batch", false, "print every refresh after the previous one instead of redrawing the screen")
+	flag.BoolVar(&versionFlag, "v", false, "Print the version number.")
+	flag.Parse()
+
+	if versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if interval <= 0 || width < 1 {
+		log.Fatalln("-i and -width must be positive")
+	}
+	// connection errors are shown on the dashboard
+	log.SetOutput(ioutil.Discard)
+	cl := &Cluster{}
+	for _, addr := range strings.Split(servers, ",") {
+		addr = strings.TrimSpace(addr)
+		host, p, err := net.SplitHostPort(addr)
+		if err != nil {
+			fatal(err)
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			fatal(fmt.Errorf("bad port in %s", addr))
+		}
+		// a server that is down is retried in the background
+		c, _ := ssdb.Connect(host, port, auth)
+		cl.Servers = append(cl.Servers, NewServer(addr, c, width))
+	}
+
+	stop := make(chan struct{})
+	for _, s := range cl.Servers {
+		go s.Run(interval, stop)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if !batch {
+		// hide the cursor while redrawing
+		fmt.Fprint(out, "\x1b[?25l")
+	}
+	done := func() {
+		if !batch {
+			fmt.Fprint(out, "\x1b[?25h")
+		}
+		out.Flush()
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-ticker.C:
+		case <-sig:
+			close(stop)
+			done()
+			return
+		}
+		if batch {
+			if n > 1 {
+				fmt.Fprintln(out)
+			}
+		} else {
+			fmt.Fprint(out, "\x1b[H\x1b[2J")
+		}
+		Render(out, cl.Snapshot(), interval, width)
+		out.Flush()
+		if count > 0 && n >= count {
+			close(stop)
+			done()
+			return
+		}
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
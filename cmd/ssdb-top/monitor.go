@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// history is a fixed size window of samples, oldest first.
+type history struct {
+	size    int
+	samples []float64
+}
+
+func (h *history) add(v float64) {
+	h.samples = append(h.samples, v)
+	if len(h.samples) > h.size {
+		h.samples = h.samples[len(h.samples)-h.size:]
+	}
+}
+
+// Server polls the info of one server.
+type Server struct {
+	Addr string
+	c    *ssdb.Client
+
+	mu        sync.Mutex
+	info      *ssdb.Info
+	err       error
+	polled    time.Time
+	lastCalls uint64
+	lastAt    time.Time
+	ops       history // commands per second
+	lag       history // binlog records behind the master, filled by the cluster view
+}
+
+func NewServer(addr string, c *ssdb.Client, window int) *Server {
+	return &Server{Addr: addr, c: c, ops: history{size: window}, lag: history{size: window}}
+}
+
+// Poll reads info once and derives the ops/s since the previous poll.
+func (s *Server) Poll() {
+	info, err := s.c.Info()
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polled, s.err = now, err
+	if err != nil {
+		return
+	}
+	// a restarted server counts from 0 again, skip that sample
+	if !s.lastAt.IsZero() && info.TotalCalls >= s.lastCalls {
+		s.ops.add(float64(info.TotalCalls-s.lastCalls) / now.Sub(s.lastAt).Seconds())
+	}
+	s.info, s.lastCalls, s.lastAt = info, info.TotalCalls, now
+}
+
+// Run polls every interval until stop is closed.
+func (s *Server) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Poll()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Snapshot is the state of a server at a refresh.
+type Snapshot struct {
+	Addr string
+	Info *ssdb.Info
+	Err  error
+	Ops  []float64
+	Lag  []float64
+
+	// replication computed across the watched servers
+	MasterLag   int64 // lag behind the master when it is watched, -1 when unknown
+	MaxSlaveLag uint64
+}
+
+func (s *Server) snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Snapshot{
+		Addr:      s.Addr,
+		Info:      s.info,
+		Err:       s.err,
+		Ops:       append([]float64(nil), s.ops.samples...),
+		MasterLag: -1,
+	}
+}
+
+// Cluster is the servers watched together.
+type Cluster struct {
+	Servers []*Server
+}
+
+// Snapshot returns the state of every server. The lag of a slave is
+// computed from the binlog of its master when the master is watched too,
+// and added to the lag history of the slave.
+func (cl *Cluster) Snapshot() []Snapshot {
+	snaps := make([]Snapshot, len(cl.Servers))
+	byAddr := make(map[string]*ssdb.Info)
+	for i, s := range cl.Servers {
+		snaps[i] = s.snapshot()
+		if snaps[i].Info != nil {
+			byAddr[s.Addr] = snaps[i].Info
+		}
+	}
+	for i, s := range cl.Servers {
+		snap := &snaps[i]
+		if snap.Info == nil {
+			continue
+		}
+		for _, sl := range snap.Info.Slaves {
+			if lag := sl.Lag(snap.Info.Binlog.MaxSeq); lag > snap.MaxSlaveLag {
+				snap.MaxSlaveLag = lag
+			}
+		}
+		for _, m := range snap.Info.Masters {
+			if master, ok := byAddr[m.Addr]; ok {
+				if lag := int64(m.Lag(master.Binlog.MaxSeq)); lag > snap.MasterLag {
+					snap.MasterLag = lag
+				}
+			}
+		}
+		s.mu.Lock()
+		if snap.MasterLag >= 0 {
+			s.lag.add(float64(snap.MasterLag))
+		}
+		snap.Lag = append([]float64(nil), s.lag.samples...)
+		s.mu.Unlock()
+	}
+	return snaps
+}
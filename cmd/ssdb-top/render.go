@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws samples scaled to their maximum, padded to width.
+func sparkline(samples []float64, width int) string {
+	if len(samples) > width {
+		samples = samples[len(samples)-width:]
+	}
+	max := 0.0
+	for _, v := range samples {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(samples)))
+	for _, v := range samples {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// sumSeries adds series aligned on their last sample.
+func sumSeries(series [][]float64) []float64 {
+	n := 0
+	for _, s := range series {
+		if len(s) > n {
+			n = len(s)
+		}
+	}
+	sum := make([]float64, n)
+	for _, s := range series {
+		for i, v := range s {
+			sum[n-len(s)+i] += v
+		}
+	}
+	return sum
+}
+
+func last(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	return samples[len(samples)-1]
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, i := float64(n), -1
+	for f >= unit && i < 5 {
+		f /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", f, "KMGTPE"[i])
+}
+
+// replication describes the role of a server and its replication state.
+func replication(s Snapshot) string {
+	info := s.Info
+	if len(info.Masters) > 0 {
+		var parts []string
+		for _, m := range info.Masters {
+			p := fmt.Sprintf("slave of %s %s", m.Addr, m.Status)
+			if s.MasterLag >= 0 {
+				p += fmt.Sprintf(" lag %d", s.MasterLag)
+			}
+			parts = append(parts, p)
+		}
+		return strings.Join(parts, ", ")
+	}
+	if len(info.Slaves) > 0 {
+		return fmt.Sprintf("master of %d, max lag %d", len(info.Slaves), s.MaxSlaveLag)
+	}
+	return "standalone"
+}
+
+// Render writes one frame of the dashboard.
+func Render(w io.Writer, snaps []Snapshot, interval time.Duration, width int) {
+	fmt.Fprintf(w, "ssdb-top %s  %d servers  %s  every %s\n\n", APP_VERSION, len(snaps), time.Now().Format("2006-01-02 15:04:05"), interval)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "SERVER\tVERSION\tOPS/S\tOPS\tLINKS\tDBSIZE\tBINLOG SEQ\tLAG\tREPLICATION\n")
+	var ops [][]float64
+	var links, dbsize int64
+	up := 0
+	for _, s := range snaps {
+		if s.Info == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\t-\t-\t-\t%s\terror: %v\n", s.Addr, sparkline(nil, width), sparkline(nil, width), s.Err)
+			continue
+		}
+		status := replication(s)
+		if s.Err != nil {
+			// keep showing the last info, flag it as stale
+			status = fmt.Sprintf("error: %v", s.Err)
+		} else {
+			up++
+		}
+		ops = append(ops, s.Ops)
+		links += s.Info.Links
+		dbsize += s.Info.DbSize
+		fmt.Fprintf(tw, "%s\t%s\t%.0f\t%s\t%d\t%s\t%d\t%s\t%s\n", s.Addr, s.Info.Version, last(s.Ops), sparkline(s.Ops, width),
+			s.Info.Links, humanBytes(s.Info.DbSize), s.Info.Binlog.MaxSeq, sparkline(s.Lag, width), status)
+	}
+	if len(snaps) > 1 {
+		total := sumSeries(ops)
+		fmt.Fprintf(tw, "cluster\t\t%.0f\t%s\t%d\t%s\t\t%s\t%d of %d up\n", last(total), sparkline(total, width),
+			links, humanBytes(dbsize), strings.Repeat(" ", width), up, len(snaps))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,476 @@
+package ssdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BinlogType is the type byte of a binlog record (ssdb src/binlog.h).
+type BinlogType byte
+
+const (
+	BinlogNoop   BinlogType = 0
+	BinlogSync   BinlogType = 1
+	BinlogMirror BinlogType = 2
+	BinlogCopy   BinlogType = 3
+	BinlogCtrl   BinlogType = 4
+)
+
+// BinlogCommand is the command byte of a binlog record.
+type BinlogCommand byte
+
+const (
+	BinlogNone       BinlogCommand = 0
+	BinlogKSet       BinlogCommand = 1
+	BinlogKDel       BinlogCommand = 2
+	BinlogHSet       BinlogCommand = 3
+	BinlogHDel       BinlogCommand = 4
+	BinlogZSet       BinlogCommand = 5
+	BinlogZDel       BinlogCommand = 6
+	BinlogBegin      BinlogCommand = 7
+	BinlogEnd        BinlogCommand = 8
+	BinlogQPushBack  BinlogCommand = 10
+	BinlogQPushFront BinlogCommand = 11
+	BinlogQPopBack   BinlogCommand = 12
+	BinlogQPopFront  BinlogCommand = 13
+	BinlogQSet       BinlogCommand = 14
+)
+
+var binlogOps = map[BinlogCommand]string{
+	BinlogKSet:       "set",
+	BinlogKDel:       "del",
+	BinlogHSet:       "hset",
+	BinlogHDel:       "hdel",
+	BinlogZSet:       "zset",
+	BinlogZDel:       "zdel",
+	BinlogQPushBack:  "qpush_back",
+	BinlogQPushFront: "qpush_front",
+	BinlogQPopBack:   "qpop_back",
+	BinlogQPopFront:  "qpop_front",
+	BinlogQSet:       "qset",
+}
+
+const binlogHeaderLen = 10
+
+// Binlog is one record of the replication stream: an 8 byte little endian
+// sequence, a type byte, a command byte and the encoded storage key.
+type Binlog struct {
+	Seq  uint64
+	Type BinlogType
+	Cmd  BinlogCommand
+	Key  []byte
+}
+
+func ParseBinlog(b []byte) (Binlog, error) {
+	if len(b) < binlogHeaderLen {
+		return Binlog{}, fmt.Errorf("binlog too short:%d", len(b))
+	}
+	return Binlog{
+		Seq:  binary.LittleEndian.Uint64(b),
+		Type: BinlogType(b[8]),
+		Cmd:  BinlogCommand(b[9]),
+		Key:  b[binlogHeaderLen:],
+	}, nil
+}
+
+// Encode returns the record as sent on the wire.
+func (b Binlog) Encode() []byte {
+	buf := make([]byte, binlogHeaderLen, binlogHeaderLen+len(b.Key))
+	binary.LittleEndian.PutUint64(buf, b.Seq)
+	buf[8] = byte(b.Type)
+	buf[9] = byte(b.Cmd)
+	return append(buf, b.Key...)
+}
+
+// Storage key encodings of ssdb (src/ssdb/t_*.h), binlog keys use them.
+
+func EncodeKVKey(key string) []byte {
+	return append([]byte{'k'}, key...)
+}
+
+func EncodeHashKey(name string, key string) []byte {
+	buf := []byte{'h', byte(len(name))}
+	buf = append(buf, name...)
+	buf = append(buf, '=')
+	return append(buf, key...)
+}
+
+func EncodeZsetKey(name string, key string) []byte {
+	buf := []byte{'s', byte(len(name))}
+	buf = append(buf, name...)
+	buf = append(buf, byte(len(key)))
+	return append(buf, key...)
+}
+
+func EncodeQueueItemKey(name string, seq uint64) []byte {
+	buf := []byte{'q', byte(len(name))}
+	buf = append(buf, name...)
+	return binary.BigEndian.AppendUint64(buf, seq)
+}
+
+// lenPrefixed splits "<len byte><data>rest".
+func lenPrefixed(b []byte) (string, []byte, bool) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return "", nil, false
+	}
+	n := int(b[0])
+	return string(b[1 : 1+n]), b[1+n:], true
+}
+
+// Event is a decoded binlog record. Key is the KV key or the hash, zset or
+// queue name, Field the hash field or zset member, Value the value, score or
+// queue item. Op is one of set, del, hset, hdel, zset, zdel, qpush_back,
+// qpush_front, qpop_back, qpop_front, qset, and copy_begin/copy_end around
+// the initial copy of the whole data set.
+type Event struct {
+	Seq      uint64
+	Copy     bool // sent during the copy phase
+	Op       string
+	Key      string
+	Field    string
+	Value    string
+	QueueSeq uint64 // item sequence of qset and qpush
+	// Checkpoint to resume from once this event has been handled
+	Checkpoint Checkpoint
+}
+
+// DecodeEvent decodes a binlog record and its optional value.
+func DecodeEvent(b Binlog, value []byte) (Event, error) {
+	ev := Event{Seq: b.Seq, Copy: b.Type == BinlogCopy, Value: string(value)}
+	if b.Type == BinlogCopy && (b.Cmd == BinlogBegin || b.Cmd == BinlogEnd) {
+		ev.Op, ev.Value = "copy_begin", ""
+		if b.Cmd == BinlogEnd {
+			ev.Op = "copy_end"
+		}
+		return ev, nil
+	}
+	op, ok := binlogOps[b.Cmd]
+	if !ok {
+		return ev, fmt.Errorf("unknown binlog command:%d", b.Cmd)
+	}
+	ev.Op = op
+	key := b.Key
+	bad := fmt.Errorf("bad binlog key for %s:%q", op, key)
+	switch b.Cmd {
+	case BinlogKSet, BinlogKDel:
+		if len(key) < 1 || key[0] != 'k' {
+			return ev, bad
+		}
+		ev.Key = string(key[1:])
+	case BinlogHSet, BinlogHDel:
+		if len(key) < 1 || key[0] != 'h' {
+			return ev, bad
+		}
+		name, rest, ok := lenPrefixed(key[1:])
+		if !ok || len(rest) < 1 || rest[0] != '=' {
+			return ev, bad
+		}
+		ev.Key, ev.Field = name, string(rest[1:])
+	case BinlogZSet, BinlogZDel:
+		if len(key) < 1 || key[0] != 's' {
+			return ev, bad
+		}
+		name, rest, ok := lenPrefixed(key[1:])
+		if !ok {
+			return ev, bad
+		}
+		member, _, ok := lenPrefixed(rest)
+		if !ok {
+			return ev, bad
+		}
+		ev.Key, ev.Field = name, member
+	case BinlogQPushBack, BinlogQPushFront, BinlogQSet:
+		if len(key) < 1 || key[0] != 'q' {
+			return ev, bad
+		}
+		name, rest, ok := lenPrefixed(key[1:])
+		if !ok || len(rest) != 8 {
+			return ev, bad
+		}
+		ev.Key, ev.QueueSeq = name, binary.BigEndian.Uint64(rest)
+	case BinlogQPopBack, BinlogQPopFront:
+		ev.Key = string(key)
+	}
+	return ev, nil
+}
+
+// Checkpoint is the position in the master's write stream. LastKey is only
+// set while the initial copy is running and holds the last copied storage key.
+type Checkpoint struct {
+	LastSeq uint64
+	LastKey string
+}
+
+// BinlogConsumer streams the writes of a master by acting as a slave
+// (the sync140 command): a full copy of the data set first, unless resumed
+// from a checkpoint, then every write as it happens.
+type BinlogConsumer struct {
+	Ip       string
+	Port     int
+	Password string
+	Mirror   bool // ask for a mirror (master-master) stream instead of sync
+	// Heartbeat is the longest silence before the connection is considered
+	// dead, the master sends a noop every few seconds. Default 30s.
+	Heartbeat time.Duration
+
+	mu         sync.Mutex
+	checkpoint Checkpoint
+	phase      string
+	masterSeq  uint64
+	err        error
+}
+
+func NewBinlogConsumer(ip string, port int, auth string, from Checkpoint) *BinlogConsumer {
+	return &BinlogConsumer{Ip: ip, Port: port, Password: auth, checkpoint: from, phase: "init"}
+}
+
+// Checkpoint returns the position after the last handled event.
+func (b *BinlogConsumer) Checkpoint() Checkpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.checkpoint
+}
+
+// MasterSeq returns the master's last binlog sequence seen on the stream,
+// LastSeq of the checkpoint behind it is the replication lag.
+func (b *BinlogConsumer) MasterSeq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.masterSeq
+}
+
+// Phase returns init, copy, sync or out_of_sync.
+func (b *BinlogConsumer) Phase() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.phase
+}
+
+// Run calls fn for every event until ctx is done or fn returns an error.
+// Lost connections are retried every 5 seconds from the last checkpoint.
+func (b *BinlogConsumer) Run(ctx context.Context, fn func(Event) error) error {
+	for {
+		err := b.session(ctx, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := err.(handlerError); ok {
+			return err.(handlerError).err
+		}
+		log.Printf("SSDB binlog consumer %s:%d error:%v, retry in 5s\n", b.Ip, b.Port, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Events runs the consumer in the background and delivers events on the
+// returned channel, which is closed when ctx is done. Err reports why.
+func (b *BinlogConsumer) Events(ctx context.Context, buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+	go func() {
+		defer close(ch)
+		err := b.Run(ctx, func(ev Event) error {
+			select {
+			case ch <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}()
+	return ch
+}
+
+// Err returns the error that stopped Events.
+func (b *BinlogConsumer) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string {
+	return e.err.Error()
+}
+
+func (b *BinlogConsumer) session(ctx context.Context, fn func(Event) error) error {
+	sock, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", b.Ip, b.Port), 60*time.Second)
+	if err != nil {
+		return err
+	}
+	defer sock.Close()
+	stop := context.AfterFunc(ctx, func() {
+		sock.Close()
+	})
+	defer stop()
+
+	r := bufio.NewReaderSize(sock, 64*1024)
+	if b.Password != "" {
+		if err := WriteFrame(sock, []byte("auth"), []byte(b.Password)); err != nil {
+			return err
+		}
+		resp, err := ReadFrame(r)
+		if err != nil {
+			return err
+		}
+		if len(resp) == 0 || string(resp[0]) != "ok" {
+			return fmt.Errorf("auth failed:%q", resp)
+		}
+	}
+	cp := b.Checkpoint()
+	syncType := "sync"
+	if b.Mirror {
+		syncType = "mirror"
+	}
+	err = WriteFrame(sock, []byte("sync140"), []byte(strconv.FormatUint(cp.LastSeq, 10)), []byte(cp.LastKey), []byte(syncType))
+	if err != nil {
+		return err
+	}
+	heartbeat := b.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 30 * time.Second
+	}
+	for {
+		sock.SetReadDeadline(time.Now().Add(heartbeat))
+		frame, err := ReadFrame(r)
+		if err != nil {
+			return err
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		rec, err := ParseBinlog(frame[0])
+		if err != nil {
+			return err
+		}
+		var value []byte
+		if len(frame) > 1 {
+			value = frame[1]
+		}
+		b.mu.Lock()
+		if rec.Seq > b.masterSeq {
+			b.masterSeq = rec.Seq
+		}
+		b.mu.Unlock()
+		switch rec.Type {
+		case BinlogNoop:
+			b.mu.Lock()
+			if b.checkpoint.LastKey == "" && b.phase != "copy" {
+				// caught up, the master has nothing newer
+				b.phase = "sync"
+				if rec.Seq > b.checkpoint.LastSeq {
+					b.checkpoint.LastSeq = rec.Seq
+				}
+			}
+			b.mu.Unlock()
+			continue
+		case BinlogCtrl:
+			if string(rec.Key) == "OUT_OF_SYNC" {
+				// start over with a full copy on the next session
+				b.mu.Lock()
+				b.phase = "out_of_sync"
+				b.checkpoint = Checkpoint{}
+				b.mu.Unlock()
+				return fmt.Errorf("out of sync, the master's binlog no longer holds seq %d", cp.LastSeq)
+			}
+			continue
+		case BinlogCopy:
+			b.setPhase("copy")
+		default:
+			b.setPhase("sync")
+		}
+		ev, err := DecodeEvent(rec, value)
+		if err != nil {
+			log.Printf("SSDB binlog consumer skip record seq:%d error:%v\n", rec.Seq, err)
+			continue
+		}
+		next := b.Checkpoint()
+		switch {
+		case ev.Op == "copy_begin":
+			next.LastKey = ""
+		case ev.Op == "copy_end":
+			next.LastKey = ""
+			next.LastSeq = rec.Seq
+		case ev.Copy:
+			next.LastKey = string(rec.Key)
+			next.LastSeq = rec.Seq
+		default:
+			next.LastSeq = rec.Seq
+		}
+		ev.Checkpoint = next
+		if err := fn(ev); err != nil {
+			return handlerError{err}
+		}
+		b.mu.Lock()
+		b.checkpoint = next
+		if ev.Op == "copy_end" {
+			b.phase = "sync"
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *BinlogConsumer) setPhase(phase string) {
+	b.mu.Lock()
+	b.phase = phase
+	b.mu.Unlock()
+}
+
+// WriteFrame writes one request or response block of the ssdb protocol.
+func WriteFrame(w io.Writer, blocks ...[]byte) error {
+	var buf bytes.Buffer
+	for _, v := range blocks {
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte('\n')
+		buf.Write(v)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadFrame reads one request or response block of the ssdb protocol.
+func ReadFrame(r *bufio.Reader) ([][]byte, error) {
+	var blocks [][]byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(blocks) == 0 {
+				continue
+			}
+			return blocks, nil
+		}
+		size, err := strconv.Atoi(string(line))
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("bad block size:%q", line)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, data[:size])
+	}
+}
@@ -0,0 +1,297 @@
+package ssdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func newMaster(t *testing.T) *ssdbtest.Server {
+	t.Helper()
+	s := ssdbtest.NewServer()
+	s.NoopInterval = 20 * time.Millisecond
+	t.Cleanup(s.Close)
+	return s
+}
+
+// consume runs a consumer from cp in the background until the test ends.
+func consume(t *testing.T, s *ssdbtest.Server, cp ssdb.Checkpoint) (*ssdb.BinlogConsumer, <-chan ssdb.Event) {
+	t.Helper()
+	b := ssdb.NewBinlogConsumer(s.Ip, s.Port, "", cp)
+	b.Heartbeat = time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return b, b.Events(ctx, 100)
+}
+
+func next(t *testing.T, events <-chan ssdb.Event) ssdb.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return ssdb.Event{}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBinlogConsumerNoop(t *testing.T) {
+	s := newMaster(t)
+	s.Exec([]string{"set", "a", "1"})
+	b, events := consume(t, s, ssdb.Checkpoint{LastSeq: s.Seq()})
+
+	// nothing newer than the checkpoint, the heartbeats mark it in sync
+	waitFor(t, "sync phase", func() bool { return b.Phase() == "sync" })
+
+	// a noop carrying a newer seq moves the checkpoint without an event
+	s.Replay([][]byte{ssdb.Binlog{Seq: 100, Type: ssdb.BinlogNoop}.Encode()})
+	waitFor(t, "checkpoint 100", func() bool { return b.Checkpoint().LastSeq == 100 })
+	select {
+	case ev := <-events:
+		t.Fatalf("noop delivered as %+v", ev)
+	default:
+	}
+	if cp := b.Checkpoint(); cp.LastKey != "" {
+		t.Fatalf("checkpoint %+v", cp)
+	}
+}
+
+func TestBinlogRoundTrip(t *testing.T) {
+	tests := []struct {
+		cmd   ssdb.BinlogCommand
+		key   []byte
+		op    string
+		name  string
+		field string
+		qseq  uint64
+	}{
+		{ssdb.BinlogKSet, ssdb.EncodeKVKey("user:1"), "set", "user:1", "", 0},
+		{ssdb.BinlogKDel, ssdb.EncodeKVKey(""), "del", "", "", 0},
+		{ssdb.BinlogHSet, ssdb.EncodeHashKey("h", "a=b"), "hset", "h", "a=b", 0},
+		{ssdb.BinlogHDel, ssdb.EncodeHashKey("h=x", ""), "hdel", "h=x", "", 0},
+		{ssdb.BinlogZSet, ssdb.EncodeZsetKey("rank", "m\x00\xff"), "zset", "rank", "m\x00\xff", 0},
+		{ssdb.BinlogZDel, ssdb.EncodeZsetKey("", "m"), "zdel", "", "m", 0},
+		{ssdb.BinlogQPushBack, ssdb.EncodeQueueItemKey("jobs", 1<<63), "qpush_back", "jobs", "", 1 << 63},
+		{ssdb.BinlogQPushFront, ssdb.EncodeQueueItemKey("jobs", 1<<63-1), "qpush_front", "jobs", "", 1<<63 - 1},
+		{ssdb.BinlogQSet, ssdb.EncodeQueueItemKey("q\n", 42), "qset", "q\n", "", 42},
+	}
+	for _, tt := range tests {
+		rec := ssdb.Binlog{Seq: 1<<40 + 7, Type: ssdb.BinlogSync, Cmd: tt.cmd, Key: tt.key}
+		parsed, err := ssdb.ParseBinlog(rec.Encode())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.op, err)
+		}
+		if parsed.Seq != rec.Seq || parsed.Type != rec.Type || parsed.Cmd != rec.Cmd || string(parsed.Key) != string(rec.Key) {
+			t.Fatalf("%s: parsed %+v, want %+v", tt.op, parsed, rec)
+		}
+		ev, err := ssdb.DecodeEvent(parsed, []byte("v"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.op, err)
+		}
+		if ev.Op != tt.op || ev.Key != tt.name || ev.Field != tt.field || ev.QueueSeq != tt.qseq || ev.Value != "v" || ev.Seq != rec.Seq || ev.Copy {
+			t.Fatalf("%s: decoded %+v", tt.op, ev)
+		}
+	}
+}
+
+func TestDecodeEventErrors(t *testing.T) {
+	if _, err := ssdb.ParseBinlog([]byte("short")); err == nil {
+		t.Fatal("short record parsed")
+	}
+	bad := []ssdb.Binlog{
+		{Type: ssdb.BinlogSync, Cmd: 99, Key: ssdb.EncodeKVKey("a")},
+		{Type: ssdb.BinlogSync, Cmd: ssdb.BinlogKSet, Key: ssdb.EncodeHashKey("h", "f")},
+		{Type: ssdb.BinlogSync, Cmd: ssdb.BinlogHSet, Key: []byte{'h', 9, 'x'}},
+		{Type: ssdb.BinlogSync, Cmd: ssdb.BinlogZSet, Key: []byte{'s', 1, 'z', 5}},
+		{Type: ssdb.BinlogSync, Cmd: ssdb.BinlogQSet, Key: []byte{'q', 1, 'q', 0, 1}},
+	}
+	for _, rec := range bad {
+		if ev, err := ssdb.DecodeEvent(rec, nil); err == nil {
+			t.Fatalf("%q decoded as %+v", rec.Key, ev)
+		}
+	}
+}
+
+// fill writes one of each type, their storage keys sort h, k, q, s.
+func fill(s *ssdbtest.Server) {
+	s.Exec([]string{"set", "a", "1"})
+	s.Exec([]string{"hset", "h", "f", "v"})
+	s.Exec([]string{"zset", "z", "m", "5"})
+	s.Exec([]string{"qpush_back", "q", "x", "y"})
+}
+
+func TestBinlogConsumerCopyAndSync(t *testing.T) {
+	s := newMaster(t)
+	fill(s)
+	copySeq := s.Seq()
+	b, events := consume(t, s, ssdb.Checkpoint{})
+
+	if ev := next(t, events); ev.Op != "copy_begin" || !ev.Copy {
+		t.Fatalf("first event %+v", ev)
+	}
+	want := []ssdb.Event{
+		{Op: "hset", Key: "h", Field: "f", Value: "v"},
+		{Op: "set", Key: "a", Value: "1"},
+		{Op: "qpush_back", Key: "q", Value: "x"},
+		{Op: "qpush_back", Key: "q", Value: "y"},
+		{Op: "zset", Key: "z", Field: "m", Value: "5"},
+	}
+	for _, w := range want {
+		ev := next(t, events)
+		if ev.Op != w.Op || ev.Key != w.Key || ev.Field != w.Field || ev.Value != w.Value || !ev.Copy || ev.Seq != copySeq {
+			t.Fatalf("copy event %+v, want %+v", ev, w)
+		}
+		if ev.Checkpoint.LastKey == "" || ev.Checkpoint.LastSeq != copySeq {
+			t.Fatalf("copy checkpoint %+v", ev.Checkpoint)
+		}
+	}
+	ev := next(t, events)
+	if ev.Op != "copy_end" || ev.Checkpoint != (ssdb.Checkpoint{LastSeq: copySeq}) {
+		t.Fatalf("copy_end %+v", ev)
+	}
+	waitFor(t, "sync phase", func() bool { return b.Phase() == "sync" })
+
+	s.Exec([]string{"set", "b", "2"})
+	s.Exec([]string{"hdel", "h", "f"})
+	s.Exec([]string{"qpop_front", "q"})
+	want = []ssdb.Event{
+		{Op: "set", Key: "b", Value: "2"},
+		{Op: "hdel", Key: "h", Field: "f"},
+		{Op: "qpop_front", Key: "q"},
+	}
+	for i, w := range want {
+		ev := next(t, events)
+		seq := copySeq + uint64(i) + 1
+		if ev.Op != w.Op || ev.Key != w.Key || ev.Field != w.Field || ev.Value != w.Value || ev.Copy || ev.Seq != seq {
+			t.Fatalf("sync event %+v, want %+v", ev, w)
+		}
+		if ev.Checkpoint != (ssdb.Checkpoint{LastSeq: seq}) {
+			t.Fatalf("sync checkpoint %+v", ev.Checkpoint)
+		}
+	}
+	waitFor(t, "checkpoint", func() bool { return b.Checkpoint().LastSeq == s.Seq() })
+	if b.MasterSeq() != s.Seq() {
+		t.Fatalf("master seq %d, want %d", b.MasterSeq(), s.Seq())
+	}
+}
+
+func TestBinlogConsumerResumeCopy(t *testing.T) {
+	s := newMaster(t)
+	fill(s)
+	_, events := consume(t, s, ssdb.Checkpoint{})
+	next(t, events) // copy_begin
+	next(t, events) // hset h
+	cp := next(t, events).Checkpoint
+	if cp.LastKey != string(ssdb.EncodeKVKey("a")) {
+		t.Fatalf("checkpoint after set a: %+v", cp)
+	}
+
+	// a new session from the checkpoint copies the rest only
+	_, events = consume(t, s, cp)
+	if ev := next(t, events); ev.Op != "copy_begin" {
+		t.Fatalf("first event %+v", ev)
+	}
+	want := []ssdb.Event{
+		{Op: "qpush_back", Key: "q", Value: "x"},
+		{Op: "qpush_back", Key: "q", Value: "y"},
+		{Op: "zset", Key: "z", Field: "m", Value: "5"},
+	}
+	for _, w := range want {
+		ev := next(t, events)
+		if ev.Op != w.Op || ev.Key != w.Key || ev.Field != w.Field || ev.Value != w.Value {
+			t.Fatalf("resumed copy event %+v, want %+v", ev, w)
+		}
+	}
+	if ev := next(t, events); ev.Op != "copy_end" {
+		t.Fatalf("last event %+v", ev)
+	}
+}
+
+func TestBinlogConsumerResumeSync(t *testing.T) {
+	s := newMaster(t)
+	fill(s)
+	cp := ssdb.Checkpoint{LastSeq: s.Seq()}
+	s.Exec([]string{"set", "b", "2"})
+	s.Exec([]string{"set", "c", "3"})
+
+	b, events := consume(t, s, cp)
+	for _, key := range []string{"b", "c"} {
+		if ev := next(t, events); ev.Op != "set" || ev.Key != key || ev.Copy {
+			t.Fatalf("resumed event %+v, want set %s", ev, key)
+		}
+	}
+	waitFor(t, "checkpoint", func() bool { return b.Checkpoint().LastSeq == s.Seq() })
+}
+
+func TestBinlogConsumerReplay(t *testing.T) {
+	s := newMaster(t)
+	s.Exec([]string{"qpush_back", "q", "x", "y"})
+	b, events := consume(t, s, ssdb.Checkpoint{LastSeq: s.Seq()})
+	waitFor(t, "sync phase", func() bool { return b.Phase() == "sync" })
+
+	// frames as recorded from a master, with a gap in the sequence
+	seq := s.Seq()
+	frames := [][][]byte{
+		{ssdb.Binlog{Seq: seq + 1, Type: ssdb.BinlogSync, Cmd: ssdb.BinlogHSet, Key: ssdb.EncodeHashKey("h", "f")}.Encode(), []byte("v")},
+		{ssdb.Binlog{Seq: seq + 5, Type: ssdb.BinlogSync, Cmd: ssdb.BinlogZSet, Key: ssdb.EncodeZsetKey("z", "m")}.Encode(), []byte("-3")},
+		{ssdb.Binlog{Seq: seq + 6, Type: ssdb.BinlogSync, Cmd: ssdb.BinlogQSet, Key: ssdb.EncodeQueueItemKey("q", 1<<63+1)}.Encode(), []byte("Y")},
+		{ssdb.Binlog{Seq: seq + 7, Type: ssdb.BinlogSync, Cmd: ssdb.BinlogKDel, Key: ssdb.EncodeKVKey("a")}.Encode()},
+	}
+	if err := s.Replay(frames...); err != nil {
+		t.Fatal(err)
+	}
+	want := []ssdb.Event{
+		{Seq: seq + 1, Op: "hset", Key: "h", Field: "f", Value: "v"},
+		{Seq: seq + 5, Op: "zset", Key: "z", Field: "m", Value: "-3"},
+		{Seq: seq + 6, Op: "qset", Key: "q", Value: "Y", QueueSeq: 1<<63 + 1},
+		{Seq: seq + 7, Op: "del", Key: "a"},
+	}
+	for _, w := range want {
+		ev := next(t, events)
+		w.Checkpoint = ssdb.Checkpoint{LastSeq: w.Seq}
+		if ev != w {
+			t.Fatalf("replayed event %+v, want %+v", ev, w)
+		}
+	}
+	if got := s.Exec([]string{"qget", "q", "1"}); len(got) != 2 || got[1] != "Y" {
+		t.Fatalf("replayed qset not applied: %q", got)
+	}
+	if got := s.Exec([]string{"zget", "z", "m"}); len(got) != 2 || got[1] != "-3" {
+		t.Fatalf("replayed zset not applied: %q", got)
+	}
+}
+
+func TestBinlogConsumerOutOfSync(t *testing.T) {
+	s := newMaster(t)
+	fill(s)
+	s.TrimBinlog(s.Seq())
+
+	b, _ := consume(t, s, ssdb.Checkpoint{LastSeq: 1})
+	waitFor(t, "out_of_sync", func() bool { return b.Phase() == "out_of_sync" })
+	if cp := b.Checkpoint(); cp != (ssdb.Checkpoint{}) {
+		t.Fatalf("checkpoint not reset: %+v", cp)
+	}
+
+	// starting over from the reset checkpoint is a full copy
+	_, events := consume(t, s, b.Checkpoint())
+	if ev := next(t, events); ev.Op != "copy_begin" {
+		t.Fatalf("first event after reset %+v", ev)
+	}
+}
@@ -0,0 +1,213 @@
+package ssdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without touching the network while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("ssdb: circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures a CircuitBreaker, zero values take the defaults.
+type BreakerConfig struct {
+	FailureRatio     float64       // failures/calls within Window that opens the breaker, default 0.5
+	MinRequests      int           // calls within Window before the ratio is checked, default 10
+	Window           time.Duration // counting window, default 10s
+	CoolDown         time.Duration // time spent open before probing, default 5s
+	HalfOpenRequests int           // probe calls allowed while half-open, default 1
+	OnStateChange    func(from BreakerState, to BreakerState)
+}
+
+// CircuitBreaker fails calls fast with ErrCircuitOpen while an endpoint keeps failing.
+// Only network errors count as failures, error statuses of the server do not.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	cfg         BreakerConfig
+	state       BreakerState
+	windowStart time.Time
+	calls       int
+	failures    int
+	openedAt    time.Time
+	probes      int
+}
+
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureRatio <= 0 {
+		cfg.FailureRatio = 0.5
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 5 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{cfg: cfg, windowStart: time.Now()}
+}
+
+// State returns the current state.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cfg.CoolDown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may go ahead, every allowed call must be
+// followed by Report, or by Release when the call has no outcome.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	from := b.state
+	if b.state == BreakerOpen {
+		if time.Since(b.openedAt) < b.cfg.CoolDown {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	var err error
+	if b.state == BreakerHalfOpen {
+		if b.probes < b.cfg.HalfOpenRequests {
+			b.probes++
+		} else {
+			err = ErrCircuitOpen
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+	return err
+}
+
+// Report records the outcome of an allowed call.
+func (b *CircuitBreaker) Report(success bool) {
+	b.mu.Lock()
+	from := b.state
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		if success {
+			b.state = BreakerClosed
+			b.windowStart = now
+			b.calls, b.failures = 0, 0
+		} else {
+			b.state = BreakerOpen
+			b.openedAt = now
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) > b.cfg.Window {
+			b.windowStart = now
+			b.calls, b.failures = 0, 0
+		}
+		b.calls++
+		if !success {
+			b.failures++
+		}
+		if b.calls >= b.cfg.MinRequests && float64(b.failures)/float64(b.calls) >= b.cfg.FailureRatio {
+			b.state = BreakerOpen
+			b.openedAt = now
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+}
+
+// Release gives back an allowed call that ended without telling anything
+// about the endpoint, like one canceled by its caller. A half-open breaker
+// lets another probe through in its place.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+func (b *CircuitBreaker) changed(from BreakerState, to BreakerState) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+// Reset closes the breaker and forgets the calls counted so far.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	from := b.state
+	b.state = BreakerClosed
+	b.windowStart = time.Now()
+	b.calls, b.failures, b.probes = 0, 0, 0
+	b.mu.Unlock()
+	b.changed(from, BreakerClosed)
+}
+
+// Interceptor guards every command of the chain with the breaker.
+func (b *CircuitBreaker) Interceptor(next Handler) Handler {
+	return func(cmd *Cmd) error {
+		if err := b.Allow(); err != nil {
+			cmd.Resp = nil
+			return err
+		}
+		err := next(cmd)
+		if err != nil && !connectionError(err) {
+			// only a reply or a network error decides, not the caller giving up
+			b.Release()
+			return err
+		}
+		b.Report(err == nil)
+		return err
+	}
+}
+
+// connectionError reports whether err is a failure of the connection. The
+// caller's own context ending is not, and error statuses of the server come
+// back in the response, not as errors.
+func connectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return true
+}
+
+// SetCircuitBreaker installs a circuit breaker in front of the client's
+// connection. It is reset whenever the client moves to another endpoint,
+// which has not failed yet.
+func (c *Client) SetCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	b := NewCircuitBreaker(cfg)
+	c.Use(b.Interceptor)
+	c.hookMu.Lock()
+	c.breakers = append(c.breakers, b)
+	c.hookMu.Unlock()
+	return b
+}
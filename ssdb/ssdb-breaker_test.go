@@ -0,0 +1,123 @@
+package ssdb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestBreakerCountsConnectionErrors(t *testing.T) {
+	b := ssdb.NewCircuitBreaker(ssdb.BreakerConfig{MinRequests: 4, FailureRatio: 0.5, CoolDown: time.Hour})
+	var err error
+	h := b.Interceptor(func(cmd *ssdb.Cmd) error {
+		cmd.Resp = []string{"error", "bad"}
+		return err
+	})
+	call := func() error { return h(&ssdb.Cmd{Name: "get"}) }
+
+	// the caller's context and server error statuses are not failures
+	for _, err = range []error{context.Canceled, context.DeadlineExceeded, fmt.Errorf("wrapped: %w", context.Canceled), nil} {
+		for i := 0; i < 4; i++ {
+			call()
+		}
+	}
+	if b.State() != ssdb.BreakerClosed {
+		t.Fatalf("breaker %s without connection errors", b.State())
+	}
+
+	err = fmt.Errorf("read tcp: connection reset by peer")
+	for i := 0; i < 16; i++ {
+		call()
+	}
+	if b.State() != ssdb.BreakerOpen {
+		t.Fatalf("breaker %s after connection errors", b.State())
+	}
+	if got := call(); got != ssdb.ErrCircuitOpen {
+		t.Fatalf("open breaker returned %v", got)
+	}
+	b.Reset()
+	if b.State() != ssdb.BreakerClosed || call() == ssdb.ErrCircuitOpen {
+		t.Fatalf("breaker %s after Reset", b.State())
+	}
+}
+
+func TestBreakerHalfOpenCanceledProbe(t *testing.T) {
+	b := ssdb.NewCircuitBreaker(ssdb.BreakerConfig{MinRequests: 1, CoolDown: 10 * time.Millisecond})
+	var err error
+	h := b.Interceptor(func(cmd *ssdb.Cmd) error { return err })
+	call := func() error { return h(&ssdb.Cmd{Name: "get"}) }
+
+	err = fmt.Errorf("read tcp: connection reset by peer")
+	call()
+	time.Sleep(20 * time.Millisecond)
+	if b.State() != ssdb.BreakerHalfOpen {
+		t.Fatalf("breaker %s after the cool-down", b.State())
+	}
+
+	// a probe canceled by its caller neither closes nor reopens the breaker,
+	// and doesn't use up the probe
+	for _, err = range []error{context.Canceled, context.DeadlineExceeded, ssdb.ErrCircuitOpen} {
+		if got := call(); got != err {
+			t.Fatalf("probe returned %v, want %v", got, err)
+		}
+		if b.State() != ssdb.BreakerHalfOpen {
+			t.Fatalf("breaker %s after a probe failed with %v", b.State(), err)
+		}
+	}
+	err = nil
+	if got := call(); got != nil {
+		t.Fatalf("probe after canceled ones returned %v", got)
+	}
+	if b.State() != ssdb.BreakerClosed {
+		t.Fatalf("breaker %s after a successful probe", b.State())
+	}
+}
+
+func TestBreakerResetOnFailback(t *testing.T) {
+	preferred := ssdbtest.NewServer()
+	addr := preferred.Addr()
+	preferred.Close()
+	backup := ssdbtest.NewServer()
+	t.Cleanup(backup.Close)
+
+	c, err := ssdb.ConnectFailover([]ssdb.Node{
+		{Ip: preferred.Ip, Port: preferred.Port},
+		{Ip: backup.Ip, Port: backup.Port},
+	}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	b := c.SetCircuitBreaker(ssdb.BreakerConfig{MinRequests: 1, CoolDown: time.Hour})
+	b.Allow()
+	b.Report(false)
+	if b.State() != ssdb.BreakerOpen {
+		t.Fatalf("breaker %s", b.State())
+	}
+
+	preferred, err = ssdbtest.NewServerAt(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(preferred.Close)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, active := c.Endpoints(); active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no failback")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.State() != ssdb.BreakerClosed {
+		t.Fatalf("breaker %s after moving to another endpoint", b.State())
+	}
+	if _, err := c.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+}
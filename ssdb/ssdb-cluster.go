@@ -0,0 +1,572 @@
+package ssdb
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// virtual points per weight unit on the hash ring
+const ringReplicas = 160
+
+// Node is one SSDB server of a Cluster.
+type Node struct {
+	Ip       string
+	Port     int
+	Password string
+	Weight   int // default 1
+}
+
+func (n Node) Addr() string {
+	return fmt.Sprintf("%s:%d", n.Ip, n.Port)
+}
+
+type ringPoint struct {
+	hash uint32
+	node int
+}
+
+// Cluster spreads keys and hashes over several SSDB servers by consistent hashing.
+// Only the part of a key inside {} is hashed when present, so "{user42}:name"
+// and "{user42}:mail" always live on the same server.
+// Commands on several keys are split per server and run in parallel.
+//
+// Like a Client, a Cluster is not goroutine-safe. The parallel fan-out gives
+// each node's connection to a single goroutine, but calls made at the same
+// time from several goroutines share them: use one Cluster per goroutine.
+type Cluster struct {
+	Nodes []Node
+	pools []*Pool
+	ring  []ringPoint
+}
+
+// NewCluster connects to every node. Like Connect, a node that can't be reached
+// is retried in the background and its error is returned with the cluster.
+func NewCluster(nodes []Node) (*Cluster, error) {
+	return NewClusterPool(nodes, 1)
+}
+
+// NewClusterPool is NewCluster with a Pool of poolSize connections per node.
+func NewClusterPool(nodes []Node, poolSize int) (*Cluster, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no cluster nodes")
+	}
+	cl := &Cluster{Nodes: nodes}
+	var firstErr error
+	for i, n := range nodes {
+		pool, err := NewPool(n, poolSize)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cl.pools = append(cl.pools, pool)
+		weight := n.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for r := 0; r < ringReplicas*weight; r++ {
+			cl.ring = append(cl.ring, ringPoint{hash: ringHash(fmt.Sprintf("%s-%d", n.Addr(), r)), node: i})
+		}
+	}
+	sort.Slice(cl.ring, func(i, j int) bool {
+		return cl.ring[i].hash < cl.ring[j].hash
+	})
+	return cl, firstErr
+}
+
+func ringHash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
+
+// HashTag returns the part of key used for routing.
+func HashTag(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+1+e]
+		}
+	}
+	return key
+}
+
+func (cl *Cluster) nodeFor(key string) int {
+	h := ringHash(HashTag(key))
+	i := sort.Search(len(cl.ring), func(i int) bool {
+		return cl.ring[i].hash >= h
+	})
+	if i == len(cl.ring) {
+		i = 0
+	}
+	return cl.ring[i].node
+}
+
+// NodeFor returns the index in Nodes of the server owning key (or hash name).
+func (cl *Cluster) NodeFor(key string) int {
+	return cl.nodeFor(key)
+}
+
+// ClientFor returns the client of the server owning key (or hash name).
+func (cl *Cluster) ClientFor(key string) *Client {
+	return cl.client(cl.nodeFor(key))
+}
+
+func (cl *Cluster) client(node int) *Client {
+	return cl.pools[node].Get()
+}
+
+// Pool returns the connections of a node.
+func (cl *Cluster) Pool(node int) *Pool {
+	return cl.pools[node]
+}
+
+// Clients returns the clients of all nodes, in the order of Nodes.
+func (cl *Cluster) Clients() []*Client {
+	var clients []*Client
+	for _, p := range cl.pools {
+		clients = append(clients, p.Clients()...)
+	}
+	return clients
+}
+
+// Use adds interceptors to every client of every node.
+func (cl *Cluster) Use(interceptors ...Interceptor) {
+	for _, c := range cl.Clients() {
+		c.Use(interceptors...)
+	}
+}
+
+// Stats returns the metrics of every client, in the order of Clients.
+func (cl *Cluster) Stats() []Stats {
+	var stats []Stats
+	for _, c := range cl.Clients() {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+func (cl *Cluster) Close() error {
+	for _, p := range cl.pools {
+		p.Close()
+	}
+	return nil
+}
+
+// each runs fn for every node in parallel and returns the first error.
+func (cl *Cluster) each(nodes []int, fn func(i int) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(nodes))
+	for n, i := range nodes {
+		wg.Add(1)
+		go func(n int, i int) {
+			defer wg.Done()
+			errs[n] = fn(i)
+		}(n, i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl *Cluster) all() []int {
+	nodes := make([]int, len(cl.pools))
+	for i := range nodes {
+		nodes[i] = i
+	}
+	return nodes
+}
+
+// splitKeys groups keys by owning node.
+func (cl *Cluster) splitKeys(keys []string) (map[int][]string, []int) {
+	groups := make(map[int][]string)
+	var nodes []int
+	for _, k := range keys {
+		i := cl.nodeFor(k)
+		if _, ok := groups[i]; !ok {
+			nodes = append(nodes, i)
+		}
+		groups[i] = append(groups[i], k)
+	}
+	return groups, nodes
+}
+
+var clusterMultiKeyCmds = map[string]int{
+	"multi_get":    1,
+	"multi_del":    1,
+	"multi_exists": 1,
+	"multi_set":    2,
+}
+
+// Do routes a raw command by its first argument. multi_get, multi_set,
+// multi_del and multi_exists are split per node and their responses merged.
+func (cl *Cluster) Do(args ...interface{}) ([]string, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("cluster: command needs a key")
+	}
+	name := argString(args[0])
+	step, ok := clusterMultiKeyCmds[name]
+	if !ok {
+		return cl.ClientFor(argString(args[1])).Do(args...)
+	}
+	groups := make(map[int][]interface{})
+	var nodes []int
+	for i := 1; i+step <= len(args); i += step {
+		n := cl.nodeFor(argString(args[i]))
+		if _, ok := groups[n]; !ok {
+			nodes = append(nodes, n)
+			groups[n] = []interface{}{args[0]}
+		}
+		groups[n] = append(groups[n], args[i:i+step]...)
+	}
+	var mu sync.Mutex
+	resp := []string{"ok"}
+	var total int64
+	err := cl.each(nodes, func(i int) error {
+		r, err := cl.client(i).Do(groups[i]...)
+		if err != nil {
+			return err
+		}
+		if len(r) == 0 || r[0] != "ok" {
+			return fmt.Errorf("bad response:%v node:%s", r, cl.Nodes[i].Addr())
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if name == "multi_get" || name == "multi_exists" {
+			resp = append(resp, r[1:]...)
+		} else if len(r) > 1 {
+			var n int64
+			fmt.Sscanf(r[1], "%d", &n)
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name == "multi_set" || name == "multi_del" {
+		resp = append(resp, fmt.Sprintf("%d", total))
+	}
+	return resp, nil
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	}
+	return fmt.Sprintf("%v", arg)
+}
+
+// Pipeline splits the commands per node by their first argument, pipelines
+// every group and returns the responses in the original order.
+func (cl *Cluster) Pipeline(args [][]interface{}) ([][]string, error) {
+	groups := make(map[int][]int)
+	var nodes []int
+	for i, v := range args {
+		n := 0
+		if len(v) > 1 {
+			n = cl.nodeFor(argString(v[1]))
+		}
+		if _, ok := groups[n]; !ok {
+			nodes = append(nodes, n)
+		}
+		groups[n] = append(groups[n], i)
+	}
+	resps := make([][]string, len(args))
+	err := cl.each(nodes, func(n int) error {
+		var batch [][]interface{}
+		for _, i := range groups[n] {
+			batch = append(batch, args[i])
+		}
+		r, err := cl.client(n).Pipeline(batch)
+		if err != nil {
+			return err
+		}
+		for j, i := range groups[n] {
+			resps[i] = r[j]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resps, nil
+}
+
+func (cl *Cluster) MultiMode(args [][]interface{}) ([]string, error) {
+	r, err := cl.Pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+	var resps []string
+	for _, v := range r {
+		resps = append(resps, strings.Join(v, ","))
+	}
+	return resps, nil
+}
+
+func (cl *Cluster) Set(key string, val string) (interface{}, error) {
+	return cl.ClientFor(key).Set(key, val)
+}
+
+func (cl *Cluster) Get(key string) (interface{}, error) {
+	return cl.ClientFor(key).Get(key)
+}
+
+func (cl *Cluster) Del(key string) (interface{}, error) {
+	return cl.ClientFor(key).Del(key)
+}
+
+func (cl *Cluster) SetX(key string, val string, ttl int) (interface{}, error) {
+	return cl.ClientFor(key).SetX(key, val, ttl)
+}
+
+// Scan scans every node and returns the first limit keys of the merged result.
+func (cl *Cluster) Scan(start string, end string, limit int) (interface{}, error) {
+	var mu sync.Mutex
+	list := make(map[string]string)
+	err := cl.each(cl.all(), func(i int) error {
+		val, err := cl.client(i).Scan(start, end, limit)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		m, _ := val.(map[string]string)
+		for k, v := range m {
+			list[k] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := sortedKeys(list)
+	for _, k := range keys[min(limit, len(keys)):] {
+		delete(list, k)
+	}
+	return list, nil
+}
+
+func (cl *Cluster) Expire(key string, ttl int) (interface{}, error) {
+	return cl.ClientFor(key).Expire(key, ttl)
+}
+
+func (cl *Cluster) KeyTTL(key string) (interface{}, error) {
+	return cl.ClientFor(key).KeyTTL(key)
+}
+
+func (cl *Cluster) SetNew(key string, val string) (interface{}, error) {
+	return cl.ClientFor(key).SetNew(key, val)
+}
+
+func (cl *Cluster) GetSet(key string, val string) (interface{}, error) {
+	return cl.ClientFor(key).GetSet(key, val)
+}
+
+func (cl *Cluster) Incr(key string, val int) (interface{}, error) {
+	return cl.ClientFor(key).Incr(key, val)
+}
+
+func (cl *Cluster) Exists(key string) (interface{}, error) {
+	return cl.ClientFor(key).Exists(key)
+}
+
+func (cl *Cluster) MultiGet(keys []string) (map[string]string, error) {
+	groups, nodes := cl.splitKeys(keys)
+	var mu sync.Mutex
+	list := make(map[string]string)
+	err := cl.each(nodes, func(i int) error {
+		val, err := cl.client(i).MultiGet(groups[i])
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for k, v := range val {
+			list[k] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (cl *Cluster) MultiSet(data map[string]string) (interface{}, error) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	groups, nodes := cl.splitKeys(keys)
+	var total int64
+	err := cl.each(nodes, func(i int) error {
+		part := make(map[string]string)
+		for _, k := range groups[i] {
+			part[k] = data[k]
+		}
+		val, err := cl.client(i).MultiSet(part)
+		return addCount(&total, "multi_set", val, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%d", total), nil
+}
+
+func (cl *Cluster) MultiDel(keys []string) (interface{}, error) {
+	groups, nodes := cl.splitKeys(keys)
+	var total int64
+	err := cl.each(nodes, func(i int) error {
+		val, err := cl.client(i).MultiDel(groups[i])
+		return addCount(&total, "multi_del", val, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%d", total), nil
+}
+
+// addCount adds the count a node answered to a multi key command to total.
+func addCount(total *int64, name string, val interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(val), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: bad count %v", name, val)
+	}
+	atomic.AddInt64(total, n)
+	return nil
+}
+
+func (cl *Cluster) HashSet(hash string, key string, val string) (interface{}, error) {
+	return cl.ClientFor(hash).HashSet(hash, key, val)
+}
+
+// MultiHashSet groups parts by the node of their hash and runs Client.MultiHashSet on every node.
+func (cl *Cluster) MultiHashSet(parts []HashData, connNum int) (interface{}, error) {
+	groups := make(map[int][]HashData)
+	var nodes []int
+	for _, v := range parts {
+		i := cl.nodeFor(v.HashName)
+		if _, ok := groups[i]; !ok {
+			nodes = append(nodes, i)
+		}
+		groups[i] = append(groups[i], v)
+	}
+	err := cl.each(nodes, func(i int) error {
+		n := connNum
+		if n < 1 {
+			n = 1
+		}
+		if n > len(groups[i]) {
+			n = len(groups[i])
+		}
+		_, err := cl.client(i).MultiHashSet(groups[i], n)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (cl *Cluster) HashGet(hash string, key string) (interface{}, error) {
+	return cl.ClientFor(hash).HashGet(hash, key)
+}
+
+func (cl *Cluster) HashDel(hash string, key string) (interface{}, error) {
+	return cl.ClientFor(hash).HashDel(hash, key)
+}
+
+func (cl *Cluster) HashIncr(hash string, key string, val int) (interface{}, error) {
+	return cl.ClientFor(hash).HashIncr(hash, key, val)
+}
+
+func (cl *Cluster) HashExists(hash string, key string) (interface{}, error) {
+	return cl.ClientFor(hash).HashExists(hash, key)
+}
+
+func (cl *Cluster) HashSize(hash string) (interface{}, error) {
+	return cl.ClientFor(hash).HashSize(hash)
+}
+
+// HashList lists hash names of every node and returns the first limit names in order.
+func (cl *Cluster) HashList(start string, end string, limit int) (interface{}, error) {
+	var mu sync.Mutex
+	var names []string
+	err := cl.each(cl.all(), func(i int) error {
+		val, err := cl.client(i).HashList(start, end, limit)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch val := val.(type) {
+		case string:
+			names = append(names, val)
+		case []string:
+			names = append(names, val...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (cl *Cluster) HashKeys(hash string, start string, end string, limit int) (interface{}, error) {
+	return cl.ClientFor(hash).HashKeys(hash, start, end, limit)
+}
+
+func (cl *Cluster) HashKeysAll(hash string) ([]string, error) {
+	return cl.ClientFor(hash).HashKeysAll(hash)
+}
+
+func (cl *Cluster) HashGetAll(hash string) (map[string]string, error) {
+	return cl.ClientFor(hash).HashGetAll(hash)
+}
+
+func (cl *Cluster) HashGetAllLite(hash string) (map[string]string, error) {
+	return cl.ClientFor(hash).HashGetAllLite(hash)
+}
+
+func (cl *Cluster) HashScan(hash string, start string, end string, limit int) (map[string]string, error) {
+	return cl.ClientFor(hash).HashScan(hash, start, end, limit)
+}
+
+func (cl *Cluster) HashRScan(hash string, start string, end string, limit int) (map[string]string, error) {
+	return cl.ClientFor(hash).HashRScan(hash, start, end, limit)
+}
+
+func (cl *Cluster) HashMultiSet(hash string, data map[string]string) (interface{}, error) {
+	return cl.ClientFor(hash).HashMultiSet(hash, data)
+}
+
+func (cl *Cluster) HashMultiGet(hash string, keys []string) (map[string]string, error) {
+	return cl.ClientFor(hash).HashMultiGet(hash, keys)
+}
+
+func (cl *Cluster) HashMultiDel(hash string, keys []string) (interface{}, error) {
+	return cl.ClientFor(hash).HashMultiDel(hash, keys)
+}
+
+func (cl *Cluster) HashClear(hash string) (interface{}, error) {
+	return cl.ClientFor(hash).HashClear(hash)
+}
@@ -0,0 +1,48 @@
+package ssdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestClusterMultiCounts(t *testing.T) {
+	a, b := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	cl, err := ssdb.NewCluster([]ssdb.Node{node(t, a.Addr()), node(t, b.Addr())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	data := make(map[string]string)
+	var keys []string
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("k%d", i)
+		data[k] = "v"
+		keys = append(keys, k)
+	}
+	n, err := cl.MultiSet(data)
+	if err != nil || n != "20" {
+		t.Fatalf("multi_set %v %v", n, err)
+	}
+	onB := len(b.Exec([]string{"keys", "", "", "100"})) - 1
+	if onB == 0 || onB == 20 {
+		t.Fatalf("%d of 20 keys on the second node", onB)
+	}
+
+	// the second node deletes nothing
+	b.Handle("multi_del", func(args []string) []string { return []string{"ok", "0"} })
+	n, err = cl.MultiDel(keys)
+	if err != nil || n != fmt.Sprint(20-onB) {
+		t.Fatalf("multi_del %v %v, want %d", n, err, 20-onB)
+	}
+
+	b.Handle("multi_del", func(args []string) []string { return []string{"error"} })
+	if n, err = cl.MultiDel(keys); err == nil {
+		t.Fatalf("multi_del with a failing node answered %v", n)
+	}
+}
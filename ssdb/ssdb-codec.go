@@ -0,0 +1,236 @@
+package ssdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec turns values that have no plain string form into bytes and back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobCodec encodes values with encoding/gob, each value as a stream of its own.
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// StructCodec encodes the struct, map, slice and array fields of the
+// structs stored by HashSetStruct.
+var StructCodec Codec = JSONCodec{}
+
+// Header bytes of the built in codecs. HeaderMsgpack is kept for a msgpack
+// codec registered by the application, the others are free for custom ones.
+const (
+	HeaderJSON    byte = 0x01
+	HeaderGob     byte = 0x02
+	HeaderMsgpack byte = 0x03
+)
+
+var (
+	codecsMu    sync.RWMutex
+	codecs      = map[byte]Codec{HeaderJSON: JSONCodec{}, HeaderGob: GobCodec{}}
+	codecHeader = map[Codec]byte{JSONCodec{}: HeaderJSON, GobCodec{}: HeaderGob}
+)
+
+// RegisterCodec makes c usable by Encode and Decode under header. Codecs
+// are told apart by value, so two differently configured codecs of one type
+// get a header each; a codec that isn't comparable is registered as a
+// pointer. It panics when the header or the codec is taken, like
+// database/sql.Register.
+func RegisterCodec(header byte, c Codec) {
+	if c == nil || !reflect.TypeOf(c).Comparable() {
+		panic(fmt.Sprintf("ssdb: codec %T is not comparable, register a pointer to it", c))
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, dup := codecs[header]; dup {
+		panic(fmt.Sprintf("ssdb: codec header 0x%02x registered twice", header))
+	}
+	if old, dup := codecHeader[c]; dup {
+		panic(fmt.Sprintf("ssdb: codec %T already registered under header 0x%02x", c, old))
+	}
+	codecs[header] = c
+	codecHeader[c] = header
+}
+
+// DefaultCodec encodes the values of SetAs, HashSetAs and QueuePushAs, it
+// must be registered.
+var DefaultCodec Codec = JSONCodec{}
+
+// Encode encodes v with c behind the header byte c is registered under.
+func Encode(c Codec, v interface{}) ([]byte, error) {
+	var header byte
+	ok := c != nil && reflect.TypeOf(c).Comparable()
+	if ok {
+		codecsMu.RLock()
+		header, ok = codecHeader[c]
+		codecsMu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("ssdb: codec %T is not registered", c)
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{header}, b...), nil
+}
+
+// Decode decodes data written by Encode into v with the codec its header
+// names, whatever codec wrote it. Plain JSON without a header, as written
+// before codecs were used, is decoded as JSON.
+func Decode(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return fmt.Errorf("ssdb: decode of an empty value")
+	}
+	codecsMu.RLock()
+	c, ok := codecs[data[0]]
+	codecsMu.RUnlock()
+	if ok {
+		return c.Unmarshal(data[1:], v)
+	}
+	if json.Valid(data) {
+		return json.Unmarshal(data, v)
+	}
+	return fmt.Errorf("ssdb: unknown codec header 0x%02x", data[0])
+}
+
+func encodeDefault(v interface{}) (string, error) {
+	b, err := Encode(DefaultCodec, v)
+	return string(b), err
+}
+
+func decodeAs[T any](s string) (T, error) {
+	var v T
+	err := Decode([]byte(s), &v)
+	return v, err
+}
+
+// getValue runs a command answering one value, a missing one is the
+// not_found error.
+func getValue(c *Client, args ...interface{}) (string, error) {
+	resp, err := c.Do(args...)
+	if err == nil && len(resp) > 0 && resp[0] == "not_found" {
+		return "", fmt.Errorf("not_found")
+	}
+	if err := checkResp(fmt.Sprint(args[0]), resp, err); err != nil {
+		return "", err
+	}
+	if len(resp) < 2 {
+		return "", fmt.Errorf("%v: bad response %v", args[0], resp)
+	}
+	return resp[1], nil
+}
+
+// GetAs reads the key set by SetAs and decodes it into a T.
+//
+//	user, err := ssdb.GetAs[User](client, "user:1")
+func GetAs[T any](c *Client, key string) (T, error) {
+	s, err := getValue(c, "get", key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](s)
+}
+
+// SetAs encodes v with DefaultCodec and sets it as the value of key.
+func SetAs[T any](c *Client, key string, v T) error {
+	s, err := encodeDefault(v)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do("set", key, s)
+	return checkResp("set", resp, err)
+}
+
+// SetAsX is SetAs with a TTL in seconds.
+func SetAsX[T any](c *Client, key string, v T, ttl int) error {
+	s, err := encodeDefault(v)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do("setx", key, s, ttl)
+	return checkResp("setx", resp, err)
+}
+
+// HashGetAs reads a hash field set by HashSetAs and decodes it into a T.
+func HashGetAs[T any](c *Client, hash, field string) (T, error) {
+	s, err := getValue(c, "hget", hash, field)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](s)
+}
+
+// HashSetAs encodes v with DefaultCodec and sets it as a hash field.
+func HashSetAs[T any](c *Client, hash, field string, v T) error {
+	s, err := encodeDefault(v)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do("hset", hash, field, s)
+	return checkResp("hset", resp, err)
+}
+
+// QueuePushAs encodes items with DefaultCodec and pushes them to the back
+// of a queue in one command.
+func QueuePushAs[T any](c *Client, queue string, items ...T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	args := []interface{}{"qpush_back", queue}
+	for _, v := range items {
+		s, err := encodeDefault(v)
+		if err != nil {
+			return err
+		}
+		args = append(args, s)
+	}
+	resp, err := c.Do(args...)
+	return checkResp("qpush_back", resp, err)
+}
+
+// QueuePopAs pops up to n items from the front of a queue and decodes them,
+// an empty queue returns no items. Items that fail to decode are popped all
+// the same, the error names the first one.
+func QueuePopAs[T any](c *Client, queue string, n int) ([]T, error) {
+	resp, err := c.Do("qpop_front", queue, n)
+	if err := checkResp("qpop_front", resp, err); err != nil {
+		return nil, err
+	}
+	items := make([]T, 0, len(resp)-1)
+	var first error
+	for i, s := range resp[1:] {
+		v, err := decodeAs[T](s)
+		if err != nil && first == nil {
+			first = fmt.Errorf("item %d: %v", i, err)
+		}
+		items = append(items, v)
+	}
+	return items, first
+}
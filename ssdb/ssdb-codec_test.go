@@ -0,0 +1,157 @@
+package ssdb_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+// tagCodec is JSON behind a tag, two tags are two codecs of one type.
+type tagCodec struct{ tag string }
+
+func (c tagCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := ssdb.JSONCodec{}.Marshal(v)
+	return append([]byte(c.tag), b...), err
+}
+
+func (c tagCodec) Unmarshal(data []byte, v interface{}) error {
+	return ssdb.JSONCodec{}.Unmarshal([]byte(strings.TrimPrefix(string(data), c.tag)), v)
+}
+
+type funcCodec struct {
+	ssdb.JSONCodec
+	hook func()
+}
+
+// registered once per test binary, the registry is global
+var codecA, codecB = tagCodec{"a:"}, tagCodec{"b:"}
+
+func init() {
+	ssdb.RegisterCodec(0x10, codecA)
+	ssdb.RegisterCodec(0x11, codecB)
+}
+
+func TestCodecHeaderPerInstance(t *testing.T) {
+	for _, c := range []struct {
+		codec  ssdb.Codec
+		header byte
+	}{{codecA, 0x10}, {codecB, 0x11}} {
+		data, err := ssdb.Encode(c.codec, "v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != c.header {
+			t.Fatalf("%v encoded under header 0x%02x", c.codec, data[0])
+		}
+		var v string
+		if err := ssdb.Decode(data, &v); err != nil || v != "v" {
+			t.Fatalf("decode %q: %q %v", data, v, err)
+		}
+	}
+	if _, err := ssdb.Encode(tagCodec{"c:"}, "v"); err == nil {
+		t.Fatal("unregistered codec encoded")
+	}
+	if _, err := ssdb.Encode(funcCodec{}, "v"); err == nil {
+		t.Fatal("unregistered codec encoded")
+	}
+}
+
+func TestRegisterCodecNotComparable(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	ssdb.RegisterCodec(0x12, funcCodec{})
+}
+
+type user struct {
+	Name string
+	Tags []string
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	ann, bob := user{"ann", []string{"a"}}, user{Name: "bob"}
+	t.Cleanup(func() { ssdb.DefaultCodec = ssdb.JSONCodec{} })
+
+	// values written with one default codec are read after it changed
+	for i, codec := range []ssdb.Codec{ssdb.JSONCodec{}, ssdb.GobCodec{}, codecA} {
+		ssdb.DefaultCodec = codec
+		if err := ssdb.SetAs(c, "k", ann); err != nil {
+			t.Fatal(err)
+		}
+		if err := ssdb.HashSetAs(c, "h", "f", ann); err != nil {
+			t.Fatal(err)
+		}
+		if err := ssdb.QueuePushAs(c, "q", ann, bob); err != nil {
+			t.Fatal(err)
+		}
+		ssdb.DefaultCodec = ssdb.JSONCodec{}
+		if raw := s.Exec([]string{"get", "k"})[1]; raw[0] != []byte{ssdb.HeaderJSON, ssdb.HeaderGob, 0x10}[i] {
+			t.Fatalf("%T: stored %q", codec, raw)
+		}
+
+		if v, err := ssdb.GetAs[user](c, "k"); err != nil || !reflect.DeepEqual(v, ann) {
+			t.Fatalf("%T: get %+v %v", codec, v, err)
+		}
+		if v, err := ssdb.HashGetAs[user](c, "h", "f"); err != nil || !reflect.DeepEqual(v, ann) {
+			t.Fatalf("%T: hget %+v %v", codec, v, err)
+		}
+		if v, err := ssdb.QueuePopAs[user](c, "q", 5); err != nil || !reflect.DeepEqual(v, []user{ann, bob}) {
+			t.Fatalf("%T: pop %+v %v", codec, v, err)
+		}
+	}
+
+	if _, err := ssdb.GetAs[user](c, "missing"); err == nil || err.Error() != "not_found" {
+		t.Fatalf("get of a missing key: %v", err)
+	}
+	if _, err := ssdb.HashGetAs[user](c, "h", "missing"); err == nil || err.Error() != "not_found" {
+		t.Fatalf("hget of a missing field: %v", err)
+	}
+	if v, err := ssdb.QueuePopAs[user](c, "q", 5); err != nil || len(v) != 0 {
+		t.Fatalf("pop of an empty queue: %+v %v", v, err)
+	}
+}
+
+func TestCodecLegacyAndUnknown(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+
+	// plain JSON written before the headers
+	exec(t, s, []string{"set", "k", `{"Name":"ann"}`}, []string{"set", "n", "42"}, []string{"set", "s", `"x"`})
+	if v, err := ssdb.GetAs[user](c, "k"); err != nil || v.Name != "ann" {
+		t.Fatalf("legacy object %+v %v", v, err)
+	}
+	if v, err := ssdb.GetAs[int](c, "n"); err != nil || v != 42 {
+		t.Fatalf("legacy number %v %v", v, err)
+	}
+	if v, err := ssdb.GetAs[string](c, "s"); err != nil || v != "x" {
+		t.Fatalf("legacy string %q %v", v, err)
+	}
+
+	// neither a registered header nor JSON
+	exec(t, s, []string{"set", "k", "\x7fdata"}, []string{"set", "e", ""})
+	if _, err := ssdb.GetAs[user](c, "k"); err == nil || !strings.Contains(err.Error(), "unknown codec header 0x7f") {
+		t.Fatalf("unknown header: %v", err)
+	}
+	if _, err := ssdb.GetAs[user](c, "e"); err == nil {
+		t.Fatal("decode of an empty value")
+	}
+
+	// a bad item is popped and named, the others are decoded
+	exec(t, s, []string{"qpush_back", "q", `{"Name":"a"}`, "\x7f", `{"Name":"b"}`})
+	v, err := ssdb.QueuePopAs[user](c, "q", 5)
+	if err == nil || !strings.HasPrefix(err.Error(), "item 1:") || len(v) != 3 || v[2].Name != "b" {
+		t.Fatalf("pop with a bad item %+v %v", v, err)
+	}
+	if size := s.Exec([]string{"qsize", "q"}); size[1] != "0" {
+		t.Fatalf("bad item left in the queue: %v", size)
+	}
+}
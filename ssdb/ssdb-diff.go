@@ -0,0 +1,576 @@
+package ssdb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Diff compares the keys, hashes, zsets and queues in a range on two
+// servers. Both keyspaces are walked in key order with range scans and the
+// pages of both sides cover the same range. SSDB has no server-side digest,
+// so every page of both sides is transferred; the client digests them and
+// only merges the pages whose digests differ entry by entry.
+//
+// Differences are reported as mismatches: "missing" from the destination,
+// "extra" in the destination or "differs". A hash or zset missing or extra
+// as a whole is one mismatch without a Field. With Repair the destination
+// is changed to the source version of everything that differs.
+type Diff struct {
+	Range         KeyRange
+	Types         []DataType // nil compares every type
+	Page          int        // items per request, default 1000
+	Repair        bool
+	MaxMismatches int // mismatches kept in the report, default 1000
+
+	src, dst *Client
+	start    time.Time
+
+	// updated atomically, Stats reads them
+	names, pages, equal, mismatched, repaired int64
+
+	mu         sync.Mutex
+	mismatches []Mismatch
+}
+
+// DiffStats counts the progress of a Diff.
+type DiffStats struct {
+	Names      int64 // keys, hashes, zsets and queues compared
+	Pages      int64 // pages compared
+	PagesEqual int64 // pages with the same digest on both sides
+	Mismatched int64
+	Repaired   int64 // keys, fields, members and containers written
+	Elapsed    time.Duration
+}
+
+// DiffReport is the outcome of a Diff.
+type DiffReport struct {
+	DiffStats
+	Mismatches []Mismatch // the first MaxMismatches
+}
+
+// NewDiff compares src, the reference, with dst.
+func NewDiff(src, dst *Client) *Diff {
+	return &Diff{src: src, dst: dst}
+}
+
+// Stats returns the progress so far, it can be called while Run runs.
+func (d *Diff) Stats() DiffStats {
+	return DiffStats{
+		Names:      atomic.LoadInt64(&d.names),
+		Pages:      atomic.LoadInt64(&d.pages),
+		PagesEqual: atomic.LoadInt64(&d.equal),
+		Mismatched: atomic.LoadInt64(&d.mismatched),
+		Repaired:   atomic.LoadInt64(&d.repaired),
+		Elapsed:    time.Since(d.start),
+	}
+}
+
+// Run compares the range and returns the report. On error it stops and
+// returns the report of what was compared so far.
+func (d *Diff) Run(ctx context.Context) (*DiffReport, error) {
+	if d.Page <= 0 {
+		d.Page = scanPage
+	}
+	if d.MaxMismatches <= 0 {
+		d.MaxMismatches = 1000
+	}
+	types := d.Types
+	if types == nil {
+		types = DataTypes
+	}
+	d.start = time.Now()
+	var err error
+	for _, t := range types {
+		if err = d.diff(ctx, t); err != nil {
+			err = fmt.Errorf("diff %s: %v", t, err)
+			break
+		}
+	}
+	d.mu.Lock()
+	report := &DiffReport{DiffStats: d.Stats(), Mismatches: d.mismatches}
+	d.mu.Unlock()
+	return report, err
+}
+
+func (d *Diff) mismatch(mm Mismatch) {
+	atomic.AddInt64(&d.mismatched, 1)
+	d.mu.Lock()
+	if len(d.mismatches) < d.MaxMismatches {
+		d.mismatches = append(d.mismatches, mm)
+	}
+	d.mu.Unlock()
+}
+
+// walkEntry is an item of an ordered walk, pos is its place in the order.
+type walkEntry struct {
+	pos   string
+	field string // the key, name, field or member
+	value string
+}
+
+// lister returns up to limit entries after start, up to end when set.
+type lister func(start, end string, limit int) ([]walkEntry, error)
+
+// alignedWalk pages two listers over the same ranges, calling fn with the
+// entries of both sides between the same bounds.
+func alignedWalk(ctx context.Context, src, dst lister, start, end string, page int, fn func(a, b []walkEntry) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a, err := src(start, end, page)
+		if err != nil {
+			return err
+		}
+		bound := end
+		if len(a) == page {
+			bound = a[len(a)-1].pos
+		}
+		b, err := dst(start, bound, page)
+		if err != nil {
+			return err
+		}
+		more := len(a) == page || len(b) == page
+		if len(b) == page && (bound == "" || b[len(b)-1].pos < bound) {
+			bound = b[len(b)-1].pos
+			for len(a) > 0 && a[len(a)-1].pos > bound {
+				a = a[:len(a)-1]
+			}
+		}
+		if len(a) > 0 || len(b) > 0 {
+			if err := fn(a, b); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		start = bound
+	}
+}
+
+// trimEnd drops the entries after end.
+func trimEnd(entries []walkEntry, end string) []walkEntry {
+	for end != "" && len(entries) > 0 && entries[len(entries)-1].pos > end {
+		entries = entries[:len(entries)-1]
+	}
+	return entries
+}
+
+// scanLister lists a "cmd [name] start end limit" command whose responses
+// have width values per entry.
+func scanLister(c *Client, width int, cmd ...interface{}) lister {
+	return func(start, end string, limit int) ([]walkEntry, error) {
+		args := append(cmd[:len(cmd):len(cmd)], start, end, limit)
+		resp, err := c.Do(args...)
+		if err := checkResp(fmt.Sprint(cmd[0]), resp, err); err != nil {
+			return nil, err
+		}
+		entries := make([]walkEntry, 0, len(resp)/width)
+		for i := 1; i+width-1 < len(resp); i += width {
+			e := walkEntry{pos: resp[i], field: resp[i]}
+			if width == 2 {
+				e.value = resp[i+1]
+			}
+			entries = append(entries, e)
+		}
+		return trimEnd(entries, end), nil
+	}
+}
+
+// zsetPos orders zset members by score then member as strings.
+func zsetPos(score int64, member string) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(score)^1<<63)
+	return string(b[:]) + member
+}
+
+func parseZsetPos(pos string) (int64, string) {
+	return int64(binary.BigEndian.Uint64([]byte(pos[:8])) ^ 1<<63), pos[8:]
+}
+
+func zsetLister(c *Client, name string) lister {
+	return func(start, end string, limit int) ([]walkEntry, error) {
+		key, score, scoreEnd := "", "", ""
+		if start != "" {
+			s, m := parseZsetPos(start)
+			key, score = m, strconv.FormatInt(s, 10)
+		}
+		if end != "" {
+			s, _ := parseZsetPos(end)
+			scoreEnd = strconv.FormatInt(s, 10)
+		}
+		resp, err := c.Do("zscan", name, key, score, scoreEnd, limit)
+		if err := checkResp("zscan", resp, err); err != nil {
+			return nil, err
+		}
+		entries := make([]walkEntry, 0, len(resp)/2)
+		for i := 1; i+1 < len(resp); i += 2 {
+			s, err := strconv.ParseInt(resp[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("zscan %s: bad score %q", name, resp[i+1])
+			}
+			entries = append(entries, walkEntry{pos: zsetPos(s, resp[i]), field: resp[i], value: resp[i+1]})
+		}
+		return trimEnd(entries, end), nil
+	}
+}
+
+// bounds returns the scan start and end of the range.
+func (r KeyRange) bounds() (start, end string) {
+	start = prefixStart(r.Prefix)
+	if r.Start > start {
+		start = r.Start
+	}
+	end = r.End
+	// every name with the prefix comes before its successor
+	p := []byte(r.Prefix)
+	for len(p) > 0 && p[len(p)-1] == 0xff {
+		p = p[:len(p)-1]
+	}
+	if len(p) > 0 {
+		p[len(p)-1]++
+		if succ := string(p); end == "" || succ < end {
+			end = succ
+		}
+	}
+	return start, end
+}
+
+func (d *Diff) filter(t DataType, entries []walkEntry) []walkEntry {
+	out := entries[:0:0]
+	for _, e := range entries {
+		if d.Range.Match(e.field) && !(t == TypeZset && e.field == ExpireList) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// digest hashes the fields and values of a page.
+func digest(entries []walkEntry) uint64 {
+	h := fnv.New64a()
+	var n [8]byte
+	for _, e := range entries {
+		for _, s := range []string{e.field, e.value} {
+			binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+			h.Write(n[:])
+			h.Write([]byte(s))
+		}
+	}
+	return h.Sum64()
+}
+
+// comparePages merges two pages in order, calling fn with the entries of
+// either side, nil for the side that lacks it, when they differ.
+func (d *Diff) comparePages(a, b []walkEntry, fn func(src, dst *walkEntry) error) error {
+	atomic.AddInt64(&d.pages, 1)
+	if len(a) == len(b) && digest(a) == digest(b) {
+		atomic.AddInt64(&d.equal, 1)
+		return nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var err error
+		switch {
+		case j == len(b) || (i < len(a) && a[i].pos < b[j].pos):
+			err = fn(&a[i], nil)
+			i++
+		case i == len(a) || b[j].pos < a[i].pos:
+			err = fn(nil, &b[j])
+			j++
+		default:
+			if a[i].value != b[j].value {
+				err = fn(&a[i], &b[j])
+			}
+			i++
+			j++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newMismatch(t DataType, key, field string, src, dst *walkEntry) Mismatch {
+	mm := Mismatch{Type: t, Key: key, Field: field, Reason: "differs"}
+	if src == nil {
+		mm.Reason = "extra"
+	} else {
+		mm.Source = src.value
+	}
+	if dst == nil {
+		mm.Reason = "missing"
+	} else {
+		mm.Dest = dst.value
+	}
+	return mm
+}
+
+func (d *Diff) diff(ctx context.Context, t DataType) error {
+	start, end := d.Range.bounds()
+	if t == TypeKV {
+		return alignedWalk(ctx, scanLister(d.src, 2, "scan"), scanLister(d.dst, 2, "scan"), start, end, d.Page, func(a, b []walkEntry) error {
+			a, b = d.filter(t, a), d.filter(t, b)
+			atomic.AddInt64(&d.names, int64(len(a)))
+			var set []KeyValue
+			var del []string
+			err := d.comparePages(a, b, func(src, dst *walkEntry) error {
+				if src != nil {
+					d.mismatch(newMismatch(t, src.field, "", src, dst))
+					set = append(set, KeyValue{src.field, src.value})
+				} else {
+					d.mismatch(newMismatch(t, dst.field, "", src, dst))
+					del = append(del, dst.field)
+				}
+				return nil
+			})
+			if err != nil || !d.Repair {
+				return err
+			}
+			return d.repairKV(set, del)
+		})
+	}
+	cmd := listCommands[t]
+	return alignedWalk(ctx, scanLister(d.src, 1, cmd), scanLister(d.dst, 1, cmd), start, end, d.Page, func(a, b []walkEntry) error {
+		a, b = d.filter(t, a), d.filter(t, b)
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			var err error
+			switch {
+			case j == len(b) || (i < len(a) && a[i].pos < b[j].pos):
+				err = d.container(ctx, t, a[i].field, true, false)
+				i++
+			case i == len(a) || b[j].pos < a[i].pos:
+				err = d.container(ctx, t, b[j].field, false, true)
+				j++
+			default:
+				err = d.container(ctx, t, a[i].field, true, true)
+				i++
+				j++
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// repairKV writes the source version of the keys in set, with their TTL,
+// and deletes the keys only the destination has.
+func (d *Diff) repairKV(set []KeyValue, del []string) error {
+	keys := make([]string, len(set))
+	for i, kv := range set {
+		keys[i] = kv.Key
+	}
+	ttls, err := d.src.TTLs(keys)
+	if err != nil {
+		return err
+	}
+	var cmds [][]interface{}
+	for i, kv := range set {
+		if ttls[i] > 0 {
+			cmds = append(cmds, []interface{}{"setx", kv.Key, kv.Value, ttls[i]})
+		} else {
+			cmds = append(cmds, []interface{}{"set", kv.Key, kv.Value})
+		}
+	}
+	for _, k := range del {
+		cmds = append(cmds, []interface{}{"del", k})
+	}
+	return d.apply(cmds)
+}
+
+// apply runs repair commands on the destination.
+func (d *Diff) apply(cmds [][]interface{}) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	if err := pipeline(d.dst, cmds); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.repaired, int64(len(cmds)))
+	return nil
+}
+
+// copyContainer replaces a destination container with the source one.
+func (d *Diff) copyContainer(ctx context.Context, t DataType, name string) error {
+	m := &Migration{Page: d.Page, MaxMismatches: d.MaxMismatches}
+	var err error
+	switch t {
+	case TypeHash:
+		if err = d.apply([][]interface{}{{"hclear", name}}); err == nil {
+			err = m.migrateHash(ctx, d.src, d.dst, name)
+		}
+	case TypeZset:
+		if err = d.apply([][]interface{}{{"zclear", name}}); err == nil {
+			err = m.migrateZset(ctx, d.src, d.dst, name)
+		}
+	default:
+		err = m.migrateQueue(ctx, d.src, d.dst, name)
+		atomic.AddInt64(&d.repaired, 1)
+	}
+	// what still differs after the copy
+	for _, mm := range m.mismatches {
+		d.mismatch(mm)
+	}
+	return err
+}
+
+var clearCommands = map[DataType]string{
+	TypeHash: "hclear", TypeZset: "zclear", TypeQueue: "qclear",
+}
+
+// container compares a hash, zset or queue found on either side.
+func (d *Diff) container(ctx context.Context, t DataType, name string, inSrc, inDst bool) error {
+	atomic.AddInt64(&d.names, 1)
+	if !inDst {
+		d.mismatch(Mismatch{Type: t, Key: name, Reason: "missing"})
+		if d.Repair {
+			return d.copyContainer(ctx, t, name)
+		}
+		return nil
+	}
+	if !inSrc {
+		d.mismatch(Mismatch{Type: t, Key: name, Reason: "extra"})
+		if d.Repair {
+			return d.apply([][]interface{}{{clearCommands[t], name}})
+		}
+		return nil
+	}
+	if t == TypeQueue {
+		return d.diffQueue(ctx, name)
+	}
+	src, dst := scanLister(d.src, 2, "hscan", name), scanLister(d.dst, 2, "hscan", name)
+	set, del := "hset", "hdel"
+	if t == TypeZset {
+		src, dst = zsetLister(d.src, name), zsetLister(d.dst, name)
+		set, del = "zset", "zdel"
+	}
+	err := alignedWalk(ctx, src, dst, "", "", d.Page, func(a, b []walkEntry) error {
+		var srcOnly, dstOnly []*walkEntry
+		var cmds [][]interface{}
+		err := d.comparePages(a, b, func(src, dst *walkEntry) error {
+			switch {
+			case dst == nil:
+				srcOnly = append(srcOnly, src)
+			case src == nil:
+				dstOnly = append(dstOnly, dst)
+			default:
+				d.mismatch(newMismatch(t, name, src.field, src, dst))
+				cmds = append(cmds, []interface{}{set, name, src.field, src.value})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// a zset member with another score is at another place on each side
+		var srcScores, dstScores map[string]string
+		if t == TypeZset {
+			if dstScores, err = d.zsetScores(d.dst, name, srcOnly); err != nil {
+				return err
+			}
+			if srcScores, err = d.zsetScores(d.src, name, dstOnly); err != nil {
+				return err
+			}
+		}
+		for _, e := range srcOnly {
+			if score, ok := dstScores[e.field]; ok {
+				d.mismatch(newMismatch(t, name, e.field, e, &walkEntry{value: score}))
+			} else {
+				d.mismatch(newMismatch(t, name, e.field, e, nil))
+			}
+			cmds = append(cmds, []interface{}{set, name, e.field, e.value})
+		}
+		for _, e := range dstOnly {
+			if _, ok := srcScores[e.field]; !ok {
+				d.mismatch(newMismatch(t, name, e.field, nil, e))
+				cmds = append(cmds, []interface{}{del, name, e.field})
+			}
+		}
+		if !d.Repair {
+			return nil
+		}
+		return d.apply(cmds)
+	})
+	if err != nil {
+		return fmt.Errorf("%q: %v", name, err)
+	}
+	return nil
+}
+
+// zsetScores returns the scores c has for the members of entries.
+func (d *Diff) zsetScores(c *Client, name string, entries []*walkEntry) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{name}
+	for _, e := range entries {
+		args = append(args, e.field)
+	}
+	return multiGet(c, "multi_zget", args)
+}
+
+// queuePositions returns a page of queue items as entries ordered by position.
+func queuePositions(c *Client, name string, offset int64, limit int) ([]walkEntry, error) {
+	resp, err := c.Do("qrange", name, offset, limit)
+	if err := checkResp("qrange", resp, err); err != nil {
+		return nil, err
+	}
+	entries := make([]walkEntry, len(resp)-1)
+	for i, item := range resp[1:] {
+		n := offset + int64(i)
+		entries[i] = walkEntry{pos: fmt.Sprintf("%020d", n), field: strconv.FormatInt(n, 10), value: item}
+	}
+	return entries, nil
+}
+
+// diffQueue compares two queues item by item from the front, a queue that
+// differs is repaired by copying it whole.
+func (d *Diff) diffQueue(ctx context.Context, name string) error {
+	differs := false
+	for offset := int64(0); ; offset += int64(d.Page) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a, err := queuePositions(d.src, name, offset, d.Page)
+		if err != nil {
+			return err
+		}
+		b, err := queuePositions(d.dst, name, offset, d.Page)
+		if err != nil {
+			return err
+		}
+		if len(a) == 0 && len(b) == 0 {
+			break
+		}
+		err = d.comparePages(a, b, func(src, dst *walkEntry) error {
+			e := src
+			if e == nil {
+				e = dst
+			}
+			d.mismatch(newMismatch(TypeQueue, name, e.field, src, dst))
+			differs = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(a) < d.Page && len(b) < d.Page {
+			break
+		}
+	}
+	if differs && d.Repair {
+		return d.copyContainer(ctx, TypeQueue, name)
+	}
+	return nil
+}
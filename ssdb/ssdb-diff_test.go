@@ -0,0 +1,103 @@
+package ssdb_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func exec(t *testing.T, s *ssdbtest.Server, cmds ...[]string) {
+	t.Helper()
+	for _, cmd := range cmds {
+		if resp := s.Exec(cmd); resp[0] != "ok" {
+			t.Fatalf("%v: %v", cmd, resp)
+		}
+	}
+}
+
+func mismatches(r *ssdb.DiffReport) []string {
+	var list []string
+	for _, mm := range r.Mismatches {
+		list = append(list, fmt.Sprintf("%s %s %s %s %q %q", mm.Type, mm.Key, mm.Field, mm.Reason, mm.Source, mm.Dest))
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestDiff(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	exec(t, src,
+		[]string{"set", "a", "1"}, []string{"set", "b", "2"}, []string{"setx", "c", "3", "100"}, []string{"set", "d", "4"},
+		[]string{"hset", "h1", "f1", "1"}, []string{"hset", "h1", "f2", "2"}, []string{"hset", "h1", "f3", "3"},
+		[]string{"hset", "h2", "f", "1"},
+		[]string{"zset", "z1", "m1", "1"}, []string{"zset", "z1", "m2", "2"}, []string{"zset", "z1", "m3", "3"},
+		[]string{"qpush_back", "q1", "x", "y", "z"},
+	)
+	exec(t, dst,
+		[]string{"set", "a", "1"}, []string{"set", "b", "X"}, []string{"set", "d", "4"}, []string{"set", "e", "5"},
+		[]string{"hset", "h1", "f1", "1"}, []string{"hset", "h1", "f2", "X"}, []string{"hset", "h1", "f4", "4"},
+		[]string{"hset", "h3", "f", "1"},
+		[]string{"zset", "z1", "m1", "1"}, []string{"zset", "z1", "m2", "5"}, []string{"zset", "z1", "m4", "4"},
+		[]string{"qpush_back", "q1", "x", "Y"}, []string{"qpush_back", "q2", "x"},
+	)
+	c, d := connect(t, src), connect(t, dst)
+
+	diff := ssdb.NewDiff(c, d)
+	diff.Page = 2
+	r, err := diff.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`hash h1 f2 differs "2" "X"`,
+		`hash h1 f3 missing "3" ""`,
+		`hash h1 f4 extra "" "4"`,
+		`hash h2  missing "" ""`,
+		`hash h3  extra "" ""`,
+		`kv b  differs "2" "X"`,
+		`kv c  missing "3" ""`,
+		`kv e  extra "" "5"`,
+		`queue q1 1 differs "y" "Y"`,
+		`queue q1 2 missing "z" ""`,
+		`queue q2  extra "" ""`,
+		`zset z1 m2 differs "2" "5"`,
+		`zset z1 m3 missing "3" ""`,
+		`zset z1 m4 extra "" "4"`,
+	}
+	if got := mismatches(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatches\n%v\nwant\n%v", got, want)
+	}
+	if r.Mismatched != int64(len(want)) || r.Names == 0 || r.Pages == 0 || r.Repaired != 0 {
+		t.Fatalf("stats %+v", r.DiffStats)
+	}
+
+	// MaxMismatches limits what is kept, not what is counted
+	diff = ssdb.NewDiff(c, d)
+	diff.Types = []ssdb.DataType{ssdb.TypeKV}
+	diff.MaxMismatches = 1
+	if r, err = diff.Run(context.Background()); err != nil || len(r.Mismatches) != 1 || r.Mismatched != 3 {
+		t.Fatalf("kv only, one kept: %v %+v", err, r)
+	}
+
+	diff = ssdb.NewDiff(c, d)
+	diff.Page = 2
+	diff.Repair = true
+	if r, err = diff.Run(context.Background()); err != nil || r.Repaired == 0 {
+		t.Fatalf("repair %v %+v", err, r)
+	}
+	diff = ssdb.NewDiff(c, d)
+	diff.Page = 2
+	if r, err = diff.Run(context.Background()); err != nil || len(r.Mismatches) != 0 {
+		t.Fatalf("after the repair %v %v", err, mismatches(r))
+	}
+	if resp := dst.Exec([]string{"ttl", "c"}); resp[1] == "-1" {
+		t.Fatalf("repaired key lost its ttl: %v", resp)
+	}
+}
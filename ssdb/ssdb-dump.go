@@ -0,0 +1,248 @@
+package ssdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The dump format is gzip compressed text, one record per line:
+//
+//	#SSDBDUMP 1 <created unix time> <source>
+//	kv <key> <value> <expire unix time, 0 for none>
+//	hash <name> <field> <value>
+//	zset <name> <member> <score>
+//	queue <name> <position> <item>
+//	#END <records> <crc32 of the record lines>
+//
+// Fields are separated by one space. Bytes outside printable ASCII, the
+// space and % are written as %XX, so any binary key or value survives.
+const dumpVersion = 1
+
+// ErrDumpCorrupt is returned by DumpReader when the trailer is missing or
+// the checksum or record count doesn't match.
+var ErrDumpCorrupt = errors.New("dump is truncated or corrupt")
+
+// DumpRecord is an item of a dump: a key, a hash field, a zset member or a
+// queue item.
+type DumpRecord struct {
+	Type     DataType
+	Key      string // the key, or the name of the hash, zset or queue
+	Field    string // hash field or zset member
+	Value    string // key value, hash value or queue item
+	Score    int64  // zset score
+	Position int64  // queue position, 0 is the front
+	ExpireAt int64  // unix time a key expires, 0 when it doesn't
+}
+
+func escapeField(s string) string {
+	clean := true
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f || c == '%' {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeField(s string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("bad escape in %q", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad escape in %q", s)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// DumpWriter writes records in the dump format.
+type DumpWriter struct {
+	zw      *gzip.Writer
+	w       *bufio.Writer
+	crc     hash.Hash32
+	records int64
+}
+
+// NewDumpWriter writes the header, source describes where the data comes from.
+func NewDumpWriter(w io.Writer, source string) (*DumpWriter, error) {
+	zw := gzip.NewWriter(w)
+	d := &DumpWriter{zw: zw, w: bufio.NewWriter(zw), crc: crc32.NewIEEE()}
+	if source == "" {
+		source = "-"
+	}
+	_, err := fmt.Fprintf(d.w, "#SSDBDUMP %d %d %s\n", dumpVersion, time.Now().Unix(), escapeField(source))
+	return d, err
+}
+
+func (d *DumpWriter) Write(r DumpRecord) error {
+	var line string
+	switch r.Type {
+	case TypeKV:
+		line = fmt.Sprintf("kv %s %s %d\n", escapeField(r.Key), escapeField(r.Value), r.ExpireAt)
+	case TypeHash:
+		line = fmt.Sprintf("hash %s %s %s\n", escapeField(r.Key), escapeField(r.Field), escapeField(r.Value))
+	case TypeZset:
+		line = fmt.Sprintf("zset %s %s %d\n", escapeField(r.Key), escapeField(r.Field), r.Score)
+	case TypeQueue:
+		line = fmt.Sprintf("queue %s %d %s\n", escapeField(r.Key), r.Position, escapeField(r.Value))
+	default:
+		return fmt.Errorf("dump: unknown data type %q", r.Type)
+	}
+	d.crc.Write([]byte(line))
+	d.records++
+	_, err := d.w.WriteString(line)
+	return err
+}
+
+// Records returns the number of records written.
+func (d *DumpWriter) Records() int64 {
+	return d.records
+}
+
+// Close writes the trailer and flushes the compressed stream, it doesn't
+// close the underlying writer.
+func (d *DumpWriter) Close() error {
+	if _, err := fmt.Fprintf(d.w, "#END %d %08x\n", d.records, d.crc.Sum32()); err != nil {
+		return err
+	}
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return d.zw.Close()
+}
+
+// DumpReader reads records written by DumpWriter.
+type DumpReader struct {
+	Created time.Time
+	Source  string
+
+	r       *bufio.Reader
+	crc     hash.Hash32
+	records int64
+	done    bool
+}
+
+func NewDumpReader(r io.Reader) (*DumpReader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("dump: %v", err)
+	}
+	d := &DumpReader{r: bufio.NewReaderSize(zr, 64*1024), crc: crc32.NewIEEE()}
+	line, err := d.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("dump: no header: %v", err)
+	}
+	f := strings.Fields(line)
+	if len(f) != 4 || f[0] != "#SSDBDUMP" {
+		return nil, fmt.Errorf("dump: not an ssdb dump")
+	}
+	if f[1] != strconv.Itoa(dumpVersion) {
+		return nil, fmt.Errorf("dump: unsupported version %s", f[1])
+	}
+	created, _ := strconv.ParseInt(f[2], 10, 64)
+	d.Created = time.Unix(created, 0)
+	d.Source, _ = unescapeField(f[3])
+	return d, nil
+}
+
+// Records returns the number of records read.
+func (d *DumpReader) Records() int64 {
+	return d.records
+}
+
+// Next returns the next record. At the end it checks the trailer and
+// returns io.EOF, or ErrDumpCorrupt when the dump doesn't check out.
+func (d *DumpReader) Next() (DumpRecord, error) {
+	if d.done {
+		return DumpRecord{}, io.EOF
+	}
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return DumpRecord{}, ErrDumpCorrupt
+	}
+	if err != nil {
+		return DumpRecord{}, err
+	}
+	if strings.HasPrefix(line, "#END ") {
+		d.done = true
+		f := strings.Fields(line)
+		if len(f) != 3 || f[1] != strconv.FormatInt(d.records, 10) || f[2] != fmt.Sprintf("%08x", d.crc.Sum32()) {
+			return DumpRecord{}, ErrDumpCorrupt
+		}
+		return DumpRecord{}, io.EOF
+	}
+	d.crc.Write([]byte(line))
+	d.records++
+	r, err := parseDumpLine(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		return r, fmt.Errorf("dump record %d: %v", d.records, err)
+	}
+	return r, nil
+}
+
+func parseDumpLine(line string) (DumpRecord, error) {
+	var r DumpRecord
+	f := strings.Split(line, " ")
+	if len(f) != 4 {
+		return r, fmt.Errorf("want 4 fields, got %d", len(f))
+	}
+	r.Type = DataType(f[0])
+	var err error
+	if r.Key, err = unescapeField(f[1]); err != nil {
+		return r, err
+	}
+	switch r.Type {
+	case TypeKV:
+		if r.Value, err = unescapeField(f[2]); err == nil {
+			r.ExpireAt, err = strconv.ParseInt(f[3], 10, 64)
+		}
+	case TypeHash:
+		if r.Field, err = unescapeField(f[2]); err == nil {
+			r.Value, err = unescapeField(f[3])
+		}
+	case TypeZset:
+		if r.Field, err = unescapeField(f[2]); err == nil {
+			r.Score, err = strconv.ParseInt(f[3], 10, 64)
+		}
+	case TypeQueue:
+		if r.Position, err = strconv.ParseInt(f[2], 10, 64); err == nil {
+			r.Value, err = unescapeField(f[3])
+		}
+	default:
+		return r, fmt.Errorf("unknown type %q", f[0])
+	}
+	return r, err
+}
@@ -0,0 +1,143 @@
+package ssdb_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+var dumpRecords = []ssdb.DumpRecord{
+	{Type: ssdb.TypeKV, Key: "a", Value: "1"},
+	{Type: ssdb.TypeKV, Key: "with space", Value: "100%\n\x00\xff", ExpireAt: 1700000000},
+	{Type: ssdb.TypeKV, Key: "empty", Value: ""},
+	{Type: ssdb.TypeHash, Key: "h", Field: "f %20", Value: "v\tv"},
+	{Type: ssdb.TypeZset, Key: "z", Field: "m", Score: -42},
+	{Type: ssdb.TypeQueue, Key: "q", Position: 0, Value: "first"},
+	{Type: ssdb.TypeQueue, Key: "q", Position: 1, Value: "ünïcode"},
+}
+
+func writeDump(t *testing.T, records []ssdb.DumpRecord) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := ssdb.NewDumpWriter(&b, "src host:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func readDump(data []byte) ([]ssdb.DumpRecord, error) {
+	r, err := ssdb.NewDumpReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var list []ssdb.DumpRecord
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return list, err
+		}
+		list = append(list, rec)
+	}
+}
+
+// rewrite decompresses a dump, lets edit change the text and compresses it again.
+func rewrite(t *testing.T, data []byte, edit func(text string) string) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(edit(string(text))))
+	zw.Close()
+	return b.Bytes()
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	data := writeDump(t, dumpRecords)
+	r, err := ssdb.NewDumpReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Source != "src host:1" || r.Created.IsZero() {
+		t.Fatalf("header %q %v", r.Source, r.Created)
+	}
+	got, err := readDump(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, dumpRecords) {
+		t.Fatalf("read back\n%+v\nwant\n%+v", got, dumpRecords)
+	}
+
+	// one record per line, escaped fields never contain the separator
+	rewrite(t, data, func(text string) string {
+		lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		if len(lines) != len(dumpRecords)+2 {
+			t.Fatalf("%d lines for %d records", len(lines), len(dumpRecords))
+		}
+		if want := "kv with%20space 100%25%0A%00%FF 1700000000"; lines[2] != want {
+			t.Fatalf("escaped line %q, want %q", lines[2], want)
+		}
+		return text
+	})
+}
+
+func TestDumpCorrupt(t *testing.T) {
+	data := writeDump(t, dumpRecords)
+	for _, c := range []struct {
+		name string
+		data []byte
+		want error // nil for any error
+	}{
+		{"no trailer", rewrite(t, data, func(s string) string { return s[:strings.Index(s, "#END")] }), ssdb.ErrDumpCorrupt},
+		{"changed record", rewrite(t, data, func(s string) string { return strings.Replace(s, "kv a 1", "kv a 2", 1) }), ssdb.ErrDumpCorrupt},
+		{"dropped record", rewrite(t, data, func(s string) string { return strings.Replace(s, "kv a 1 0\n", "", 1) }), ssdb.ErrDumpCorrupt},
+		{"bad count", rewrite(t, data, func(s string) string { return strings.Replace(s, "#END 7", "#END 8", 1) }), ssdb.ErrDumpCorrupt},
+		{"cut line", rewrite(t, data, func(s string) string { return s[:strings.Index(s, "hash")+6] }), ssdb.ErrDumpCorrupt},
+		{"bad escape", rewrite(t, data, func(s string) string { return strings.Replace(s, "kv a 1", "kv %zz 1", 1) }), nil},
+		{"unknown type", rewrite(t, data, func(s string) string { return strings.Replace(s, "kv a 1", "set a 1", 1) }), nil},
+		{"truncated stream", data[:len(data)/2], nil},
+	} {
+		got, err := readDump(c.data)
+		if err == nil || (c.want != nil && err != c.want) {
+			t.Errorf("%s: %v after %d records, want %v", c.name, err, len(got), c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"not gzip", []byte("#SSDBDUMP 1 0 -\n")},
+		{"no header", rewrite(t, data, func(s string) string { return s[strings.Index(s, "\n")+1:] })},
+		{"other version", rewrite(t, data, func(s string) string { return strings.Replace(s, "#SSDBDUMP 1", "#SSDBDUMP 2", 1) })},
+	} {
+		if _, err := ssdb.NewDumpReader(bytes.NewReader(c.data)); err == nil {
+			t.Errorf("%s: opened", c.name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package ssdb
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientState is reported to the state change callback.
+type ClientState int
+
+const (
+	StateConnected    ClientState = iota
+	StateDisconnected             // connection lost, RetryConnect started
+	StateFailover                 // switched to the next endpoint
+	StateFailback                 // switched back to the preferred endpoint
+	StateClosed
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateFailover:
+		return "failover"
+	case StateFailback:
+		return "failback"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// StateChange describes a connection state change of a Client.
+type StateChange struct {
+	ClientId string
+	State    ClientState
+	Addr     string // active endpoint after the change
+	Endpoint int    // index of the active endpoint
+	Err      error  // error that caused a failover
+}
+
+// OnStateChange sets a callback for connection state changes, it must not block.
+func (c *Client) OnStateChange(fn func(StateChange)) {
+	c.mu.Lock()
+	c.onStateChange = fn
+	c.mu.Unlock()
+}
+
+func (c *Client) stateChanged(state ClientState, err error) {
+	c.mu.Lock()
+	fn := c.onStateChange
+	change := StateChange{
+		ClientId: c.Id,
+		State:    state,
+		Addr:     fmt.Sprintf("%s:%d", c.Ip, c.Port),
+		Endpoint: c.active,
+		Err:      err,
+	}
+	c.mu.Unlock()
+	if fn != nil {
+		fn(change)
+	}
+}
+
+// ConnectFailover connects to the first reachable endpoint of an ordered list.
+// When the active endpoint is lost RetryConnect moves on to the next one, and
+// every failback interval the preferred (first) endpoint is probed and the
+// client switches back to it once it answers. A failback of 0 disables probing.
+func ConnectFailover(endpoints []Node, failback time.Duration) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints")
+	}
+	log.Printf("SSDB Client Version:%s\n", version)
+	var c Client
+	c.Id = fmt.Sprintf("Cl-%d", time.Now().UnixNano())
+	c.mu = &sync.Mutex{}
+	c.endpoints = endpoints
+	var err error
+	for i := range endpoints {
+		c.useEndpoint(i)
+		if err = c.Connect(); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		c.useEndpoint(0)
+		go c.RetryConnect()
+	}
+	if failback > 0 && len(endpoints) > 1 {
+		go c.failbackLoop(failback)
+	}
+	return &c, err
+}
+
+func (c *Client) useEndpoint(i int) {
+	n := c.endpoints[i]
+	c.mu.Lock()
+	changed := c.active != i
+	c.active = i
+	c.Ip = n.Ip
+	c.Port = n.Port
+	c.Password = n.Password
+	c.mu.Unlock()
+	if changed {
+		// the failures counted were those of the previous endpoint
+		c.hookMu.RLock()
+		breakers := c.breakers
+		c.hookMu.RUnlock()
+		for _, b := range breakers {
+			b.Reset()
+		}
+	}
+}
+
+// Endpoints returns the endpoints and the index of the active one.
+func (c *Client) Endpoints() ([]Node, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints, c.active
+}
+
+// nextEndpoint switches to the next endpoint after a failed connect, it
+// returns false once every endpoint failed in this round.
+func (c *Client) nextEndpoint(err error) bool {
+	if len(c.endpoints) < 2 {
+		return false
+	}
+	_, active := c.Endpoints()
+	c.useEndpoint((active + 1) % len(c.endpoints))
+	atomic.AddUint64(&c.metrics.failovers, 1)
+	log.Printf("Client[%s] failover to %s\n", c.Id, c.addr())
+	c.stateChanged(StateFailover, err)
+	c.tried++
+	if c.tried >= len(c.endpoints) {
+		c.tried = 0
+		return false
+	}
+	return true
+}
+
+func (c *Client) failbackLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.mu.Lock()
+		active, closed := c.active, c.Closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+		if active == 0 || !c.ready() {
+			continue
+		}
+		preferred := c.endpoints[0]
+		sock, err := net.DialTimeout("tcp", preferred.Addr(), 5*time.Second)
+		if err != nil {
+			if debug {
+				log.Printf("Client[%s] failback probe %s failed:%v\n", c.Id, preferred.Addr(), err)
+			}
+			continue
+		}
+		// swap the socket inside processDo, so no command is in flight
+		_, err = c.submit(&Cmd{Name: "failback", run: func() error {
+			c.mu.Lock()
+			old := c.sock
+			c.sock = sock
+			c.mu.Unlock()
+			c.recv_buf.Reset()
+			if err := c.authProbe(preferred.Password); err != nil {
+				// stay on the active endpoint, the caller closes the probe
+				c.mu.Lock()
+				c.sock = old
+				c.mu.Unlock()
+				c.recv_buf.Reset()
+				return err
+			}
+			c.useEndpoint(0)
+			old.Close()
+			return nil
+		}})
+		if err != nil {
+			if debug {
+				log.Printf("Client[%s] failback to %s failed:%v\n", c.Id, preferred.Addr(), err)
+			}
+			sock.Close()
+			continue
+		}
+		log.Printf("Client[%s] failback to %s\n", c.Id, preferred.Addr())
+		c.stateChanged(StateFailback, nil)
+	}
+}
+
+// authProbe authenticates on the socket being probed, c.sock, without the
+// reconnect that a failed command starts.
+func (c *Client) authProbe(password string) error {
+	if password == "" {
+		return nil
+	}
+	c.sock.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.sock.SetDeadline(time.Time{})
+	if err := c.send([]interface{}{"auth", password}); err != nil {
+		return err
+	}
+	resp, err := c.recv()
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return fmt.Errorf("auth failed:%v", resp)
+	}
+	return nil
+}
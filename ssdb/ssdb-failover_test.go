@@ -0,0 +1,80 @@
+package ssdb_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestFailbackAuth(t *testing.T) {
+	preferred := ssdbtest.NewServer()
+	addr := preferred.Addr()
+	preferred.Close()
+	backup := ssdbtest.NewServer()
+	t.Cleanup(backup.Close)
+
+	endpoints := []ssdb.Node{
+		{Ip: preferred.Ip, Port: preferred.Port, Password: "secret"},
+		{Ip: backup.Ip, Port: backup.Port},
+	}
+	c, err := ssdb.ConnectFailover(endpoints, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	var mu sync.Mutex
+	var states []ssdb.ClientState
+	c.OnStateChange(func(s ssdb.StateChange) {
+		mu.Lock()
+		states = append(states, s.State)
+		mu.Unlock()
+	})
+	if _, active := c.Endpoints(); active != 1 {
+		t.Fatalf("active endpoint %d, want the backup", active)
+	}
+
+	// the preferred endpoint is back with another password: no failback
+	preferred, err = ssdbtest.NewServerAt(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(preferred.Close)
+	preferred.SetPassword("other")
+	time.Sleep(100 * time.Millisecond)
+	if _, active := c.Endpoints(); active != 1 {
+		t.Fatalf("active endpoint %d after a failed auth", active)
+	}
+	if _, err := c.Set("a", "1"); err != nil {
+		t.Fatalf("client broken by the failed failback: %v", err)
+	}
+	if got := backup.Exec([]string{"get", "a"}); len(got) != 2 || got[1] != "1" {
+		t.Fatalf("write not on the backup: %q", got)
+	}
+	mu.Lock()
+	if len(states) != 0 {
+		t.Fatalf("state changes %v", states)
+	}
+	mu.Unlock()
+
+	// with the right password it fails back
+	preferred.SetPassword("secret")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, active := c.Endpoints(); active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no failback")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := c.Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := preferred.Exec([]string{"get", "b"}); len(got) != 2 || got[1] != "2" {
+		t.Fatalf("write not on the preferred endpoint: %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package ssdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Cmd is a single SSDB command passing through the interceptor chain.
+// Interceptors may rewrite Name and Args before calling the next Handler
+// and inspect Resp, Err, Start and Duration after it returns.
+// A pipelined batch (Pipeline, MultiMode) travels as one Cmd named
+// "pipeline" whose Batch holds the individual commands.
+// Ctx is the context passed to DoContext or ProcessCmdContext, never nil.
+type Cmd struct {
+	Ctx      context.Context
+	Name     string
+	Args     []interface{}
+	Batch    []*Cmd
+	Resp     []string
+	Err      error
+	Start    time.Time
+	Duration time.Duration
+
+	run func() error // executed by processDo in place of the command
+}
+
+// Handler executes a command, the response is left in cmd.Resp.
+type Handler func(cmd *Cmd) error
+
+// Interceptor wraps a Handler with extra behaviour, e.g. logging or metrics.
+type Interceptor func(next Handler) Handler
+
+func newCmd(args []interface{}) *Cmd {
+	cmd := &Cmd{}
+	if len(args) > 0 {
+		cmd.Name = argString(args[0])
+		cmd.Args = args[1:]
+	}
+	return cmd
+}
+
+func newBatch(args [][]interface{}) *Cmd {
+	cmd := &Cmd{Name: "pipeline"}
+	for _, v := range args {
+		cmd.Batch = append(cmd.Batch, newCmd(v))
+	}
+	return cmd
+}
+
+// Wire returns the command name followed by its arguments, as sent to the server.
+func (cmd *Cmd) Wire() []interface{} {
+	return ArrayAppendToFirst([]interface{}{cmd.Name}, cmd.Args)
+}
+
+// Use appends interceptors to the client's chain. The first registered
+// interceptor is the outermost one and sees every command first.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.hookMu.Lock()
+	defer c.hookMu.Unlock()
+	c.interceptors = append(c.interceptors, interceptors...)
+	var h Handler = c.roundTrip
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		h = c.interceptors[i](h)
+	}
+	c.handler = h
+}
+
+// handle runs cmd through the interceptor chain.
+func (c *Client) handle(cmd *Cmd) ([]string, error) {
+	if cmd.Ctx == nil {
+		cmd.Ctx = context.Background()
+	}
+	c.hookMu.RLock()
+	h := c.handler
+	c.hookMu.RUnlock()
+	if h == nil {
+		h = c.roundTrip
+	}
+	cmd.Err = h(cmd)
+	return cmd.Resp, cmd.Err
+}
+
+// roundTrip is the innermost Handler, it hands the command to processDo and waits for the result.
+func (c *Client) roundTrip(cmd *Cmd) error {
+	cmd.Start = time.Now()
+	atomic.AddInt64(&c.metrics.inFlight, 1)
+	defer func() {
+		atomic.AddInt64(&c.metrics.inFlight, -1)
+		cmd.Duration = time.Since(cmd.Start)
+		c.metrics.record(cmd)
+	}()
+	if err := cmd.Ctx.Err(); err != nil {
+		cmd.Resp, cmd.Err = nil, err
+		return err
+	}
+	cmd.Resp, cmd.Err = c.submit(cmd)
+	return cmd.Err
+}
+
+// submit hands cmd to processDo, which owns the connection, and waits for the result.
+func (c *Client) submit(cmd *Cmd) ([]string, error) {
+	if c.ready() {
+		runId := fmt.Sprintf("%d", time.Now().UnixNano())
+		c.process <- []interface{}{runId, cmd}
+		for result := range c.result {
+			if result.Id == runId {
+				return result.Data, result.Error
+			} else {
+				c.result <- result
+			}
+		}
+	}
+	return nil, fmt.Errorf("Connection has closed.")
+}
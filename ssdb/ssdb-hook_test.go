@@ -0,0 +1,146 @@
+package ssdb_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+// record returns an interceptor logging the commands it sees into log.
+func record(name string, log *[]string) ssdb.Interceptor {
+	return func(next ssdb.Handler) ssdb.Handler {
+		return func(cmd *ssdb.Cmd) error {
+			*log = append(*log, name+" "+cmd.Name)
+			err := next(cmd)
+			*log = append(*log, name+" done")
+			return err
+		}
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	var log []string
+	c.Use(record("a", &log), record("b", &log))
+	c.Use(record("c", &log))
+
+	if _, err := c.Do("set", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a set", "b set", "c set", "c done", "b done", "a done"}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("calls %v, want %v", log, want)
+	}
+
+	// a rewrite by an outer interceptor is what the inner ones and the server see
+	log = nil
+	c.Use(func(next ssdb.Handler) ssdb.Handler {
+		return func(cmd *ssdb.Cmd) error {
+			if cmd.Name == "get" {
+				cmd.Args = []interface{}{"k"}
+			}
+			return next(cmd)
+		}
+	})
+	if v, err := c.Get("other"); err != nil || v != "v" {
+		t.Fatalf("get after the rewrite %v %v", v, err)
+	}
+	if log[0] != "a get" {
+		t.Fatalf("calls %v", log)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	var log []string
+	denied := fmt.Errorf("denied")
+	c.Use(record("outer", &log), func(next ssdb.Handler) ssdb.Handler {
+		return func(cmd *ssdb.Cmd) error {
+			switch cmd.Name {
+			case "del":
+				return denied
+			case "get":
+				cmd.Resp = []string{"ok", "cached"}
+				return nil
+			}
+			return next(cmd)
+		}
+	}, record("inner", &log))
+
+	exec(t, s, []string{"set", "k", "v"})
+	if _, err := c.Del("k"); err != denied {
+		t.Fatalf("del: %v", err)
+	}
+	if got := s.Exec([]string{"get", "k"}); got[1] != "v" {
+		t.Fatalf("denied del reached the server: %v", got)
+	}
+	if v, err := c.Get("k"); err != nil || v != "cached" {
+		t.Fatalf("get %v %v", v, err)
+	}
+	want := []string{"outer del", "outer done", "outer get", "outer done"}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("calls %v, want %v", log, want)
+	}
+	if st := c.Stats(); len(st.Commands) != 0 {
+		t.Fatalf("commands counted without a round trip: %v", st.Commands)
+	}
+}
+
+func TestInterceptorBatch(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	var seen []*ssdb.Cmd
+	c.Use(func(next ssdb.Handler) ssdb.Handler {
+		return func(cmd *ssdb.Cmd) error {
+			seen = append(seen, cmd)
+			return next(cmd)
+		}
+	})
+
+	resps, err := c.Pipeline([][]interface{}{{"set", "a", "1"}, {"get", "a"}})
+	if err != nil || !reflect.DeepEqual(resps, [][]string{{"ok", "1"}, {"ok", "1"}}) {
+		t.Fatalf("pipeline %q %v", resps, err)
+	}
+	multi, err := c.MultiMode([][]interface{}{{"incr", "a", 2}, {"get", "a"}})
+	if err != nil || !reflect.DeepEqual(multi, []string{"ok,3", "ok,3"}) {
+		t.Fatalf("multi mode %q %v", multi, err)
+	}
+
+	// each batch is one Cmd holding its commands and their responses
+	if len(seen) != 2 {
+		t.Fatalf("%d commands intercepted, want 2", len(seen))
+	}
+	for i, want := range [][]string{{"set a 1", "get a"}, {"incr a 2", "get a"}} {
+		cmd := seen[i]
+		if cmd.Name != "pipeline" || len(cmd.Args) != 0 || len(cmd.Batch) != len(want) {
+			t.Fatalf("batch %d: %+v", i, cmd)
+		}
+		for j, b := range cmd.Batch {
+			if got := strings.TrimSpace(fmt.Sprintln(b.Wire()...)); got != want[j] {
+				t.Errorf("batch %d command %d: %v, want %s", i, j, b.Wire(), want[j])
+			}
+			if len(b.Resp) == 0 || b.Resp[0] != "ok" {
+				t.Errorf("batch %d command %d: response %v", i, j, b.Resp)
+			}
+		}
+	}
+}
+
+func TestProcessCmdClosed(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	c.Close()
+	if _, err := c.ProcessCmd("get", []interface{}{"k"}); err == nil || err.Error() != "lost connection" {
+		t.Fatalf("process cmd on a closed client: %v", err)
+	}
+}
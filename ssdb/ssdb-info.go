@@ -0,0 +1,240 @@
+package ssdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BinlogInfo is the binlogs section of info.
+type BinlogInfo struct {
+	Capacity uint64
+	MinSeq   uint64
+	MaxSeq   uint64
+}
+
+// ReplicationStatus is one entry of the replication section of info: a slave
+// connected to this server ("client host:port") or a master this server is a
+// slave of ("slaveof host:port"). LastSeq is a sequence of the master's binlog.
+type ReplicationStatus struct {
+	Role      string // client or slaveof
+	Addr      string
+	Id        string
+	Type      string // sync or mirror
+	Status    string // DISCONNECTED, INIT, OUT_OF_SYNC, COPY or SYNC
+	LastSeq   uint64
+	CopyCount uint64
+	SyncCount uint64
+}
+
+// Lag returns how many binlog records the slave is behind masterSeq.
+func (r ReplicationStatus) Lag(masterSeq uint64) uint64 {
+	if masterSeq > r.LastSeq {
+		return masterSeq - r.LastSeq
+	}
+	return 0
+}
+
+// Info is the parsed response of the info command.
+type Info struct {
+	Version    string
+	Links      int64
+	TotalCalls uint64
+	DbSize     int64
+	Binlog     BinlogInfo
+	Slaves     []ReplicationStatus // slaves replicating from this server
+	Masters    []ReplicationStatus // masters this server replicates from
+	Fields     map[string]string   // every field, the last one of repeated names
+}
+
+// ParseInfo parses the response of the info command.
+func ParseInfo(resp []string) (*Info, error) {
+	if len(resp) == 0 || resp[0] != "ok" {
+		return nil, fmt.Errorf("bad info response:%v", resp)
+	}
+	info := &Info{Fields: make(map[string]string)}
+	i := 1
+	if len(resp)%2 == 0 {
+		// skip the "ssdb-server" banner
+		i = 2
+	}
+	for ; i+1 < len(resp); i += 2 {
+		name, value := resp[i], resp[i+1]
+		info.Fields[name] = value
+		switch name {
+		case "version":
+			info.Version = value
+		case "links":
+			info.Links, _ = strconv.ParseInt(value, 10, 64)
+		case "total_calls":
+			info.TotalCalls, _ = strconv.ParseUint(value, 10, 64)
+		case "dbsize":
+			info.DbSize, _ = strconv.ParseInt(value, 10, 64)
+		case "binlogs":
+			f := infoSection(value)
+			info.Binlog.Capacity, _ = strconv.ParseUint(f["capacity"], 10, 64)
+			info.Binlog.MinSeq, _ = strconv.ParseUint(f["min_seq"], 10, 64)
+			info.Binlog.MaxSeq, _ = strconv.ParseUint(f["max_seq"], 10, 64)
+		case "replication":
+			r := parseReplication(value)
+			if r.Role == "slaveof" {
+				info.Masters = append(info.Masters, r)
+			} else {
+				info.Slaves = append(info.Slaves, r)
+			}
+		}
+	}
+	return info, nil
+}
+
+// infoSection parses the "    name : value" lines of a section.
+func infoSection(value string) map[string]string {
+	f := make(map[string]string)
+	for _, line := range strings.Split(value, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			f[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return f
+}
+
+func parseReplication(value string) ReplicationStatus {
+	var r ReplicationStatus
+	head := value
+	if i := strings.Index(value, "\n"); i >= 0 {
+		head = value[:i]
+	}
+	if parts := strings.Fields(head); len(parts) == 2 {
+		r.Role, r.Addr = parts[0], parts[1]
+	}
+	f := infoSection(value)
+	r.Id = f["id"]
+	r.Type = f["type"]
+	r.Status = f["status"]
+	r.LastSeq, _ = strconv.ParseUint(f["last_seq"], 10, 64)
+	r.CopyCount, _ = strconv.ParseUint(f["copy_count"], 10, 64)
+	r.SyncCount, _ = strconv.ParseUint(f["sync_count"], 10, 64)
+	return r
+}
+
+// Info returns the parsed server info.
+func (c *Client) Info() (*Info, error) {
+	resp, err := c.Do("info")
+	if err != nil {
+		return nil, err
+	}
+	return ParseInfo(resp)
+}
+
+// SlaveLag returns the lag, in binlog records, of every slave connected to
+// this server by address.
+func (c *Client) SlaveLag() (map[string]uint64, error) {
+	info, err := c.Info()
+	if err != nil {
+		return nil, err
+	}
+	lag := make(map[string]uint64)
+	for _, s := range info.Slaves {
+		lag[s.Addr] = s.Lag(info.Binlog.MaxSeq)
+	}
+	return lag, nil
+}
+
+// SlaveOf makes the server a slave of host:port at runtime, under the name
+// id. Replication starts at lastSeq/lastKey, the zero values ask for a
+// full copy first.
+func (c *Client) SlaveOf(id string, host string, port int, auth string, lastSeq uint64, lastKey string) error {
+	args := []interface{}{"slaveof", id, host, port, auth}
+	if lastSeq != 0 || lastKey != "" {
+		args = append(args, strconv.FormatUint(lastSeq, 10), lastKey)
+	}
+	resp, err := c.Do(args...)
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return fmt.Errorf("slaveof %s:%d failed:%v", host, port, resp)
+	}
+	return nil
+}
+
+// ReplicationLag returns the lag, in binlog records of the master, of every
+// slave in the order of rc.Slaves.
+func (rc *ReplicatedClient) ReplicationLag() ([]uint64, error) {
+	master, err := rc.Master.Info()
+	if err != nil {
+		return nil, fmt.Errorf("master info:%v", err)
+	}
+	lags := make([]uint64, len(rc.Slaves))
+	for i, s := range rc.Slaves {
+		status, err := rc.slaveStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		lags[i] = status.Lag(master.Binlog.MaxSeq)
+	}
+	return lags, nil
+}
+
+// slaveStatus returns the replication entry of a slave for the master of rc.
+func (rc *ReplicatedClient) slaveStatus(s *Client) (ReplicationStatus, error) {
+	info, err := s.Info()
+	if err != nil {
+		return ReplicationStatus{}, fmt.Errorf("slave %s:%d info:%v", s.Ip, s.Port, err)
+	}
+	master := fmt.Sprintf("%s:%d", rc.Master.Ip, rc.Master.Port)
+	for _, m := range info.Masters {
+		if m.Addr == master {
+			return m, nil
+		}
+	}
+	if len(info.Masters) == 1 {
+		// the master may be known to the slave under another address
+		return info.Masters[0], nil
+	}
+	return ReplicationStatus{}, fmt.Errorf("slave %s:%d does not replicate from %s", s.Ip, s.Port, master)
+}
+
+// WaitForReplication polls the slaves until every one has replicated the
+// master's binlog up to seq, or ctx is done. A seq of 0 waits for the
+// master's current last sequence.
+func (rc *ReplicatedClient) WaitForReplication(ctx context.Context, seq uint64) error {
+	if seq == 0 {
+		info, err := rc.Master.Info()
+		if err != nil {
+			return fmt.Errorf("master info:%v", err)
+		}
+		seq = info.Binlog.MaxSeq
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var behind []string
+		var lastErr error
+		for _, s := range rc.Slaves {
+			status, err := rc.slaveStatus(s)
+			if err != nil {
+				lastErr = err
+				behind = append(behind, fmt.Sprintf("%s:%d", s.Ip, s.Port))
+				continue
+			}
+			if status.Status != "SYNC" || status.LastSeq < seq {
+				behind = append(behind, fmt.Sprintf("%s:%d(%s %d)", s.Ip, s.Port, status.Status, status.LastSeq))
+			}
+		}
+		if len(behind) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("wait for seq %d: %v, last error:%v", seq, ctx.Err(), lastErr)
+			}
+			return fmt.Errorf("wait for seq %d: %v, behind:%s", seq, ctx.Err(), strings.Join(behind, ","))
+		case <-ticker.C:
+		}
+	}
+}
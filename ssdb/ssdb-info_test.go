@@ -0,0 +1,154 @@
+package ssdb_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestParseInfo(t *testing.T) {
+	client := "client 10.0.0.2:5678\n    type     : sync\n    status   : SYNC\n    last_seq : 90"
+	slaveof := "slaveof 10.0.0.1:8888\n    id         : m1\n    type       : mirror\n    status     : COPY\n    last_seq   : 7\n    copy_count : 3\n    sync_count : 4"
+	resp := []string{"ok", "ssdb-server",
+		"version", "1.9.9",
+		"links", "2",
+		"total_calls", "31",
+		"dbsize", "12",
+		"binlogs", "    capacity : 20000000\n    min_seq  : 5\n    max_seq  : 100",
+		"replication", client,
+		"replication", slaveof,
+		"serv_key_range", "\"\" - \"\"",
+	}
+	info, err := ssdb.ParseInfo(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ssdb.Info{
+		Version: "1.9.9", Links: 2, TotalCalls: 31, DbSize: 12,
+		Binlog: ssdb.BinlogInfo{Capacity: 20000000, MinSeq: 5, MaxSeq: 100},
+		Slaves: []ssdb.ReplicationStatus{
+			{Role: "client", Addr: "10.0.0.2:5678", Type: "sync", Status: "SYNC", LastSeq: 90},
+		},
+		Masters: []ssdb.ReplicationStatus{
+			{Role: "slaveof", Addr: "10.0.0.1:8888", Id: "m1", Type: "mirror", Status: "COPY", LastSeq: 7, CopyCount: 3, SyncCount: 4},
+		},
+		Fields: map[string]string{
+			"version": "1.9.9", "links": "2", "total_calls": "31", "dbsize": "12",
+			"binlogs": resp[11], "replication": slaveof, "serv_key_range": "\"\" - \"\"",
+		},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("info %+v, want %+v", info, want)
+	}
+	if lag := info.Slaves[0].Lag(info.Binlog.MaxSeq); lag != 10 {
+		t.Fatalf("lag %d", lag)
+	}
+	if lag := info.Slaves[0].Lag(50); lag != 0 {
+		t.Fatalf("lag behind the slave %d", lag)
+	}
+
+	// without the banner
+	if info, err := ssdb.ParseInfo([]string{"ok", "version", "1.8", "links", "x"}); err != nil || info.Version != "1.8" || info.Links != 0 {
+		t.Fatalf("info without banner %+v %v", info, err)
+	}
+	for _, bad := range [][]string{nil, {"error", "x"}, {"not_found"}} {
+		if _, err := ssdb.ParseInfo(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestSlaveOfArgs(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	var got [][]string
+	s.Handle("slaveof", func(args []string) []string {
+		got = append(got, args)
+		if args[1] == "dup" {
+			return []string{"client_error", "slave id exists"}
+		}
+		return []string{"ok"}
+	})
+	c := connect(t, s)
+
+	if err := c.SlaveOf("a", "h", 1, "", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SlaveOf("b", "h", 2, "pw", 9, "k"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"slaveof", "a", "h", "1", ""}, {"slaveof", "b", "h", "2", "pw", "9", "k"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	if err := c.SlaveOf("dup", "h", 3, "", 0, ""); err == nil || !strings.Contains(err.Error(), "slave id exists") {
+		t.Fatalf("refused slaveof: %v", err)
+	}
+}
+
+func TestWaitForReplication(t *testing.T) {
+	master, slave, other := ssdbtest.NewServer(), ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(master.Close)
+	t.Cleanup(slave.Close)
+	t.Cleanup(other.Close)
+	exec(t, master, []string{"set", "a", "1"}, []string{"hset", "h", "f", "v"})
+
+	if err := connect(t, slave).SlaveOf("m", master.Ip, master.Port, "", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ssdb.NewReplicatedClient(node(t, master.Addr()), []ssdb.Node{node(t, slave.Addr())}, ssdb.ReadRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rc.WaitForReplication(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := slave.Exec([]string{"hget", "h", "f"}); !reflect.DeepEqual(got, []string{"ok", "v"}) {
+		t.Fatalf("copied hash field %q", got)
+	}
+
+	// a write after the copy is synced up to its sequence
+	exec(t, master, []string{"set", "b", "2"})
+	info, err := rc.Master.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.WaitForReplication(ctx, info.Binlog.MaxSeq); err != nil {
+		t.Fatal(err)
+	}
+	if got := slave.Exec([]string{"get", "b"}); !reflect.DeepEqual(got, []string{"ok", "2"}) {
+		t.Fatalf("synced key %q", got)
+	}
+	if lags, err := rc.ReplicationLag(); err != nil || !reflect.DeepEqual(lags, []uint64{0}) {
+		t.Fatalf("lag %v %v", lags, err)
+	}
+	if st := slave.Exec([]string{"info"}); !strings.Contains(strings.Join(st, "\n"), "status     : SYNC") {
+		t.Fatalf("slave info %q", st)
+	}
+
+	// a sequence the master hasn't reached and a server that isn't a slave time out
+	short, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := rc.WaitForReplication(short, info.Binlog.MaxSeq+1); err == nil || !strings.Contains(err.Error(), "behind:") {
+		t.Fatalf("wait for a future seq: %v", err)
+	}
+	rc2, err := ssdb.NewReplicatedClient(node(t, master.Addr()), []ssdb.Node{node(t, other.Addr())}, ssdb.ReadRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc2.Close() })
+	short, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := rc2.WaitForReplication(short, 0); err == nil || !strings.Contains(err.Error(), "does not replicate") {
+		t.Fatalf("wait for a server that isn't a slave: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package ssdb
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the command latency histograms.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Histogram is a latency histogram, Counts[i] holds the observations
+// not larger than Buckets[i] and the last element of Counts the rest.
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Buckets = LatencyBuckets
+		h.Counts = make([]uint64, len(LatencyBuckets)+1)
+	}
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.Buckets, v)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// CommandStats holds the counters of one command name.
+type CommandStats struct {
+	Calls   uint64
+	Errors  uint64
+	Latency Histogram
+}
+
+// Stats is a snapshot of the client side metrics.
+type Stats struct {
+	Id           string
+	Addr         string // active endpoint
+	Endpoint     int    // index of the active endpoint, see ConnectFailover
+	Connected    bool
+	Commands     map[string]CommandStats
+	Status       map[string]uint64 // failed responses by status, "io" for network errors
+	Retries      uint64            // times RetryConnect started
+	Reconnects   uint64            // successful reconnects
+	Failovers    uint64            // switches to the next endpoint
+	DialFailures uint64            // failed connects, reconnects included
+	InFlight     int64             // commands running now
+	BytesIn      uint64
+	BytesOut     uint64
+}
+
+type clientMetrics struct {
+	mu           sync.Mutex
+	commands     map[string]*CommandStats
+	status       map[string]uint64
+	retries      uint64
+	reconnects   uint64
+	failovers    uint64
+	dialFailures uint64
+	inFlight     int64
+	bytesIn      uint64
+	bytesOut     uint64
+}
+
+func (m *clientMetrics) record(cmd *Cmd) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.commands == nil {
+		m.commands = make(map[string]*CommandStats)
+		m.status = make(map[string]uint64)
+	}
+	s, ok := m.commands[cmd.Name]
+	if !ok {
+		s = &CommandStats{}
+		m.commands[cmd.Name] = s
+	}
+	s.Calls++
+	s.Latency.observe(cmd.Duration)
+	if cmd.Err != nil {
+		s.Errors++
+		m.status["io"]++
+		return
+	}
+	cmds := cmd.Batch
+	if cmds == nil {
+		cmds = []*Cmd{cmd}
+	}
+	for _, v := range cmds {
+		if len(v.Resp) > 0 && v.Resp[0] != "ok" {
+			m.status[v.Resp[0]]++
+			if v.Resp[0] != "not_found" {
+				s.Errors++
+			}
+		}
+	}
+}
+
+// Stats returns a snapshot of the client's metrics.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	addr, active, connected := fmt.Sprintf("%s:%d", c.Ip, c.Port), c.active, c.Connected
+	c.mu.Unlock()
+	m := &c.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Stats{
+		Id:           c.Id,
+		Addr:         addr,
+		Endpoint:     active,
+		Connected:    connected,
+		Commands:     make(map[string]CommandStats),
+		Status:       make(map[string]uint64),
+		Retries:      atomic.LoadUint64(&m.retries),
+		Reconnects:   atomic.LoadUint64(&m.reconnects),
+		Failovers:    atomic.LoadUint64(&m.failovers),
+		DialFailures: atomic.LoadUint64(&m.dialFailures),
+		InFlight:     atomic.LoadInt64(&m.inFlight),
+		BytesIn:      atomic.LoadUint64(&m.bytesIn),
+		BytesOut:     atomic.LoadUint64(&m.bytesOut),
+	}
+	for k, v := range m.commands {
+		cs := *v
+		cs.Latency.Counts = append([]uint64(nil), v.Latency.Counts...)
+		s.Commands[k] = cs
+	}
+	for k, v := range m.status {
+		s.Status[k] = v
+	}
+	return s
+}
+
+// PublishExpvar exports the client's Stats as the expvar variable name.
+func (c *Client) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (s Stats) WritePrometheus(w io.Writer) {
+	writeStatsPrometheus(w, []Stats{s})
+}
+
+func writeStatsPrometheus(w io.Writer, stats []Stats) {
+	fmt.Fprintf(w, "# HELP ssdb_client_commands_total Commands sent to the server.\n# TYPE ssdb_client_commands_total counter\n")
+	for _, s := range stats {
+		for _, name := range sortedKeys(s.Commands) {
+			fmt.Fprintf(w, "ssdb_client_commands_total{%s} %d\n", s.labels("cmd", name), s.Commands[name].Calls)
+		}
+	}
+	fmt.Fprintf(w, "# HELP ssdb_client_command_errors_total Commands failed with a network error or an error status.\n# TYPE ssdb_client_command_errors_total counter\n")
+	for _, s := range stats {
+		for _, name := range sortedKeys(s.Commands) {
+			fmt.Fprintf(w, "ssdb_client_command_errors_total{%s} %d\n", s.labels("cmd", name), s.Commands[name].Errors)
+		}
+	}
+	fmt.Fprintf(w, "# HELP ssdb_client_command_duration_seconds Command round trip latency.\n# TYPE ssdb_client_command_duration_seconds histogram\n")
+	for _, s := range stats {
+		for _, name := range sortedKeys(s.Commands) {
+			h := s.Commands[name].Latency
+			labels := s.labels("cmd", name)
+			var cum uint64
+			for i, b := range h.Buckets {
+				cum += h.Counts[i]
+				fmt.Fprintf(w, "ssdb_client_command_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, b, cum)
+			}
+			fmt.Fprintf(w, "ssdb_client_command_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+			fmt.Fprintf(w, "ssdb_client_command_duration_seconds_sum{%s} %g\n", labels, h.Sum)
+			fmt.Fprintf(w, "ssdb_client_command_duration_seconds_count{%s} %d\n", labels, h.Count)
+		}
+	}
+	fmt.Fprintf(w, "# HELP ssdb_client_errors_total Failed responses by status.\n# TYPE ssdb_client_errors_total counter\n")
+	for _, s := range stats {
+		for _, status := range sortedKeys(s.Status) {
+			fmt.Fprintf(w, "ssdb_client_errors_total{%s} %d\n", s.labels("status", status), s.Status[status])
+		}
+	}
+	counters := []struct {
+		name, help string
+		value      func(s Stats) uint64
+	}{
+		{"ssdb_client_retries_total", "Times the client started to reconnect.", func(s Stats) uint64 { return s.Retries }},
+		{"ssdb_client_reconnects_total", "Successful reconnects.", func(s Stats) uint64 { return s.Reconnects }},
+		{"ssdb_client_failovers_total", "Switches to the next endpoint.", func(s Stats) uint64 { return s.Failovers }},
+		{"ssdb_client_dial_failures_total", "Failed connects, reconnects included.", func(s Stats) uint64 { return s.DialFailures }},
+		{"ssdb_client_received_bytes_total", "Bytes read from the server.", func(s Stats) uint64 { return s.BytesIn }},
+		{"ssdb_client_sent_bytes_total", "Bytes written to the server.", func(s Stats) uint64 { return s.BytesOut }},
+	}
+	for _, m := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s{%s} %d\n", m.name, s.labels(), m.value(s))
+		}
+	}
+	fmt.Fprintf(w, "# HELP ssdb_client_connected Whether the client is connected.\n# TYPE ssdb_client_connected gauge\n")
+	for _, s := range stats {
+		connected := 0
+		if s.Connected {
+			connected = 1
+		}
+		fmt.Fprintf(w, "ssdb_client_connected{%s} %d\n", s.labels(), connected)
+	}
+}
+
+// MetricsHandler serves the metrics of the given clients in the Prometheus text format.
+func MetricsHandler(clients ...*Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var stats []Stats
+		for _, c := range clients {
+			stats = append(stats, c.Stats())
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeStatsPrometheus(w, stats)
+	})
+}
+
+func (s Stats) labels(kv ...string) string {
+	labels := []string{
+		"client=" + promQuote(s.Id),
+		"addr=" + promQuote(s.Addr),
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=%s", kv[i], promQuote(kv[i+1])))
+	}
+	return strings.Join(labels, ",")
+}
+
+// promQuote quotes a label value, escaping backslash, quote and newline only.
+func promQuote(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package ssdb_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestClientStats(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	s.Handle("fail", func(args []string) []string { return []string{"error", "failed"} })
+	c := connect(t, s)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Set("a", "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Get("missing")
+	c.Do("fail")
+
+	st := c.Stats()
+	if st.Id != c.Id || st.Addr != s.Addr() || !st.Connected || st.BytesIn == 0 || st.BytesOut == 0 || st.InFlight != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+	for name, want := range map[string][2]uint64{"set": {3, 0}, "get": {1, 0}, "fail": {1, 1}} {
+		cs := st.Commands[name]
+		if cs.Calls != want[0] || cs.Errors != want[1] || cs.Latency.Count != want[0] {
+			t.Errorf("%s: %d calls %d errors %d observations, want %v", name, cs.Calls, cs.Errors, cs.Latency.Count, want)
+		}
+	}
+	if st.Status["not_found"] != 1 || st.Status["error"] != 1 || len(st.Status) != 2 {
+		t.Errorf("status %v", st.Status)
+	}
+
+	w := httptest.NewRecorder()
+	ssdb.MetricsHandler(c).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	labels := `client="` + c.Id + `",addr="` + s.Addr() + `"`
+	for _, want := range []string{
+		"# TYPE ssdb_client_commands_total counter\n",
+		"ssdb_client_commands_total{" + labels + `,cmd="set"} 3` + "\n",
+		"ssdb_client_command_errors_total{" + labels + `,cmd="fail"} 1` + "\n",
+		"ssdb_client_command_duration_seconds_bucket{" + labels + `,cmd="set",le="+Inf"} 3` + "\n",
+		"ssdb_client_command_duration_seconds_count{" + labels + `,cmd="get"} 1` + "\n",
+		"ssdb_client_errors_total{" + labels + `,status="not_found"} 1` + "\n",
+		"ssdb_client_retries_total{" + labels + "} 0\n",
+		"ssdb_client_connected{" + labels + "} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
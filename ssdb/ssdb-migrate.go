@@ -0,0 +1,568 @@
+package ssdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Migration copies the keys, hashes, zsets and queues in a range from one
+// server to another. Keys keep their TTL, hash fields and zset members are
+// overwritten and copied queues replace the queues of the same name.
+//
+// Every page written is read back from the destination, differences are
+// reported as mismatches. With DeleteSource a key or container is removed
+// from the source once the source and the destination are compared equal,
+// anything written to it between that check and the delete is lost.
+type Migration struct {
+	Range         KeyRange
+	Types         []DataType // nil migrates every type
+	Workers       int        // keys pages and containers copied at once, default 4
+	Rate          int        // items copied per second, 0 is unlimited
+	Page          int        // items per request, default 1000
+	DeleteSource  bool
+	MaxMismatches int // mismatches kept in the report, default 1000
+
+	src, dst []*Client
+	limiter  *rateLimiter
+	start    time.Time
+
+	// updated atomically, Stats reads them
+	names, items, deleted, mismatched int64
+
+	mu         sync.Mutex
+	mismatches []Mismatch
+}
+
+// Mismatch is a key, field, member or queue item that differs between the
+// source and the destination after it is copied.
+type Mismatch struct {
+	Type   DataType
+	Key    string // the key, or the name of the hash, zset or queue
+	Field  string // hash field, zset member or queue position
+	Reason string // "missing", "differs" or "source changed"
+	Source string
+	Dest   string
+}
+
+// MigrateStats counts the progress of a Migration.
+type MigrateStats struct {
+	Names      int64 // keys, hashes, zsets and queues copied
+	Items      int64 // keys, fields, members and queue items copied
+	Deleted    int64 // keys and containers deleted from the source
+	Mismatched int64 // keys, fields, members and queue items that differ
+	Elapsed    time.Duration
+}
+
+// MigrateReport is the outcome of a Migration.
+type MigrateReport struct {
+	MigrateStats
+	Mismatches []Mismatch // the first MaxMismatches
+}
+
+// NewMigration migrates from src to dst over one connection each.
+func NewMigration(src, dst *Client) *Migration {
+	return &Migration{src: []*Client{src}, dst: []*Client{dst}}
+}
+
+// NewPoolMigration migrates over the connections of two pools, so workers
+// run their commands in parallel.
+func NewPoolMigration(src, dst *Pool) *Migration {
+	return &Migration{src: src.Clients(), dst: dst.Clients()}
+}
+
+// Stats returns the progress so far, it can be called while Run runs.
+func (m *Migration) Stats() MigrateStats {
+	return MigrateStats{
+		Names:      atomic.LoadInt64(&m.names),
+		Items:      atomic.LoadInt64(&m.items),
+		Deleted:    atomic.LoadInt64(&m.deleted),
+		Mismatched: atomic.LoadInt64(&m.mismatched),
+		Elapsed:    time.Since(m.start),
+	}
+}
+
+type migrateJob struct {
+	t    DataType
+	name string
+	kvs  []KeyValue // a page of keys for TypeKV
+}
+
+// Run migrates the range and returns the report. On error it stops and
+// returns the report of what was migrated so far.
+func (m *Migration) Run(ctx context.Context) (*MigrateReport, error) {
+	if m.Workers <= 0 {
+		m.Workers = 4
+	}
+	if m.Page <= 0 {
+		m.Page = scanPage
+	}
+	if m.MaxMismatches <= 0 {
+		m.MaxMismatches = 1000
+	}
+	types := m.Types
+	if types == nil {
+		types = DataTypes
+	}
+	if m.Rate > 0 {
+		m.limiter = &rateLimiter{rate: float64(m.Rate)}
+	}
+	m.start = time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		cancel()
+	}
+	jobs := make(chan migrateJob)
+	for i := 0; i < m.Workers; i++ {
+		src, dst := m.src[i%len(m.src)], m.dst[i%len(m.dst)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := m.migrate(ctx, src, dst, j); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	send := func(j migrateJob) error {
+		select {
+		case jobs <- j:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, t := range types {
+		var err error
+		if t == TypeKV {
+			err = m.src[0].ScanKVIn(m.Range, m.Page, func(kvs []KeyValue) error {
+				return send(migrateJob{t: t, kvs: kvs})
+			})
+		} else {
+			err = m.src[0].ScanNamesIn(t, m.Range, m.Page, func(names []string) error {
+				for _, name := range names {
+					if err := send(migrateJob{t: t, name: name}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			fail(fmt.Errorf("migrate %s: %v", t, err))
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	m.mu.Lock()
+	report := &MigrateReport{MigrateStats: m.Stats(), Mismatches: m.mismatches}
+	m.mu.Unlock()
+	return report, firstErr
+}
+
+func (m *Migration) mismatch(mm Mismatch) {
+	atomic.AddInt64(&m.mismatched, 1)
+	m.mu.Lock()
+	if len(m.mismatches) < m.MaxMismatches {
+		m.mismatches = append(m.mismatches, mm)
+	}
+	m.mu.Unlock()
+}
+
+func (m *Migration) migrate(ctx context.Context, src, dst *Client, j migrateJob) error {
+	var err error
+	switch j.t {
+	case TypeKV:
+		err = m.migrateKV(ctx, src, dst, j.kvs)
+	case TypeHash:
+		err = m.migrateHash(ctx, src, dst, j.name)
+	case TypeZset:
+		err = m.migrateZset(ctx, src, dst, j.name)
+	default:
+		err = m.migrateQueue(ctx, src, dst, j.name)
+	}
+	if err != nil && j.t != TypeKV {
+		return fmt.Errorf("migrate %s %q: %v", j.t, j.name, err)
+	}
+	return err
+}
+
+// pipeline runs cmds and checks every response is ok.
+func pipeline(c *Client, cmds [][]interface{}) error {
+	resps, err := c.Pipeline(cmds)
+	if err != nil {
+		return err
+	}
+	for i, resp := range resps {
+		if err := checkResp(fmt.Sprint(cmds[i][0]), resp, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiGet runs a multi_get style command and returns the values by key.
+func multiGet(c *Client, cmd string, args []interface{}) (map[string]string, error) {
+	resp, err := c.Do(append([]interface{}{cmd}, args...)...)
+	if err := checkResp(cmd, resp, err); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(resp)/2)
+	for i := 1; i+1 < len(resp); i += 2 {
+		values[resp[i]] = resp[i+1]
+	}
+	return values, nil
+}
+
+// compare records a mismatch for every field of want that got lacks or
+// has another value, it returns whether they all match.
+func (m *Migration) compare(t DataType, name string, want []KeyValue, got map[string]string, reason string) bool {
+	equal := true
+	for _, kv := range want {
+		v, ok := got[kv.Key]
+		if ok && v == kv.Value {
+			continue
+		}
+		equal = false
+		mm := Mismatch{Type: t, Key: name, Field: kv.Key, Reason: reason, Source: kv.Value, Dest: v}
+		if t == TypeKV {
+			mm.Key, mm.Field = kv.Key, ""
+		}
+		if reason == "" {
+			mm.Reason = "differs"
+			if !ok {
+				mm.Reason = "missing"
+			}
+		}
+		m.mismatch(mm)
+	}
+	return equal
+}
+
+func (m *Migration) migrateKV(ctx context.Context, src, dst *Client, kvs []KeyValue) error {
+	keys := make([]interface{}, len(kvs))
+	names := make([]string, len(kvs))
+	for i, kv := range kvs {
+		keys[i], names[i] = kv.Key, kv.Key
+	}
+	ttls, err := src.TTLs(names)
+	if err != nil {
+		return err
+	}
+	if err := m.limiter.wait(ctx, len(kvs)); err != nil {
+		return err
+	}
+	cmds := make([][]interface{}, len(kvs))
+	for i, kv := range kvs {
+		if ttls[i] > 0 {
+			cmds[i] = []interface{}{"setx", kv.Key, kv.Value, ttls[i]}
+		} else {
+			cmds[i] = []interface{}{"set", kv.Key, kv.Value}
+		}
+	}
+	if err := pipeline(dst, cmds); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.names, int64(len(kvs)))
+	atomic.AddInt64(&m.items, int64(len(kvs)))
+
+	got, err := multiGet(dst, "multi_get", keys)
+	if err != nil {
+		return err
+	}
+	copied := kvs[:0:0]
+	for _, kv := range kvs {
+		if m.compare(TypeKV, "", []KeyValue{kv}, got, "") {
+			copied = append(copied, kv)
+		}
+	}
+	if !m.DeleteSource || len(copied) == 0 {
+		return nil
+	}
+	// delete only the keys the source still has as copied
+	keys = keys[:0]
+	for _, kv := range copied {
+		keys = append(keys, kv.Key)
+	}
+	now, err := multiGet(src, "multi_get", keys)
+	if err != nil {
+		return err
+	}
+	keys = keys[:0]
+	for _, kv := range copied {
+		if v, ok := now[kv.Key]; ok && v != kv.Value {
+			m.mismatch(Mismatch{Type: TypeKV, Key: kv.Key, Reason: "source changed", Source: v, Dest: kv.Value})
+		} else if ok {
+			keys = append(keys, kv.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	resp, err := src.Do(append([]interface{}{"multi_del"}, keys...)...)
+	if err := checkResp("multi_del", resp, err); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.deleted, int64(len(keys)))
+	return nil
+}
+
+// fieldArgs returns name followed by the fields of kvs.
+func fieldArgs(name string, kvs []KeyValue) []interface{} {
+	args := make([]interface{}, 0, len(kvs)+1)
+	args = append(args, name)
+	for _, kv := range kvs {
+		args = append(args, kv.Key)
+	}
+	return args
+}
+
+// pairArgs returns name followed by the fields and values of kvs.
+func pairArgs(name string, kvs []KeyValue) []interface{} {
+	args := make([]interface{}, 0, 2*len(kvs)+1)
+	args = append(args, name)
+	for _, kv := range kvs {
+		args = append(args, kv.Key, kv.Value)
+	}
+	return args
+}
+
+func zsetPairs(items []ZsetItem) []KeyValue {
+	kvs := make([]KeyValue, len(items))
+	for i, it := range items {
+		kvs[i] = KeyValue{it.Member, strconv.FormatInt(it.Score, 10)}
+	}
+	return kvs
+}
+
+func (m *Migration) migrateHash(ctx context.Context, src, dst *Client, name string) error {
+	equal := true
+	err := src.ScanHash(name, m.Page, func(fields []KeyValue) error {
+		if err := m.limiter.wait(ctx, len(fields)); err != nil {
+			return err
+		}
+		resp, err := dst.Do(append([]interface{}{"multi_hset"}, pairArgs(name, fields)...)...)
+		if err := checkResp("multi_hset", resp, err); err != nil {
+			return err
+		}
+		atomic.AddInt64(&m.items, int64(len(fields)))
+		got, err := multiGet(dst, "multi_hget", fieldArgs(name, fields))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeHash, name, fields, got, "") {
+			equal = false
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.names, 1)
+	if !m.DeleteSource || !equal {
+		return nil
+	}
+	err = src.ScanHash(name, m.Page, func(fields []KeyValue) error {
+		got, err := multiGet(dst, "multi_hget", fieldArgs(name, fields))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeHash, name, fields, got, "source changed") {
+			equal = false
+		}
+		return nil
+	})
+	if err != nil || !equal {
+		return err
+	}
+	return m.clear(src, "hclear", name)
+}
+
+func (m *Migration) migrateZset(ctx context.Context, src, dst *Client, name string) error {
+	equal := true
+	err := src.ScanZset(name, m.Page, func(items []ZsetItem) error {
+		if err := m.limiter.wait(ctx, len(items)); err != nil {
+			return err
+		}
+		members := zsetPairs(items)
+		resp, err := dst.Do(append([]interface{}{"multi_zset"}, pairArgs(name, members)...)...)
+		if err := checkResp("multi_zset", resp, err); err != nil {
+			return err
+		}
+		atomic.AddInt64(&m.items, int64(len(items)))
+		got, err := multiGet(dst, "multi_zget", fieldArgs(name, members))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeZset, name, members, got, "") {
+			equal = false
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.names, 1)
+	if !m.DeleteSource || !equal {
+		return nil
+	}
+	err = src.ScanZset(name, m.Page, func(items []ZsetItem) error {
+		members := zsetPairs(items)
+		got, err := multiGet(dst, "multi_zget", fieldArgs(name, members))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeZset, name, members, got, "source changed") {
+			equal = false
+		}
+		return nil
+	})
+	if err != nil || !equal {
+		return err
+	}
+	return m.clear(src, "zclear", name)
+}
+
+// queuePage returns the items of a queue page as position/item pairs.
+func queuePage(offset int64, items []string) []KeyValue {
+	kvs := make([]KeyValue, len(items))
+	for i, item := range items {
+		kvs[i] = KeyValue{strconv.FormatInt(offset+int64(i), 10), item}
+	}
+	return kvs
+}
+
+// queueRange returns items of a queue by position.
+func queueRange(c *Client, name string, offset int64, n int) (map[string]string, error) {
+	resp, err := c.Do("qrange", name, offset, n)
+	if err := checkResp("qrange", resp, err); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, kv := range queuePage(offset, resp[1:]) {
+		values[kv.Key] = kv.Value
+	}
+	return values, nil
+}
+
+func (m *Migration) migrateQueue(ctx context.Context, src, dst *Client, name string) error {
+	resp, err := dst.Do("qclear", name)
+	if err := checkResp("qclear", resp, err); err != nil {
+		return err
+	}
+	equal := true
+	var size int64
+	err = src.ScanQueue(name, m.Page, func(offset int64, items []string) error {
+		if err := m.limiter.wait(ctx, len(items)); err != nil {
+			return err
+		}
+		args := make([]interface{}, 0, len(items)+2)
+		args = append(args, "qpush_back", name)
+		for _, item := range items {
+			args = append(args, item)
+		}
+		resp, err := dst.Do(args...)
+		if err := checkResp("qpush_back", resp, err); err != nil {
+			return err
+		}
+		atomic.AddInt64(&m.items, int64(len(items)))
+		size = offset + int64(len(items))
+		got, err := queueRange(dst, name, offset, len(items))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeQueue, name, queuePage(offset, items), got, "") {
+			equal = false
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.names, 1)
+	if !m.DeleteSource || !equal {
+		return nil
+	}
+	var now int64
+	err = src.ScanQueue(name, m.Page, func(offset int64, items []string) error {
+		got, err := queueRange(dst, name, offset, len(items))
+		if err != nil {
+			return err
+		}
+		if !m.compare(TypeQueue, name, queuePage(offset, items), got, "source changed") {
+			equal = false
+		}
+		now = offset + int64(len(items))
+		return nil
+	})
+	if err != nil || !equal {
+		return err
+	}
+	if now != size {
+		m.mismatch(Mismatch{Type: TypeQueue, Key: name, Reason: "source changed",
+			Source: strconv.FormatInt(now, 10) + " items", Dest: strconv.FormatInt(size, 10) + " items"})
+		return nil
+	}
+	return m.clear(src, "qclear", name)
+}
+
+func (m *Migration) clear(c *Client, cmd, name string) error {
+	resp, err := c.Do(cmd, name)
+	if err := checkResp(cmd, resp, err); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.deleted, 1)
+	return nil
+}
+
+// rateLimiter spaces out batches so they average rate items per second.
+// A nil limiter doesn't limit.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// wait blocks until n more items may be sent.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	d := time.Until(at)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
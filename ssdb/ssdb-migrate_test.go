@@ -0,0 +1,110 @@
+package ssdb_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func migrateFill(t *testing.T, s *ssdbtest.Server) {
+	t.Helper()
+	exec(t, s,
+		[]string{"setx", "a", "1", "100"}, []string{"set", "b", "2"}, []string{"set", "c", "3"},
+		[]string{"hset", "h", "f", "1"}, []string{"hset", "h", "g", "2"}, []string{"hset", "h", "i", "3"},
+		[]string{"zset", "z", "m", "1"}, []string{"zset", "z", "n", "-2"}, []string{"zset", "z", "o", "3"},
+		[]string{"qpush_back", "q", "x", "y", "z"},
+	)
+}
+
+func TestMigrate(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	migrateFill(t, src)
+	exec(t, dst, []string{"qpush_back", "q", "stale"}, []string{"set", "other", "kept"})
+	c, d := connect(t, src), connect(t, dst)
+
+	m := ssdb.NewMigration(c, d)
+	m.Page, m.Workers = 2, 2
+	r, err := m.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Mismatches) != 0 || r.Names != 6 || r.Items != 12 || r.Deleted != 0 {
+		t.Fatalf("report %+v", r)
+	}
+	// the copy replaced the queue and left the other keys alone
+	if got := dst.Exec([]string{"qrange", "q", "0", "10"}); !reflect.DeepEqual(got, []string{"ok", "x", "y", "z"}) {
+		t.Fatalf("queue %v", got)
+	}
+	if got := dst.Exec([]string{"get", "other"}); got[0] != "ok" {
+		t.Fatalf("destination key %v", got)
+	}
+	if ttl := dst.Exec([]string{"ttl", "a"}); ttl[1] == "-1" || ttl[1] == "0" {
+		t.Fatalf("ttl not migrated: %v", ttl)
+	}
+	if ttl := dst.Exec([]string{"ttl", "b"}); ttl[1] != "-1" {
+		t.Fatalf("key without ttl got %v", ttl)
+	}
+	diff, err := ssdb.NewDiff(c, d).Run(context.Background())
+	if err != nil || len(diff.Mismatches) != 1 || diff.Mismatches[0].Key != "other" {
+		t.Fatalf("diff after the migration %v %+v", err, diff)
+	}
+}
+
+func TestMigrateDeleteSource(t *testing.T) {
+	src, dst := ssdbtest.NewServer(), ssdbtest.NewServer()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	migrateFill(t, src)
+	// the destination keeps an old b and loses the field g of every hash
+	dst.Handle("set", func(args []string) []string {
+		if args[1] == "b" {
+			return dst.Exec([]string{"setnx", "b", "old"})
+		}
+		return dst.Exec(append([]string{"setnx"}, args[1:]...))
+	})
+	dst.Handle("multi_hset", func(args []string) []string {
+		for i := 2; i+1 < len(args); i += 2 {
+			if args[i] != "g" {
+				dst.Exec([]string{"hset", args[1], args[i], args[i+1]})
+			}
+		}
+		return []string{"ok", "0"}
+	})
+	c, d := connect(t, src), connect(t, dst)
+
+	m := ssdb.NewMigration(c, d)
+	m.Page = 2
+	m.DeleteSource = true
+	r, err := m.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`hash h g missing "2" ""`,
+		`kv b  differs "2" "old"`,
+	}
+	if got := mismatches(&ssdb.DiffReport{Mismatches: r.Mismatches}); !reflect.DeepEqual(got, want) || r.Mismatched != 2 {
+		t.Fatalf("mismatches %v, want %v", got, want)
+	}
+
+	// only what was verified is gone from the source
+	if r.Deleted != 4 {
+		t.Fatalf("%d deleted", r.Deleted)
+	}
+	for _, cmd := range [][]string{{"get", "a"}, {"get", "c"}, {"zsize", "z"}, {"qsize", "q"}} {
+		if resp := src.Exec(cmd); resp[0] != "not_found" && !(len(resp) == 2 && resp[1] == "0") {
+			t.Errorf("%v still in the source: %v", cmd, resp)
+		}
+	}
+	if resp := src.Exec([]string{"get", "b"}); resp[0] != "ok" || resp[1] != "2" {
+		t.Errorf("mismatched key deleted: %v", resp)
+	}
+	if resp := src.Exec([]string{"hsize", "h"}); resp[0] != "ok" || resp[1] != "3" {
+		t.Errorf("mismatched hash deleted: %v", resp)
+	}
+}
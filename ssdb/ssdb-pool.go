@@ -0,0 +1,179 @@
+package ssdb
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool spreads commands over several connections to one server. A Client
+// runs one command at a time, a Pool of n clients runs up to n at once.
+type Pool struct {
+	Node    Node
+	clients []*Client
+	next    uint64
+	gets    uint64
+}
+
+// NewPool opens size connections to node. Like Connect, connections that
+// fail are retried in the background and the first error is returned.
+func NewPool(node Node, size int) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{Node: node}
+	var firstErr error
+	for i := 0; i < size; i++ {
+		c, err := Connect(node.Ip, node.Port, node.Password)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("pool %s: %v", node.Addr(), err)
+		}
+		p.clients = append(p.clients, c)
+	}
+	return p, firstErr
+}
+
+// Get returns the next connected client, round robin. When none is
+// connected it returns one anyway, its commands fail until it reconnects.
+func (p *Pool) Get() *Client {
+	atomic.AddUint64(&p.gets, 1)
+	n := atomic.AddUint64(&p.next, 1)
+	for i := range p.clients {
+		c := p.clients[(n+uint64(i))%uint64(len(p.clients))]
+		if c.ready() {
+			return c
+		}
+	}
+	return p.clients[n%uint64(len(p.clients))]
+}
+
+// Clients returns every client of the pool.
+func (p *Pool) Clients() []*Client {
+	return p.clients
+}
+
+func (p *Pool) Do(args ...interface{}) ([]string, error) {
+	return p.Get().Do(args...)
+}
+
+func (p *Pool) ProcessCmd(cmd string, args []interface{}) (interface{}, error) {
+	return p.Get().ProcessCmd(cmd, args)
+}
+
+func (p *Pool) Pipeline(args [][]interface{}) ([][]string, error) {
+	return p.Get().Pipeline(args)
+}
+
+// Use adds interceptors to every client of the pool.
+func (p *Pool) Use(interceptors ...Interceptor) {
+	for _, c := range p.clients {
+		c.Use(interceptors...)
+	}
+}
+
+// Stats returns the metrics of every client.
+func (p *Pool) Stats() []Stats {
+	var stats []Stats
+	for _, c := range p.clients {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+// PoolStats is a snapshot of a pool. A client is in use while it runs a
+// command and idle while it is connected and runs none.
+type PoolStats struct {
+	Addr         string
+	Size         int
+	InUse        int
+	Idle         int
+	Gets         uint64 // Get calls, Do, ProcessCmd and Pipeline included
+	DialFailures uint64 // failed connects of all clients
+	Clients      []Stats
+}
+
+// PoolStats returns the pool counters along with the metrics of every client.
+func (p *Pool) PoolStats() PoolStats {
+	s := PoolStats{
+		Addr:    p.Node.Addr(),
+		Size:    len(p.clients),
+		Gets:    atomic.LoadUint64(&p.gets),
+		Clients: p.Stats(),
+	}
+	for _, cs := range s.Clients {
+		s.DialFailures += cs.DialFailures
+		switch {
+		case cs.InFlight > 0:
+			s.InUse++
+		case cs.Connected:
+			s.Idle++
+		}
+	}
+	return s
+}
+
+// PublishExpvar exports the pool's PoolStats as the expvar variable name.
+func (p *Pool) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return p.PoolStats()
+	}))
+}
+
+// WritePrometheus writes the pool gauges and counters followed by the
+// metrics of its clients in the Prometheus text exposition format.
+func (s PoolStats) WritePrometheus(w io.Writer) {
+	writePoolStatsPrometheus(w, []PoolStats{s})
+}
+
+func writePoolStatsPrometheus(w io.Writer, pools []PoolStats) {
+	metrics := []struct {
+		name, help, typ string
+		value           func(s PoolStats) uint64
+	}{
+		{"ssdb_pool_size", "Connections of the pool.", "gauge", func(s PoolStats) uint64 { return uint64(s.Size) }},
+		{"ssdb_pool_in_use", "Connections running a command.", "gauge", func(s PoolStats) uint64 { return uint64(s.InUse) }},
+		{"ssdb_pool_idle", "Connected connections running no command.", "gauge", func(s PoolStats) uint64 { return uint64(s.Idle) }},
+		{"ssdb_pool_gets_total", "Connections handed out by the pool.", "counter", func(s PoolStats) uint64 { return s.Gets }},
+		{"ssdb_pool_dial_failures_total", "Failed connects of the pool's connections.", "counter", func(s PoolStats) uint64 { return s.DialFailures }},
+	}
+	var clients []Stats
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range pools {
+			fmt.Fprintf(w, "%s{pool=%s} %d\n", m.name, promQuote(s.Addr), m.value(s))
+		}
+	}
+	for _, s := range pools {
+		clients = append(clients, s.Clients...)
+	}
+	writeStatsPrometheus(w, clients)
+}
+
+// PoolMetricsHandler serves the metrics of the given pools and their
+// clients in the Prometheus text format.
+func PoolMetricsHandler(pools ...*Pool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var stats []PoolStats
+		for _, p := range pools {
+			stats = append(stats, p.PoolStats())
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePoolStatsPrometheus(w, stats)
+	})
+}
+
+func (p *Pool) Close() error {
+	var wg sync.WaitGroup
+	for _, c := range p.clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			c.Close()
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,83 @@
+package ssdb_test
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func node(t *testing.T, addr string) ssdb.Node {
+	t.Helper()
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	return ssdb.Node{Ip: host, Port: port}
+}
+
+func TestPoolStats(t *testing.T) {
+	s := ssdbtest.NewServer()
+	defer s.Close()
+	block := make(chan struct{})
+	s.Handle("block", func(args []string) []string {
+		<-block
+		return []string{"ok"}
+	})
+	p, err := ssdb.NewPool(node(t, s.Addr()), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.Do("set", "k", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		p.Do("block")
+		close(done)
+	}()
+	waitFor(t, "a client in use", func() bool { return p.PoolStats().InUse == 1 })
+	st := p.PoolStats()
+	if st.Size != 3 || st.Idle != 2 || st.Gets != 5 || st.DialFailures != 0 || len(st.Clients) != 3 {
+		t.Fatalf("stats %+v", st)
+	}
+	close(block)
+	<-done
+
+	var b bytes.Buffer
+	p.PoolStats().WritePrometheus(&b)
+	pool := `{pool="` + s.Addr() + `"}`
+	for _, want := range []string{
+		"ssdb_pool_size" + pool + " 3\n",
+		"ssdb_pool_in_use" + pool + " 0\n",
+		"ssdb_pool_idle" + pool + " 3\n",
+		"ssdb_pool_gets_total" + pool + " 5\n",
+		"ssdb_pool_dial_failures_total" + pool + " 0\n",
+		"ssdb_client_dial_failures_total{",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in\n%s", want, b.String())
+		}
+	}
+}
+
+func TestPoolDialFailures(t *testing.T) {
+	s := ssdbtest.NewServer()
+	addr := s.Addr()
+	s.Close()
+	p, err := ssdb.NewPool(node(t, addr), 2)
+	if err == nil {
+		t.Fatal("pool of a closed server connected")
+	}
+	defer p.Close()
+	st := p.PoolStats()
+	if st.DialFailures < 2 || st.Idle != 0 || st.InUse != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+}
@@ -0,0 +1,356 @@
+package ssdb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReadPolicy selects the slave serving a read.
+type ReadPolicy int
+
+const (
+	ReadRoundRobin ReadPolicy = iota
+	ReadLeastLatency
+)
+
+// commands answered by a slave
+var readCmds = map[string]bool{
+	"get": true, "exists": true, "ttl": true, "scan": true, "rscan": true, "keys": true, "rkeys": true,
+	"multi_get": true, "multi_exists": true, "getbit": true, "countbit": true, "substr": true, "strlen": true,
+	"hget": true, "hexists": true, "hsize": true, "hlist": true, "hrlist": true, "hkeys": true, "hgetall": true,
+	"hscan": true, "hrscan": true, "multi_hget": true, "multi_hexists": true, "multi_hsize": true,
+	"zget": true, "zexists": true, "zsize": true, "zrank": true, "zrrank": true, "zrange": true, "zrrange": true,
+	"zscan": true, "zrscan": true, "zkeys": true, "zlist": true, "zrlist": true, "zcount": true, "zsum": true,
+	"zavg": true, "multi_zget": true, "multi_zexists": true, "multi_zsize": true,
+	"qsize": true, "qfront": true, "qback": true, "qget": true, "qslice": true, "qrange": true, "qlist": true, "qrlist": true,
+}
+
+// IsReadCommand reports whether cmd only reads data.
+func IsReadCommand(cmd string) bool {
+	return readCmds[cmd]
+}
+
+type replica struct {
+	client  *Client
+	latency int64 // moving average in nanoseconds
+}
+
+func (r *replica) healthy() bool {
+	return r.client.ready()
+}
+
+// ReplicatedClient sends writes to the master and reads to the healthy slaves.
+// Reads fall back to the master when no slave is healthy, and a read whose
+// slave connection fails is sent again to the master.
+type ReplicatedClient struct {
+	Master     *Client
+	Slaves     []*Client
+	Policy     ReadPolicy
+	replicas   []*replica
+	next       *uint64
+	consistent bool
+}
+
+// NewReplicatedClient connects to the master and every slave. Like Connect,
+// servers that can't be reached are retried in the background.
+func NewReplicatedClient(master Node, slaves []Node, policy ReadPolicy) (*ReplicatedClient, error) {
+	rc := &ReplicatedClient{Policy: policy, next: new(uint64)}
+	var firstErr error
+	var err error
+	rc.Master, err = Connect(master.Ip, master.Port, master.Password)
+	if err != nil {
+		firstErr = fmt.Errorf("master %s: %v", master.Addr(), err)
+	}
+	for _, n := range slaves {
+		client, err := Connect(n.Ip, n.Port, n.Password)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("slave %s: %v", n.Addr(), err)
+		}
+		r := &replica{client: client}
+		client.Use(r.measure)
+		rc.Slaves = append(rc.Slaves, client)
+		rc.replicas = append(rc.replicas, r)
+	}
+	return rc, firstErr
+}
+
+// failedCallLatency is the round trip time counted for a call that failed
+// with a connection error, so a failing slave loses least latency reads.
+const failedCallLatency = time.Second
+
+// measure keeps a moving average of the replica's round trip time.
+func (r *replica) measure(next Handler) Handler {
+	return func(cmd *Cmd) error {
+		err := next(cmd)
+		if err != nil && !connectionError(err) {
+			return err
+		}
+		d := int64(cmd.Duration)
+		if err != nil && d < int64(failedCallLatency) {
+			d = int64(failedCallLatency)
+		}
+		old := atomic.LoadInt64(&r.latency)
+		if old != 0 {
+			d = old + (d-old)/8
+		}
+		atomic.StoreInt64(&r.latency, d)
+		return err
+	}
+}
+
+// Consistent returns a view of rc reading from the master, for read-your-writes:
+//
+//	rc.Set("a", "1")
+//	rc.Consistent().Get("a")
+func (rc *ReplicatedClient) Consistent() *ReplicatedClient {
+	view := *rc
+	view.consistent = true
+	return &view
+}
+
+// reader returns the client serving the next read.
+func (rc *ReplicatedClient) reader() *Client {
+	if rc.consistent {
+		return rc.Master
+	}
+	var healthy []*replica
+	for _, r := range rc.replicas {
+		if r.healthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return rc.Master
+	}
+	if rc.Policy == ReadLeastLatency {
+		latency := make([]int64, len(healthy))
+		var sum, measured int64
+		for i, r := range healthy {
+			latency[i] = atomic.LoadInt64(&r.latency)
+			if latency[i] != 0 {
+				sum += latency[i]
+				measured++
+			}
+		}
+		// a slave without calls yet counts as average, not as the fastest
+		for i := range latency {
+			if latency[i] == 0 && measured > 0 {
+				latency[i] = sum / measured
+			}
+		}
+		best := 0
+		for i := range healthy[1:] {
+			if latency[i+1] < latency[best] {
+				best = i + 1
+			}
+		}
+		return healthy[best].client
+	}
+	n := atomic.AddUint64(rc.next, 1)
+	return healthy[n%uint64(len(healthy))].client
+}
+
+// read runs fn on the client serving the next read, and again on the master
+// when the slave lost its connection on the way. Error statuses of the slave,
+// not_found included, are its answer and are not retried.
+func read[T any](rc *ReplicatedClient, fn func(c *Client) (T, error)) (T, error) {
+	c := rc.reader()
+	v, err := fn(c)
+	if err != nil && c != rc.Master && connectionError(err) && !c.ready() {
+		return fn(rc.Master)
+	}
+	return v, err
+}
+
+// SlaveLatency returns the moving average round trip time of every slave.
+func (rc *ReplicatedClient) SlaveLatency() []time.Duration {
+	var list []time.Duration
+	for _, r := range rc.replicas {
+		list = append(list, time.Duration(atomic.LoadInt64(&r.latency)))
+	}
+	return list
+}
+
+// Use adds interceptors to the master and every slave.
+func (rc *ReplicatedClient) Use(interceptors ...Interceptor) {
+	rc.Master.Use(interceptors...)
+	for _, c := range rc.Slaves {
+		c.Use(interceptors...)
+	}
+}
+
+// Stats returns the metrics of the master followed by the slaves.
+func (rc *ReplicatedClient) Stats() []Stats {
+	stats := []Stats{rc.Master.Stats()}
+	for _, c := range rc.Slaves {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+func (rc *ReplicatedClient) Close() error {
+	var wg sync.WaitGroup
+	for _, c := range append([]*Client{rc.Master}, rc.Slaves...) {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			c.Close()
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Do runs read commands on a slave and everything else on the master.
+func (rc *ReplicatedClient) Do(args ...interface{}) ([]string, error) {
+	if len(args) > 0 && IsReadCommand(argString(args[0])) {
+		return read(rc, func(c *Client) ([]string, error) { return c.Do(args...) })
+	}
+	return rc.Master.Do(args...)
+}
+
+func (rc *ReplicatedClient) ProcessCmd(cmd string, args []interface{}) (interface{}, error) {
+	if IsReadCommand(cmd) {
+		return read(rc, func(c *Client) (interface{}, error) { return c.ProcessCmd(cmd, args) })
+	}
+	return rc.Master.ProcessCmd(cmd, args)
+}
+
+func (rc *ReplicatedClient) Set(key string, val string) (interface{}, error) {
+	return rc.Master.Set(key, val)
+}
+
+func (rc *ReplicatedClient) Get(key string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.Get(key) })
+}
+
+func (rc *ReplicatedClient) Del(key string) (interface{}, error) {
+	return rc.Master.Del(key)
+}
+
+func (rc *ReplicatedClient) SetX(key string, val string, ttl int) (interface{}, error) {
+	return rc.Master.SetX(key, val, ttl)
+}
+
+func (rc *ReplicatedClient) Scan(start string, end string, limit int) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.Scan(start, end, limit) })
+}
+
+func (rc *ReplicatedClient) Expire(key string, ttl int) (interface{}, error) {
+	return rc.Master.Expire(key, ttl)
+}
+
+func (rc *ReplicatedClient) KeyTTL(key string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.KeyTTL(key) })
+}
+
+func (rc *ReplicatedClient) SetNew(key string, val string) (interface{}, error) {
+	return rc.Master.SetNew(key, val)
+}
+
+func (rc *ReplicatedClient) GetSet(key string, val string) (interface{}, error) {
+	return rc.Master.GetSet(key, val)
+}
+
+func (rc *ReplicatedClient) Incr(key string, val int) (interface{}, error) {
+	return rc.Master.Incr(key, val)
+}
+
+func (rc *ReplicatedClient) Exists(key string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.Exists(key) })
+}
+
+func (rc *ReplicatedClient) MultiGet(keys []string) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.MultiGet(keys) })
+}
+
+func (rc *ReplicatedClient) MultiSet(data map[string]string) (interface{}, error) {
+	return rc.Master.MultiSet(data)
+}
+
+func (rc *ReplicatedClient) MultiDel(keys []string) (interface{}, error) {
+	return rc.Master.MultiDel(keys)
+}
+
+func (rc *ReplicatedClient) HashSet(hash string, key string, val string) (interface{}, error) {
+	return rc.Master.HashSet(hash, key, val)
+}
+
+func (rc *ReplicatedClient) MultiHashSet(parts []HashData, connNum int) (interface{}, error) {
+	return rc.Master.MultiHashSet(parts, connNum)
+}
+
+// MultiMode and Pipeline may mix reads and writes, so they always run on the master.
+func (rc *ReplicatedClient) MultiMode(args [][]interface{}) ([]string, error) {
+	return rc.Master.MultiMode(args)
+}
+
+func (rc *ReplicatedClient) Pipeline(args [][]interface{}) ([][]string, error) {
+	return rc.Master.Pipeline(args)
+}
+
+func (rc *ReplicatedClient) HashGet(hash string, key string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.HashGet(hash, key) })
+}
+
+func (rc *ReplicatedClient) HashDel(hash string, key string) (interface{}, error) {
+	return rc.Master.HashDel(hash, key)
+}
+
+func (rc *ReplicatedClient) HashIncr(hash string, key string, val int) (interface{}, error) {
+	return rc.Master.HashIncr(hash, key, val)
+}
+
+func (rc *ReplicatedClient) HashExists(hash string, key string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.HashExists(hash, key) })
+}
+
+func (rc *ReplicatedClient) HashSize(hash string) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.HashSize(hash) })
+}
+
+func (rc *ReplicatedClient) HashList(start string, end string, limit int) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.HashList(start, end, limit) })
+}
+
+func (rc *ReplicatedClient) HashKeys(hash string, start string, end string, limit int) (interface{}, error) {
+	return read(rc, func(c *Client) (interface{}, error) { return c.HashKeys(hash, start, end, limit) })
+}
+
+func (rc *ReplicatedClient) HashKeysAll(hash string) ([]string, error) {
+	return read(rc, func(c *Client) ([]string, error) { return c.HashKeysAll(hash) })
+}
+
+func (rc *ReplicatedClient) HashGetAll(hash string) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.HashGetAll(hash) })
+}
+
+func (rc *ReplicatedClient) HashGetAllLite(hash string) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.HashGetAllLite(hash) })
+}
+
+func (rc *ReplicatedClient) HashScan(hash string, start string, end string, limit int) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.HashScan(hash, start, end, limit) })
+}
+
+func (rc *ReplicatedClient) HashRScan(hash string, start string, end string, limit int) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.HashRScan(hash, start, end, limit) })
+}
+
+func (rc *ReplicatedClient) HashMultiSet(hash string, data map[string]string) (interface{}, error) {
+	return rc.Master.HashMultiSet(hash, data)
+}
+
+func (rc *ReplicatedClient) HashMultiGet(hash string, keys []string) (map[string]string, error) {
+	return read(rc, func(c *Client) (map[string]string, error) { return c.HashMultiGet(hash, keys) })
+}
+
+func (rc *ReplicatedClient) HashMultiDel(hash string, keys []string) (interface{}, error) {
+	return rc.Master.HashMultiDel(hash, keys)
+}
+
+func (rc *ReplicatedClient) HashClear(hash string) (interface{}, error) {
+	return rc.Master.HashClear(hash)
+}
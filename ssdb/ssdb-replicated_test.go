@@ -0,0 +1,87 @@
+package ssdb_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestLeastLatencyNewSlave(t *testing.T) {
+	master, fast, fresh := ssdbtest.NewServer(), ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer master.Close()
+	defer fast.Close()
+	defer fresh.Close()
+	var freshGets int64
+	fresh.Handle("get", func(args []string) []string {
+		atomic.AddInt64(&freshGets, 1)
+		return []string{"not_found"}
+	})
+	rc, err := ssdb.NewReplicatedClient(node(t, master.Addr()),
+		[]ssdb.Node{node(t, fast.Addr()), node(t, fresh.Addr())}, ssdb.ReadLeastLatency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	// the first read measures the first slave, the second one has no
+	// latency yet and must not look like the fastest
+	for i := 0; i < 5; i++ {
+		rc.Do("get", "a")
+	}
+	if n := atomic.LoadInt64(&freshGets); n != 0 {
+		t.Fatalf("unmeasured slave served %d of 5 reads", n)
+	}
+}
+
+func TestLeastLatencyFailedCall(t *testing.T) {
+	master, slave := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer master.Close()
+	defer slave.Close()
+	rc, err := ssdb.NewReplicatedClient(node(t, master.Addr()), []ssdb.Node{node(t, slave.Addr())}, ssdb.ReadLeastLatency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := rc.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+	slave.DropConnections()
+	// the master answers in place of the slave
+	if _, err := rc.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if d := rc.SlaveLatency()[0]; d < 100*time.Millisecond {
+		t.Fatalf("latency after a failed call %v", d)
+	}
+}
+
+func TestReplicatedReadFallsBackToMaster(t *testing.T) {
+	master, slave := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer master.Close()
+	defer slave.Close()
+	master.Exec([]string{"set", "a", "master"})
+	master.Exec([]string{"set", "b", "master"})
+	slave.Exec([]string{"set", "a", "slave"})
+	rc, err := ssdb.NewReplicatedClient(node(t, master.Addr()), []ssdb.Node{node(t, slave.Addr())}, ssdb.ReadRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if v, err := rc.Get("a"); err != nil || v != "slave" {
+		t.Fatalf("get %v %v", v, err)
+	}
+	slave.DropConnections()
+	if v, err := rc.Get("a"); err != nil || v != "master" {
+		t.Fatalf("get over a dropped slave connection %v %v", v, err)
+	}
+
+	// not_found is the slave's answer, the master isn't asked
+	waitFor(t, "the slave reconnect", func() bool { return rc.Slaves[0].Stats().Reconnects == 1 })
+	if v, err := rc.Get("b"); err == nil {
+		t.Fatalf("get of a key missing on the slave answered %v", v)
+	}
+}
@@ -0,0 +1,296 @@
+package ssdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Protocol is the wire format of a Client.
+type Protocol int
+
+const (
+	ProtocolSSDB Protocol = iota // native "len\ndata\n" blocks
+	ProtocolRESP                 // RESP2, served by the Redis layer of ssdb-server
+)
+
+func (p Protocol) String() string {
+	if p == ProtocolRESP {
+		return "resp"
+	}
+	return "ssdb"
+}
+
+// ConnectProtocol is Connect with a selectable wire format. Over RESP the
+// replies are mapped back to the native responses, so Do and the typed API
+// behave the same:
+//
+//	status   +OK     => ok 1 (other status texts: ok <text>)
+//	integer  :n      => ok n
+//	bulk     $n      => ok data
+//	nil      $-1 *-1 => not_found
+//	array    *n      => ok item...  (nested arrays flattened, nil items empty)
+//	error    -ERR m  => error m
+func ConnectProtocol(ip string, port int, auth string, protocol Protocol) (*Client, error) {
+	log.Printf("SSDB Client Version:%s\n", version)
+	var c Client
+	c.Ip = ip
+	c.Port = port
+	c.Password = auth
+	c.Id = fmt.Sprintf("Cl-%d", time.Now().UnixNano())
+	c.mu = &sync.Mutex{}
+	c.protocol = protocol
+	err := c.Connect()
+	if err != nil {
+		if debug {
+			log.Printf("SSDB Client Connect failed:%s:%d error:%v\n", ip, port, err)
+		}
+		go c.RetryConnect()
+	}
+	return &c, err
+}
+
+// Protocol returns the wire format of the client.
+func (c *Client) Protocol() Protocol {
+	return c.protocol
+}
+
+// ErrIncomplete is returned by ParseRESP when buf holds no complete value yet.
+var ErrIncomplete = errors.New("incomplete RESP value")
+
+// RESPValue is a RESP2 value. Type is one of '+', '-', ':', '$' or '*'.
+type RESPValue struct {
+	Type  byte
+	Str   string // simple string, error or bulk data
+	Int   int64
+	Null  bool // nil bulk string or nil array
+	Array []RESPValue
+}
+
+// RESPCommand returns a command as an array of bulk strings.
+func RESPCommand(args []string) RESPValue {
+	v := RESPValue{Type: '*', Array: make([]RESPValue, len(args))}
+	for i, a := range args {
+		v.Array[i] = RESPValue{Type: '$', Str: a}
+	}
+	return v
+}
+
+// Strings returns the items of an array, or the value itself as a single item.
+func (v RESPValue) Strings() []string {
+	if v.Type != '*' {
+		if v.Type == ':' {
+			return []string{strconv.FormatInt(v.Int, 10)}
+		}
+		return []string{v.Str}
+	}
+	var list []string
+	for _, item := range v.Array {
+		list = append(list, item.Strings()...)
+	}
+	return list
+}
+
+// Response maps a RESP reply to a native SSDB response, see ConnectProtocol.
+func (v RESPValue) Response() []string {
+	switch {
+	case v.Null:
+		return []string{"not_found"}
+	case v.Type == '-':
+		msg := v.Str
+		if len(msg) > 4 && msg[:4] == "ERR " {
+			msg = msg[4:]
+		}
+		return []string{"error", msg}
+	case v.Type == '+':
+		if v.Str == "OK" {
+			return []string{"ok", "1"}
+		}
+		return []string{"ok", v.Str}
+	}
+	return append([]string{"ok"}, v.Strings()...)
+}
+
+// AppendRESP appends the encoding of v to buf.
+func AppendRESP(buf []byte, v RESPValue) []byte {
+	switch v.Type {
+	case '+', '-':
+		buf = append(buf, v.Type)
+		buf = append(buf, v.Str...)
+	case ':':
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, v.Int, 10)
+	case '$':
+		if v.Null {
+			return append(buf, "$-1\r\n"...)
+		}
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(v.Str)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, v.Str...)
+	case '*':
+		if v.Null {
+			return append(buf, "*-1\r\n"...)
+		}
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(v.Array)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, item := range v.Array {
+			buf = AppendRESP(buf, item)
+		}
+		return buf
+	}
+	return append(buf, '\r', '\n')
+}
+
+// WriteRESP writes one RESP value to w.
+func WriteRESP(w io.Writer, v RESPValue) error {
+	_, err := w.Write(AppendRESP(nil, v))
+	return err
+}
+
+// ParseRESP parses the first value of buf and returns it with the number of
+// bytes it used. It returns ErrIncomplete when more data is needed.
+func ParseRESP(buf []byte) (RESPValue, int, error) {
+	var v RESPValue
+	line, n := respLine(buf)
+	if n == 0 {
+		return v, 0, ErrIncomplete
+	}
+	if len(line) == 0 {
+		return v, 0, fmt.Errorf("bad RESP: empty line")
+	}
+	v.Type = line[0]
+	body := string(line[1:])
+	switch v.Type {
+	case '+', '-':
+		v.Str = body
+		return v, n, nil
+	case ':':
+		i, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return v, 0, fmt.Errorf("bad RESP integer:%q", body)
+		}
+		v.Int = i
+		return v, n, nil
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < -1 {
+			return v, 0, fmt.Errorf("bad RESP bulk length:%q", body)
+		}
+		if size == -1 {
+			v.Null = true
+			return v, n, nil
+		}
+		if len(buf) < n+size+2 {
+			return v, 0, ErrIncomplete
+		}
+		if buf[n+size] != '\r' || buf[n+size+1] != '\n' {
+			return v, 0, fmt.Errorf("bad RESP bulk terminator")
+		}
+		v.Str = string(buf[n : n+size])
+		return v, n + size + 2, nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil || count < -1 {
+			return v, 0, fmt.Errorf("bad RESP array length:%q", body)
+		}
+		if count == -1 {
+			v.Null = true
+			return v, n, nil
+		}
+		v.Array = make([]RESPValue, 0, count)
+		for i := 0; i < count; i++ {
+			item, m, err := ParseRESP(buf[n:])
+			if err != nil {
+				return v, 0, err
+			}
+			v.Array = append(v.Array, item)
+			n += m
+		}
+		return v, n, nil
+	}
+	return v, 0, fmt.Errorf("bad RESP type:%q", v.Type)
+}
+
+// respLine returns the first CRLF terminated line of buf without the CRLF
+// and the bytes used, 0 when there is no complete line.
+func respLine(buf []byte) ([]byte, int) {
+	i := bytes.Index(buf, []byte("\r\n"))
+	if i < 0 {
+		return nil, 0
+	}
+	return buf[:i], i + 2
+}
+
+// RESPReader reads RESP values from a stream.
+type RESPReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func NewRESPReader(r io.Reader) *RESPReader {
+	return &RESPReader{r: r}
+}
+
+// Read returns the next value.
+func (r *RESPReader) Read() (RESPValue, error) {
+	var tmp [4096]byte
+	for {
+		if len(r.buf) > 0 {
+			v, n, err := ParseRESP(r.buf)
+			if err == nil {
+				r.buf = r.buf[n:]
+				return v, nil
+			}
+			if err != ErrIncomplete {
+				return v, err
+			}
+		}
+		n, err := r.r.Read(tmp[:])
+		r.buf = append(r.buf, tmp[:n]...)
+		if err != nil && n == 0 {
+			return RESPValue{}, err
+		}
+	}
+}
+
+// sendRESP writes a command as a RESP array of bulk strings.
+func (c *Client) sendRESP(args []interface{}) error {
+	var list []string
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case []string:
+			list = append(list, arg...)
+		default:
+			s, err := argToString(arg)
+			if err != nil {
+				return err
+			}
+			list = append(list, s)
+		}
+	}
+	n, err := c.sock.Write(AppendRESP(nil, RESPCommand(list)))
+	atomic.AddUint64(&c.metrics.bytesOut, uint64(n))
+	return err
+}
+
+// parseRESP takes the next reply from the receive buffer, an empty response
+// means it is not complete yet.
+func (c *Client) parseRESP() ([]string, error) {
+	v, n, err := ParseRESP(c.recv_buf.Bytes())
+	if err == ErrIncomplete {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.recv_buf.Next(n)
+	return v.Response(), nil
+}
@@ -0,0 +1,146 @@
+package ssdb_test
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+func TestParseRESP(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ssdb.RESPValue
+		n    int
+		resp []string
+	}{
+		{"+OK\r\n", ssdb.RESPValue{Type: '+', Str: "OK"}, 5, []string{"ok", "1"}},
+		{"+QUEUED\r\nrest", ssdb.RESPValue{Type: '+', Str: "QUEUED"}, 9, []string{"ok", "QUEUED"}},
+		{"-ERR bad\r\n", ssdb.RESPValue{Type: '-', Str: "ERR bad"}, 10, []string{"error", "bad"}},
+		{"-WRONGTYPE x\r\n", ssdb.RESPValue{Type: '-', Str: "WRONGTYPE x"}, 14, []string{"error", "WRONGTYPE x"}},
+		{":-42\r\n", ssdb.RESPValue{Type: ':', Int: -42}, 6, []string{"ok", "-42"}},
+		{"$-1\r\n", ssdb.RESPValue{Type: '$', Null: true}, 5, []string{"not_found"}},
+		{"$0\r\n\r\n", ssdb.RESPValue{Type: '$'}, 6, []string{"ok", ""}},
+		{"$4\r\na\r\nb\r\n", ssdb.RESPValue{Type: '$', Str: "a\r\nb"}, 10, []string{"ok", "a\r\nb"}},
+		{"*-1\r\n", ssdb.RESPValue{Type: '*', Null: true}, 5, []string{"not_found"}},
+		{"*0\r\n", ssdb.RESPValue{Type: '*', Array: []ssdb.RESPValue{}}, 4, []string{"ok"}},
+		{"*3\r\n$1\r\na\r\n*2\r\n:1\r\n$-1\r\n+b\r\n", ssdb.RESPValue{Type: '*', Array: []ssdb.RESPValue{
+			{Type: '$', Str: "a"},
+			{Type: '*', Array: []ssdb.RESPValue{{Type: ':', Int: 1}, {Type: '$', Null: true}}},
+			{Type: '+', Str: "b"},
+		}}, 28, []string{"ok", "a", "1", "", "b"}},
+	} {
+		v, n, err := ssdb.ParseRESP([]byte(tc.in))
+		if err != nil || n != tc.n || !reflect.DeepEqual(v, tc.want) {
+			t.Errorf("%q: %+v %d %v, want %+v %d", tc.in, v, n, err, tc.want, tc.n)
+			continue
+		}
+		if got := v.Response(); !reflect.DeepEqual(got, tc.resp) {
+			t.Errorf("%q: response %q, want %q", tc.in, got, tc.resp)
+		}
+		// every value encodes back to what it was parsed from
+		if out := string(ssdb.AppendRESP(nil, v)); out != tc.in[:n] {
+			t.Errorf("%q: encoded as %q", tc.in, out)
+		}
+	}
+
+	// every cut of a complete value is incomplete
+	full := "*2\r\n$3\r\nabc\r\n:7\r\n"
+	for i := 0; i < len(full); i++ {
+		if _, _, err := ssdb.ParseRESP([]byte(full[:i])); err != ssdb.ErrIncomplete {
+			t.Errorf("%q: %v, want ErrIncomplete", full[:i], err)
+		}
+	}
+
+	for _, in := range []string{"\r\n", "?x\r\n", ":x\r\n", "$x\r\n", "$-2\r\n", "*-2\r\n", "$1\r\nab\r\n", "*1\r\n?\r\n"} {
+		if _, _, err := ssdb.ParseRESP([]byte(in)); err == nil || err == ssdb.ErrIncomplete {
+			t.Errorf("%q: %v, want a parse error", in, err)
+		}
+	}
+}
+
+// respServer answers each RESP command by its name from replies and sends
+// the commands it got on the returned channel. A reply is written in two
+// parts, so the client has to wait for the rest of it.
+func respServer(t *testing.T, replies map[string]string) (*ssdb.Client, <-chan []string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	cmds := make(chan []string, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := ssdb.NewRESPReader(conn)
+		for {
+			v, err := r.Read()
+			if err != nil {
+				return
+			}
+			cmd := v.Strings()
+			cmds <- cmd
+			reply := replies[cmd[0]]
+			conn.Write([]byte(reply[:len(reply)/2]))
+			time.Sleep(5 * time.Millisecond)
+			if _, err := conn.Write([]byte(reply[len(reply)/2:])); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, p, _ := net.SplitHostPort(l.Addr().String())
+	port, _ := strconv.Atoi(p)
+	c, err := ssdb.ConnectProtocol("127.0.0.1", port, "", ssdb.ProtocolRESP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, cmds
+}
+
+func TestDoRESP(t *testing.T) {
+	c, cmds := respServer(t, map[string]string{
+		"set":   "+OK\r\n",
+		"get":   "$5\r\nv\r\nal\r\n",
+		"hget":  "$-1\r\n",
+		"multi": "*2\r\n*2\r\n$1\r\na\r\n:1\r\n$1\r\nb\r\n",
+		"bad":   "-ERR unknown command\r\n",
+	})
+	if c.Protocol() != ssdb.ProtocolRESP {
+		t.Fatalf("protocol %v", c.Protocol())
+	}
+
+	for _, tc := range []struct {
+		args []interface{}
+		sent []string
+		want []string
+	}{
+		{[]interface{}{"set", "k", 12}, []string{"set", "k", "12"}, []string{"ok", "1"}},
+		{[]interface{}{"get", "k"}, []string{"get", "k"}, []string{"ok", "v\r\nal"}},
+		{[]interface{}{"hget", "h", "f"}, []string{"hget", "h", "f"}, []string{"not_found"}},
+		{[]interface{}{"multi", []string{"x", "y"}}, []string{"multi", "x", "y"}, []string{"ok", "a", "1", "b"}},
+		{[]interface{}{"bad"}, []string{"bad"}, []string{"error", "unknown command"}},
+	} {
+		resp, err := c.Do(tc.args...)
+		if err != nil || !reflect.DeepEqual(resp, tc.want) {
+			t.Errorf("%v: %q %v, want %q", tc.args, resp, err, tc.want)
+		}
+		if sent := <-cmds; !reflect.DeepEqual(sent, tc.sent) {
+			t.Errorf("%v: sent %q, want %q", tc.args, sent, tc.sent)
+		}
+	}
+
+	// the typed API reads the mapped responses
+	if v, err := c.Get("k"); err != nil || v != "v\r\nal" {
+		t.Fatalf("get %v %v", v, err)
+	}
+	<-cmds
+}
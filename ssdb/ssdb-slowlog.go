@@ -0,0 +1,135 @@
+package ssdb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	slowLogMaxArgs   = 32
+	slowLogMaxArgLen = 128
+)
+
+// SlowLogEntry is a command that took longer than the slow log threshold.
+type SlowLogEntry struct {
+	Time        time.Time
+	Command     string
+	Args        []string // truncated like the redis slowlog
+	Duration    time.Duration
+	ClientId    string
+	Reconnected bool // the connection was lost while the command ran
+}
+
+type slowLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	entries   []SlowLogEntry
+	next      int
+	full      bool
+	callback  func(SlowLogEntry)
+}
+
+// SetSlowLog records commands slower than threshold in a ring buffer of size entries,
+// callback (may be nil) is called for every recorded entry.
+// Calling it again changes the settings and clears the buffer.
+func (c *Client) SetSlowLog(threshold time.Duration, size int, callback func(SlowLogEntry)) {
+	if size <= 0 {
+		size = 128
+	}
+	c.slowLog.mu.Lock()
+	installed := c.slowLog.entries != nil
+	c.slowLog.threshold = threshold
+	c.slowLog.entries = make([]SlowLogEntry, size)
+	c.slowLog.next = 0
+	c.slowLog.full = false
+	c.slowLog.callback = callback
+	c.slowLog.mu.Unlock()
+	if !installed {
+		c.Use(c.slowLogInterceptor)
+	}
+}
+
+// SlowLog returns the recorded slow commands, newest first.
+func (c *Client) SlowLog() []SlowLogEntry {
+	l := &c.slowLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	list := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return list
+}
+
+// ResetSlowLog drops all recorded slow commands.
+func (c *Client) ResetSlowLog() {
+	c.slowLog.mu.Lock()
+	c.slowLog.next = 0
+	c.slowLog.full = false
+	c.slowLog.mu.Unlock()
+}
+
+func (c *Client) slowLogInterceptor(next Handler) Handler {
+	return func(cmd *Cmd) error {
+		retries := atomic.LoadUint64(&c.metrics.retries)
+		err := next(cmd)
+		l := &c.slowLog
+		l.mu.Lock()
+		if cmd.Duration < l.threshold {
+			l.mu.Unlock()
+			return err
+		}
+		entry := SlowLogEntry{
+			Time:        cmd.Start,
+			Command:     cmd.Name,
+			Args:        truncateArgs(cmd),
+			Duration:    cmd.Duration,
+			ClientId:    c.Id,
+			Reconnected: retries != atomic.LoadUint64(&c.metrics.retries),
+		}
+		l.entries[l.next] = entry
+		l.next++
+		if l.next == len(l.entries) {
+			l.next = 0
+			l.full = true
+		}
+		callback := l.callback
+		l.mu.Unlock()
+		if callback != nil {
+			callback(entry)
+		}
+		return err
+	}
+}
+
+func truncateArgs(cmd *Cmd) []string {
+	args := cmd.Args
+	if cmd.Batch != nil {
+		args = nil
+		for _, v := range cmd.Batch {
+			args = append(args, v.Name)
+		}
+	}
+	var list []string
+	for i, arg := range args {
+		if i == slowLogMaxArgs-1 && len(args) > slowLogMaxArgs {
+			list = append(list, fmt.Sprintf("... (%d more arguments)", len(args)-i))
+			break
+		}
+		s := fmt.Sprintf("%v", arg)
+		if b, ok := arg.([]byte); ok {
+			s = string(b)
+		}
+		if len(s) > slowLogMaxArgLen {
+			s = fmt.Sprintf("%s... (%d more bytes)", s[:slowLogMaxArgLen], len(s)-slowLogMaxArgLen)
+		}
+		list = append(list, s)
+	}
+	return list
+}
@@ -0,0 +1,101 @@
+package ssdb_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestSlowLogThreshold(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	s.Handle("slow", func(args []string) []string {
+		time.Sleep(50 * time.Millisecond)
+		return []string{"ok"}
+	})
+	c := connect(t, s)
+	var called []ssdb.SlowLogEntry
+	c.SetSlowLog(30*time.Millisecond, 10, func(e ssdb.SlowLogEntry) { called = append(called, e) })
+
+	c.Set("a", "1")
+	if _, err := c.Do("slow", "x"); err != nil {
+		t.Fatal(err)
+	}
+	list := c.SlowLog()
+	if len(list) != 1 {
+		t.Fatalf("%d entries, want only the slow command: %+v", len(list), list)
+	}
+	e := list[0]
+	if e.Command != "slow" || len(e.Args) != 1 || e.Args[0] != "x" || e.Duration < 30*time.Millisecond ||
+		e.ClientId != c.Id || e.Reconnected {
+		t.Fatalf("entry %+v", e)
+	}
+	if len(called) != 1 || called[0].Command != "slow" {
+		t.Fatalf("callback got %+v", called)
+	}
+
+	c.ResetSlowLog()
+	if list := c.SlowLog(); len(list) != 0 {
+		t.Fatalf("%d entries after a reset", len(list))
+	}
+}
+
+func TestSlowLogRing(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	c.SetSlowLog(0, 3, nil)
+
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprintf("k%d", i), "v")
+	}
+	list := c.SlowLog()
+	if len(list) != 3 {
+		t.Fatalf("%d entries in a ring of 3", len(list))
+	}
+	for i, want := range []string{"k4", "k3", "k2"} {
+		if list[i].Args[0] != want {
+			t.Fatalf("entry %d is %v, want %s first", i, list[i].Args, want)
+		}
+	}
+
+	// long commands are truncated like the redis slowlog
+	args := []interface{}{"multi_get", strings.Repeat("x", 200)}
+	for i := 0; i < 40; i++ {
+		args = append(args, i)
+	}
+	c.Do(args...)
+	e := c.SlowLog()[0]
+	if len(e.Args) != 32 || e.Args[31] != "... (10 more arguments)" {
+		t.Fatalf("args %d, last %q", len(e.Args), e.Args[len(e.Args)-1])
+	}
+	if want := strings.Repeat("x", 128) + "... (72 more bytes)"; e.Args[0] != want {
+		t.Fatalf("long arg %q", e.Args[0])
+	}
+}
+
+func TestSlowLogReconnected(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	c.SetSlowLog(0, 10, nil)
+
+	s.DropConnections()
+	if _, err := c.Get("a"); err == nil {
+		t.Fatal("get over a dropped connection succeeded")
+	}
+	if e := c.SlowLog()[0]; !e.Reconnected {
+		t.Fatalf("failed command not marked reconnected: %+v", e)
+	}
+	waitFor(t, "the reconnect", func() bool { return c.Stats().Reconnects == 1 })
+	if _, err := c.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if e := c.SlowLog()[0]; e.Reconnected {
+		t.Fatalf("command after the reconnect marked reconnected: %+v", e)
+	}
+}
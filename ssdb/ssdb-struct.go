@@ -0,0 +1,448 @@
+package ssdb
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashSetStruct stores the fields of the struct v (or a pointer to one) as
+// the fields of a hash, in one round trip. Fields are named by their tag:
+//
+//	type Profile struct {
+//		Name    string    `ssdb:"name"`
+//		Age     int       `ssdb:"age,omitempty"`
+//		Joined  time.Time `ssdb:"joined"`
+//		Address Address   `ssdb:"address"` // encoded with StructCodec
+//		Secret  string    `ssdb:"-"`       // not stored
+//	}
+//
+// Fields without a tag use the field name. Fields of embedded structs and
+// embedded pointers to structs are flattened, a nil embedded pointer stores
+// none of its fields and is allocated when they are loaded. Names clash like
+// Go's promoted fields: the shallowest field of a name wins, of several at
+// the same depth only a tagged one, otherwise the name is left out.
+//
+// Strings and []byte are stored as is, numbers in decimal, bools as 1 or 0
+// and time.Time as RFC 3339. Types implementing encoding.TextMarshaler use
+// it, other structs, maps, slices and arrays go through StructCodec. Empty
+// omitempty fields and nil pointers are removed from the hash, so loading
+// it back gives v again.
+func (c *Client) HashSetStruct(hash string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return fmt.Errorf("HashSetStruct: nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("HashSetStruct: %T is not a struct", v)
+	}
+	plan := planOf(rv.Type())
+	set := []interface{}{"multi_hset", hash}
+	del := []interface{}{"multi_hdel", hash}
+	for _, f := range plan.fields {
+		fv, ok := fieldOf(rv, f.index)
+		if ok && f.omitEmpty && isEmptyValue(fv) {
+			ok = false
+		}
+		if !ok {
+			del = append(del, f.name)
+			continue
+		}
+		s, err := f.codec.encode(fv)
+		if err != nil {
+			return fmt.Errorf("HashSetStruct: field %s: %v", f.name, err)
+		}
+		set = append(set, f.name, s)
+	}
+	var cmds [][]interface{}
+	if len(set) > 2 {
+		cmds = append(cmds, set)
+	}
+	if len(del) > 2 {
+		cmds = append(cmds, del)
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	return pipeline(c, cmds)
+}
+
+// HashGetStruct loads a hash stored by HashSetStruct into the struct v
+// points to. With fields only those hash fields are read and set, a partial
+// load; fields missing from the hash are left as they are. It returns the
+// not_found error when none of the fields exist.
+func (c *Client) HashGetStruct(hash string, v interface{}, fields ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("HashGetStruct: %T is not a pointer to a struct", v)
+	}
+	rv = rv.Elem()
+	plan := planOf(rv.Type())
+	var values map[string]string
+	var err error
+	if len(fields) == 0 {
+		values, err = multiGet(c, "hgetall", []interface{}{hash})
+	} else {
+		args := []interface{}{hash}
+		for _, name := range fields {
+			if _, ok := plan.byName[name]; !ok {
+				return fmt.Errorf("HashGetStruct: %s has no field %s", rv.Type(), name)
+			}
+			args = append(args, name)
+		}
+		values, err = multiGet(c, "multi_hget", args)
+	}
+	if err != nil {
+		return err
+	}
+	found := false
+	for name, s := range values {
+		f, ok := plan.byName[name]
+		if !ok {
+			continue
+		}
+		found = true
+		if err := f.codec.decode(s, allocField(rv, f.index)); err != nil {
+			return fmt.Errorf("HashGetStruct: field %s: %v", name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("not_found")
+	}
+	return nil
+}
+
+// structPlan is how a struct type maps to hash fields, built once per type.
+type structPlan struct {
+	fields []*fieldPlan
+	byName map[string]*fieldPlan
+}
+
+type fieldPlan struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	codec     fieldCodec
+}
+
+var structPlans sync.Map // reflect.Type => *structPlan
+
+func planOf(t reflect.Type) *structPlan {
+	if p, ok := structPlans.Load(t); ok {
+		return p.(*structPlan)
+	}
+	p := &structPlan{byName: make(map[string]*fieldPlan)}
+	p.add(t)
+	structPlans.Store(t, p)
+	return p
+}
+
+// add collects the fields of t breadth first, one level of embedding at a
+// time, and keeps the field winning every name.
+func (p *structPlan) add(t reflect.Type) {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	var all []*fieldPlan
+	tagged := make(map[*fieldPlan]bool)
+	visited := make(map[reflect.Type]bool)
+	level := []embedded{{t, nil}}
+	for len(level) > 0 {
+		var next []embedded
+		for _, e := range level {
+			if visited[e.t] {
+				continue
+			}
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				tag := sf.Tag.Get("ssdb")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if i := strings.Index(tag, ","); i >= 0 {
+					name, opts = tag[:i], tag[i+1:]
+				}
+				idx := append(append([]int(nil), e.index...), i)
+				if sf.Anonymous && name == "" {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						// an unexported pointer can't be allocated on load
+						if sf.PkgPath != "" {
+							continue
+						}
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, embedded{ft, idx})
+						continue
+					}
+				}
+				if sf.PkgPath != "" {
+					continue
+				}
+				if name == "" {
+					name = sf.Name
+				}
+				f := &fieldPlan{name: name, index: idx, codec: codecOf(sf.Type)}
+				for _, o := range strings.Split(opts, ",") {
+					if o == "omitempty" {
+						f.omitEmpty = true
+					}
+				}
+				all = append(all, f)
+				tagged[f] = tag != "" && tag[0] != ','
+			}
+		}
+		// a type embedded twice at one level clashes with itself, it is
+		// only skipped when it comes back deeper
+		for _, e := range level {
+			visited[e.t] = true
+		}
+		level = next
+	}
+
+	byName := make(map[string][]*fieldPlan)
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	for _, f := range all {
+		if dominant(byName[f.name], tagged) == f {
+			p.fields = append(p.fields, f)
+			p.byName[f.name] = f
+		}
+	}
+	sort.Slice(p.fields, func(i, j int) bool {
+		a, b := p.fields[i].index, p.fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// dominant returns the field of a name that wins, nil when none does.
+func dominant(fields []*fieldPlan, tagged map[*fieldPlan]bool) *fieldPlan {
+	depth := len(fields[0].index)
+	var shallow []*fieldPlan
+	for _, f := range fields {
+		if len(f.index) < depth {
+			depth, shallow = len(f.index), nil
+		}
+		if len(f.index) == depth {
+			shallow = append(shallow, f)
+		}
+	}
+	if len(shallow) == 1 {
+		return shallow[0]
+	}
+	var win *fieldPlan
+	for _, f := range shallow {
+		if tagged[f] {
+			if win != nil {
+				return nil
+			}
+			win = f
+		}
+	}
+	return win
+}
+
+// fieldOf is FieldByIndex that reports false on a nil pointer on the way,
+// an embedded one or the field itself.
+func fieldOf(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// allocField is FieldByIndex that allocates nil pointers, embedded ones and
+// the field itself, so the value returned can be set.
+func allocField(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// fieldCodec converts a field to the string stored in the hash and back.
+type fieldCodec struct {
+	encode func(v reflect.Value) (string, error)
+	decode func(s string, v reflect.Value) error
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func codecOf(t reflect.Type) fieldCodec {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return fieldCodec{encodeTime, decodeTime}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return fieldCodec{encodeText, decodeText}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return fieldCodec{
+			func(v reflect.Value) (string, error) { return v.String(), nil },
+			func(s string, v reflect.Value) error { v.SetString(s); return nil },
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fieldCodec{
+			func(v reflect.Value) (string, error) { return strconv.FormatInt(v.Int(), 10), nil },
+			func(s string, v reflect.Value) error {
+				n, err := strconv.ParseInt(s, 10, t.Bits())
+				if err != nil {
+					return err
+				}
+				v.SetInt(n)
+				return nil
+			},
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return fieldCodec{
+			func(v reflect.Value) (string, error) { return strconv.FormatUint(v.Uint(), 10), nil },
+			func(s string, v reflect.Value) error {
+				n, err := strconv.ParseUint(s, 10, t.Bits())
+				if err != nil {
+					return err
+				}
+				v.SetUint(n)
+				return nil
+			},
+		}
+	case reflect.Float32, reflect.Float64:
+		return fieldCodec{
+			func(v reflect.Value) (string, error) { return strconv.FormatFloat(v.Float(), 'g', -1, t.Bits()), nil },
+			func(s string, v reflect.Value) error {
+				f, err := strconv.ParseFloat(s, t.Bits())
+				if err != nil {
+					return err
+				}
+				v.SetFloat(f)
+				return nil
+			},
+		}
+	case reflect.Bool:
+		return fieldCodec{
+			func(v reflect.Value) (string, error) {
+				if v.Bool() {
+					return "1", nil
+				}
+				return "0", nil
+			},
+			func(s string, v reflect.Value) error {
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return err
+				}
+				v.SetBool(b)
+				return nil
+			},
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fieldCodec{
+				func(v reflect.Value) (string, error) { return string(v.Bytes()), nil },
+				func(s string, v reflect.Value) error { v.SetBytes([]byte(s)); return nil },
+			}
+		}
+	}
+	return fieldCodec{encodeCodec, decodeCodec}
+}
+
+func encodeTime(v reflect.Value) (string, error) {
+	return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+}
+
+// decodeTime also reads unix seconds, as written by hand or by other clients.
+func decodeTime(s string, v reflect.Value) error {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		v.Set(reflect.ValueOf(time.Unix(n, 0)))
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func encodeText(v reflect.Value) (string, error) {
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		// the method is on the pointer, copy the value to take its address
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		m = p.Interface().(encoding.TextMarshaler)
+	}
+	b, err := m.MarshalText()
+	return string(b), err
+}
+
+func decodeText(s string, v reflect.Value) error {
+	u, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%s has no UnmarshalText", v.Type())
+	}
+	return u.UnmarshalText([]byte(s))
+}
+
+func encodeCodec(v reflect.Value) (string, error) {
+	b, err := StructCodec.Marshal(v.Interface())
+	return string(b), err
+}
+
+func decodeCodec(s string, v reflect.Value) error {
+	return StructCodec.Unmarshal([]byte(s), v.Addr().Interface())
+}
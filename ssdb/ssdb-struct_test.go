@@ -0,0 +1,168 @@
+package ssdb_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) { return []byte(strings.Repeat("*", int(l))), nil }
+
+func (l *level) UnmarshalText(b []byte) error {
+	*l = level(len(b))
+	return nil
+}
+
+type address struct {
+	City string `json:"city"`
+}
+
+type profile struct {
+	Name     string    `ssdb:"name"`
+	Age      int       `ssdb:"age,omitempty"`
+	Joined   time.Time `ssdb:"joined"`
+	Raw      []byte    `ssdb:"raw"`
+	Level    level     `ssdb:"level"`
+	Address  address   `ssdb:"address"`
+	Tags     []string  `ssdb:"tags,omitempty"`
+	Secret   string    `ssdb:"-"`
+	Untagged bool
+	Score    *float64 `ssdb:"score"`
+	private  string
+}
+
+type base struct {
+	ID   string `ssdb:"id"`
+	Name string // shadowed by withEmbed.Name
+}
+
+type Extra struct {
+	Note string
+}
+
+type withEmbed struct {
+	base
+	*Extra
+	Name string `ssdb:"Name"`
+}
+
+type left struct{ X, Y string }
+
+type right struct {
+	X string
+	Y string `ssdb:"Y"`
+}
+
+// X is on both sides at one depth and left out, the tagged Y wins
+type clash struct {
+	left
+	right
+	Z string
+}
+
+// hash returns the fields of a hash on the server.
+func hash(s *ssdbtest.Server, name string) map[string]string {
+	resp := s.Exec([]string{"hgetall", name})
+	m := make(map[string]string)
+	for i := 1; i+1 < len(resp); i += 2 {
+		m[resp[i]] = resp[i+1]
+	}
+	return m
+}
+
+func TestHashStruct(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	score := 1.5
+	joined := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	full := &profile{
+		Name: "ann", Age: 30, Joined: joined, Raw: []byte("\x00\xff"), Level: 3,
+		Address: address{"Oslo"}, Tags: []string{"a"}, Secret: "s", Untagged: true, Score: &score, private: "p",
+	}
+
+	for _, tc := range []struct {
+		name string
+		v    interface{} // a pointer to the struct stored
+		hash map[string]string
+		want interface{} // what loading the hash gives
+	}{
+		{"tags and codecs", full, map[string]string{
+			"name": "ann", "age": "30", "joined": "2020-01-02T03:04:05.000000006Z", "raw": "\x00\xff", "level": "***",
+			"address": `{"city":"Oslo"}`, "tags": `["a"]`, "Untagged": "1", "score": "1.5",
+		}, profile{
+			Name: "ann", Age: 30, Joined: joined, Raw: []byte("\x00\xff"), Level: 3,
+			Address: address{"Oslo"}, Tags: []string{"a"}, Untagged: true, Score: &score,
+		}},
+		{"omitempty and nil", &profile{Name: "bob", Joined: joined, Raw: []byte{}}, map[string]string{
+			"name": "bob", "joined": "2020-01-02T03:04:05.000000006Z", "raw": "", "level": "",
+			"address": `{"city":""}`, "Untagged": "0",
+		}, profile{Name: "bob", Joined: joined, Raw: []byte{}}},
+		{"embedded", &withEmbed{base: base{ID: "1", Name: "inner"}, Extra: &Extra{Note: "n"}, Name: "outer"},
+			map[string]string{"id": "1", "Note": "n", "Name": "outer"},
+			withEmbed{base: base{ID: "1"}, Extra: &Extra{Note: "n"}, Name: "outer"}},
+		{"nil embedded pointer", &withEmbed{base: base{ID: "2"}, Name: "outer"},
+			map[string]string{"id": "2", "Name": "outer"},
+			withEmbed{base: base{ID: "2"}, Name: "outer"}},
+		{"same depth", &clash{left{"lx", "ly"}, right{"rx", "ry"}, "z"},
+			map[string]string{"Y": "ry", "Z": "z"},
+			clash{right: right{Y: "ry"}, Z: "z"}},
+	} {
+		s.Exec([]string{"hclear", "h"})
+		if err := c.HashSetStruct("h", tc.v); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := hash(s, "h"); !reflect.DeepEqual(got, tc.hash) {
+			t.Errorf("%s: hash %q, want %q", tc.name, got, tc.hash)
+		}
+		back := reflect.New(reflect.TypeOf(tc.v).Elem())
+		if err := c.HashGetStruct("h", back.Interface()); err != nil {
+			t.Fatalf("%s: load: %v", tc.name, err)
+		}
+		if got := back.Elem().Interface(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: loaded %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	// storing again removes the fields that became empty
+	s.Exec([]string{"hclear", "h"})
+	c.HashSetStruct("h", full)
+	c.HashSetStruct("h", &profile{Name: "ann"})
+	if got := hash(s, "h"); got["age"] != "" || got["tags"] != "" || got["score"] != "" || got["name"] != "ann" {
+		t.Fatalf("hash after emptying fields %q", got)
+	}
+}
+
+func TestHashGetStructPartial(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	if err := c.HashSetStruct("h", profile{Name: "ann", Age: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := profile{Name: "old", Age: 1, Secret: "kept"}
+	if err := c.HashGetStruct("h", &p, "age"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "old" || p.Age != 30 || p.Secret != "kept" {
+		t.Fatalf("partial load %+v", p)
+	}
+	if err := c.HashGetStruct("h", &p, "nope"); err == nil {
+		t.Fatal("load of a field the struct doesn't have")
+	}
+	if err := c.HashGetStruct("h", &p, "tags"); err == nil || err.Error() != "not_found" {
+		t.Fatalf("load of a field the hash doesn't have: %v", err)
+	}
+	if err := c.HashGetStruct("missing", &p); err == nil || err.Error() != "not_found" {
+		t.Fatalf("load of a missing hash: %v", err)
+	}
+	if err := c.HashGetStruct("h", p); err == nil {
+		t.Fatal("load into a struct value")
+	}
+}
@@ -0,0 +1,72 @@
+package ssdb
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// Tracer starts spans, it is kept small so OpenTelemetry or any other
+// tracing library can be adapted from the outside.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced command.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+}
+
+// Trace reports every command as a span of t, the parent span is taken
+// from the context passed to DoContext or ProcessCmdContext.
+// With hashKeys the key is recorded as a fnv-64a hash instead of plain text.
+func (c *Client) Trace(t Tracer, hashKeys bool) {
+	c.Use(func(next Handler) Handler {
+		return func(cmd *Cmd) error {
+			ctx, span := t.Start(cmd.Ctx, "ssdb."+cmd.Name)
+			defer span.End()
+			parent := cmd.Ctx
+			cmd.Ctx = ctx
+			span.SetAttribute("db.system", "ssdb")
+			span.SetAttribute("db.operation", cmd.Name)
+			span.SetAttribute("server.address", c.addr())
+			span.SetAttribute("db.ssdb.client_id", c.Id)
+			if len(cmd.Args) > 0 {
+				span.SetAttribute("db.ssdb.key", traceKey(cmd.Args[0], hashKeys))
+			}
+			if cmd.Batch != nil {
+				span.SetAttribute("db.ssdb.batch_size", len(cmd.Batch))
+			}
+			retries := atomic.LoadUint64(&c.metrics.retries)
+			err := next(cmd)
+			cmd.Ctx = parent
+			// reconnects while the command ran
+			span.SetAttribute("db.ssdb.retry_count", atomic.LoadUint64(&c.metrics.retries)-retries)
+			if len(cmd.Resp) > 0 {
+				span.SetAttribute("db.ssdb.status", cmd.Resp[0])
+			}
+			if err != nil {
+				span.SetError(err)
+			} else if len(cmd.Resp) > 0 && cmd.Resp[0] != "ok" && cmd.Resp[0] != "not_found" {
+				span.SetError(fmt.Errorf("%v", cmd.Resp))
+			}
+			return err
+		}
+	})
+}
+
+func traceKey(arg interface{}, hashKeys bool) string {
+	key := fmt.Sprintf("%v", arg)
+	if b, ok := arg.([]byte); ok {
+		key = string(b)
+	}
+	if !hashKeys {
+		return key
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,87 @@
+package ssdb_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+type testSpan struct {
+	mu    *sync.Mutex
+	attrs map[string]interface{}
+}
+
+func (s testSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+func (s testSpan) SetError(err error) {}
+
+func (s testSpan) End() {}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, ssdb.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := testSpan{&t.mu, map[string]interface{}{}}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func (t *testTracer) last(key string) interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spans[len(t.spans)-1].attrs[key]
+}
+
+func connect(t *testing.T, s *ssdbtest.Server) *ssdb.Client {
+	t.Helper()
+	host, p, _ := net.SplitHostPort(s.Addr())
+	port, _ := strconv.Atoi(p)
+	c, err := ssdb.Connect(host, port, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestTraceRetryCount(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	c := connect(t, s)
+	tr := &testTracer{}
+	c.Trace(tr, false)
+
+	c.Set("a", "1")
+	if got := tr.last("db.ssdb.retry_count"); got != uint64(0) {
+		t.Fatalf("retry_count %v", got)
+	}
+	s.DropConnections()
+	// the command hitting the dropped connection starts the reconnect
+	if _, err := c.Get("a"); err == nil {
+		t.Fatal("get over a dropped connection succeeded")
+	}
+	if got := tr.last("db.ssdb.retry_count"); got != uint64(1) {
+		t.Fatalf("retry_count %v after a dropped connection", got)
+	}
+	waitFor(t, "the reconnect", func() bool { return c.Stats().Reconnects == 1 })
+	// the reconnect happened before this command, it doesn't count
+	if _, err := c.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.last("db.ssdb.retry_count"); got != uint64(0) {
+		t.Fatalf("retry_count %v after an earlier reconnect", got)
+	}
+}
@@ -19,6 +19,10 @@ import (
 	
 )
 
+// UnixClient talks to a server over a unix socket. It sends its commands
+// directly, without the interceptor chain of Client, so Use, Stats, Trace
+// and SetSlowLog don't exist for it and unix socket traffic is not
+// instrumented.
 type UnixClient struct {
 	sock *net.UnixConn
 	recv_buf bytes.Buffer
@@ -0,0 +1,316 @@
+package ssdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DataType is one of the four SSDB data types.
+type DataType string
+
+const (
+	TypeKV    DataType = "kv"
+	TypeHash  DataType = "hash"
+	TypeZset  DataType = "zset"
+	TypeQueue DataType = "queue"
+)
+
+// DataTypes lists every type in the order tools walk them.
+var DataTypes = []DataType{TypeKV, TypeHash, TypeZset, TypeQueue}
+
+// ParseDataTypes parses a comma separated list like "kv,hash", empty means all.
+func ParseDataTypes(list string) ([]DataType, error) {
+	if list == "" {
+		return DataTypes, nil
+	}
+	var types []DataType
+	for _, s := range strings.Split(list, ",") {
+		t := DataType(strings.TrimSpace(s))
+		switch t {
+		case TypeKV, TypeHash, TypeZset, TypeQueue:
+			types = append(types, t)
+		default:
+			return nil, fmt.Errorf("unknown data type %q, want kv, hash, zset or queue", s)
+		}
+	}
+	return types, nil
+}
+
+// ExpireList is the internal zset where ssdb keeps key TTLs, member = key,
+// score = expire time in ms. ScanNames leaves it out of the zsets.
+const ExpireList = "\xff\xff\xff\xff\xff|EXPIRE_LIST|KV"
+
+// KeyValue is a key with its value, or a hash field with its value.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// ZsetItem is a zset member with its score.
+type ZsetItem struct {
+	Member string
+	Score  int64
+}
+
+// default page size of the Scan functions
+const scanPage = 1000
+
+// listCommands list the names of each type.
+var listCommands = map[DataType]string{
+	TypeKV: "keys", TypeHash: "hlist", TypeZset: "zlist", TypeQueue: "qlist",
+}
+
+// prefixStart returns the exclusive scan start that comes right before
+// every key with the prefix.
+func prefixStart(prefix string) string {
+	n := len(prefix)
+	if n == 0 {
+		return ""
+	}
+	if prefix[n-1] == 0 {
+		return prefix[:n-1]
+	}
+	return prefix[:n-1] + string([]byte{prefix[n-1] - 1, 0xff})
+}
+
+// inPrefix reports whether key has the prefix, and whether keys after it
+// may still have it.
+func inPrefix(key, prefix string) (match, more bool) {
+	if strings.HasPrefix(key, prefix) {
+		return true, true
+	}
+	return false, key < prefix
+}
+
+func checkResp(cmd string, resp []string, err error) error {
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 {
+		return fmt.Errorf("%s: empty response", cmd)
+	}
+	if resp[0] != "ok" {
+		return fmt.Errorf("%s: %s", cmd, strings.Join(resp, " "))
+	}
+	return nil
+}
+
+// KeyRange selects keys, hashes, zsets or queues by name: those starting
+// with Prefix, after Start and up to End. Empty fields select everything.
+type KeyRange struct {
+	Prefix string
+	Start  string // exclusive, like the start of scan
+	End    string // inclusive
+}
+
+// Match reports whether name is in the range.
+func (r KeyRange) Match(name string) bool {
+	return strings.HasPrefix(name, r.Prefix) && (r.Start == "" || name > r.Start) && (r.End == "" || name <= r.End)
+}
+
+// ScanNames calls fn with pages of the names of every key, hash, zset or
+// queue starting with prefix, in key order. page <= 0 uses 1000.
+func (c *Client) ScanNames(t DataType, prefix string, page int, fn func(names []string) error) error {
+	return c.ScanNamesIn(t, KeyRange{Prefix: prefix}, page, fn)
+}
+
+// ScanNamesIn is ScanNames for the names in a range.
+func (c *Client) ScanNamesIn(t DataType, r KeyRange, page int, fn func(names []string) error) error {
+	cmd, ok := listCommands[t]
+	if !ok {
+		return fmt.Errorf("unknown data type %q", t)
+	}
+	return c.scanPages(cmd, r, page, 1, func(names []string) error {
+		if t == TypeZset {
+			for i, name := range names {
+				if name == ExpireList {
+					names = append(names[:i:i], names[i+1:]...)
+					break
+				}
+			}
+			if len(names) == 0 {
+				return nil
+			}
+		}
+		return fn(names)
+	})
+}
+
+// ScanKV calls fn with pages of the key/value pairs starting with prefix, in key order.
+func (c *Client) ScanKV(prefix string, page int, fn func(kvs []KeyValue) error) error {
+	return c.ScanKVIn(KeyRange{Prefix: prefix}, page, fn)
+}
+
+// ScanKVIn is ScanKV for the keys in a range.
+func (c *Client) ScanKVIn(r KeyRange, page int, fn func(kvs []KeyValue) error) error {
+	return c.scanPages("scan", r, page, 2, func(resp []string) error {
+		return fn(keyValues(resp))
+	})
+}
+
+// scanPages pages a "cmd start end limit" command whose responses have
+// width values per key, passing the values of the keys with the prefix.
+func (c *Client) scanPages(cmd string, r KeyRange, page, width int, fn func(resp []string) error) error {
+	if page <= 0 {
+		page = scanPage
+	}
+	start := prefixStart(r.Prefix)
+	if r.Start > start {
+		start = r.Start
+	}
+	for {
+		resp, err := c.Do(cmd, start, r.End, page)
+		if err := checkResp(cmd, resp, err); err != nil {
+			return err
+		}
+		values := resp[1:]
+		n := len(values) / width
+		if n == 0 {
+			return nil
+		}
+		start = values[(n-1)*width]
+		from, to := 0, n
+		for from < n {
+			if match, _ := inPrefix(values[from*width], r.Prefix); match {
+				break
+			}
+			from++
+		}
+		for to > from {
+			if match, _ := inPrefix(values[(to-1)*width], r.Prefix); match {
+				break
+			}
+			to--
+		}
+		if from < to {
+			if err := fn(values[from*width : to*width]); err != nil {
+				return err
+			}
+		}
+		if _, more := inPrefix(start, r.Prefix); !more || n < page {
+			return nil
+		}
+	}
+}
+
+func keyValues(resp []string) []KeyValue {
+	kvs := make([]KeyValue, 0, len(resp)/2)
+	for i := 0; i+1 < len(resp); i += 2 {
+		kvs = append(kvs, KeyValue{resp[i], resp[i+1]})
+	}
+	return kvs
+}
+
+// ScanHash calls fn with pages of the fields of a hash, in field order.
+func (c *Client) ScanHash(name string, page int, fn func(fields []KeyValue) error) error {
+	if page <= 0 {
+		page = scanPage
+	}
+	start := ""
+	for {
+		resp, err := c.Do("hscan", name, start, "", page)
+		if err := checkResp("hscan", resp, err); err != nil {
+			return err
+		}
+		kvs := keyValues(resp[1:])
+		if len(kvs) == 0 {
+			return nil
+		}
+		if err := fn(kvs); err != nil {
+			return err
+		}
+		if len(kvs) < page {
+			return nil
+		}
+		start = kvs[len(kvs)-1].Key
+	}
+}
+
+// ScanZset calls fn with pages of the members of a zset, by score then member.
+func (c *Client) ScanZset(name string, page int, fn func(items []ZsetItem) error) error {
+	if page <= 0 {
+		page = scanPage
+	}
+	key, score := "", ""
+	for {
+		resp, err := c.Do("zscan", name, key, score, "", page)
+		if err := checkResp("zscan", resp, err); err != nil {
+			return err
+		}
+		items := make([]ZsetItem, 0, len(resp)/2)
+		for i := 1; i+1 < len(resp); i += 2 {
+			s, err := strconv.ParseInt(resp[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("zscan %s: bad score %q", name, resp[i+1])
+			}
+			items = append(items, ZsetItem{resp[i], s})
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		if len(items) < page {
+			return nil
+		}
+		last := items[len(items)-1]
+		key, score = last.Member, strconv.FormatInt(last.Score, 10)
+	}
+}
+
+// ScanQueue calls fn with pages of the items of a queue from the front,
+// offset is the position of the first item of the page.
+func (c *Client) ScanQueue(name string, page int, fn func(offset int64, items []string) error) error {
+	if page <= 0 {
+		page = scanPage
+	}
+	var offset int64
+	for {
+		resp, err := c.Do("qrange", name, offset, page)
+		if err := checkResp("qrange", resp, err); err != nil {
+			return err
+		}
+		items := resp[1:]
+		if len(items) == 0 {
+			return nil
+		}
+		if err := fn(offset, items); err != nil {
+			return err
+		}
+		if len(items) < page {
+			return nil
+		}
+		offset += int64(len(items))
+	}
+}
+
+// TTLs returns the remaining time to live in seconds of each key, -1 for
+// keys that don't expire, in one pipelined round trip.
+func (c *Client) TTLs(keys []string) ([]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	cmds := make([][]interface{}, len(keys))
+	for i, k := range keys {
+		cmds[i] = []interface{}{"ttl", k}
+	}
+	resps, err := c.Pipeline(cmds)
+	if err != nil {
+		return nil, err
+	}
+	ttls := make([]int64, len(keys))
+	for i, resp := range resps {
+		if err := checkResp("ttl", resp, nil); err != nil {
+			return nil, err
+		}
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("ttl %s: bad response %v", keys[i], resp)
+		}
+		if ttls[i], err = strconv.ParseInt(resp[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("ttl %s: bad response %v", keys[i], resp)
+		}
+	}
+	return ttls, nil
+}
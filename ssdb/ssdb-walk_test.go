@@ -0,0 +1,105 @@
+package ssdb_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/matishsiao/gossdb/ssdb"
+	"github.com/matishsiao/gossdb/ssdb/ssdbtest"
+)
+
+func TestWalkers(t *testing.T) {
+	s := ssdbtest.NewServer()
+	t.Cleanup(s.Close)
+	for _, k := range []string{"a", "user:1", "user:2", "user:3", "user:4", "user:5", "v"} {
+		exec(t, s, []string{"set", k, "v" + k})
+	}
+	exec(t, s, []string{"expire", "user:2", "100"})
+	for i := 0; i < 5; i++ {
+		exec(t, s,
+			[]string{"hset", "h", fmt.Sprintf("f%d", i), fmt.Sprint(i)},
+			[]string{"zset", "z", fmt.Sprintf("m%d", i), fmt.Sprint(2 - i)},
+			[]string{"qpush_back", "q", fmt.Sprintf("i%d", i)},
+		)
+	}
+	exec(t, s, []string{"hset", "user:h", "f", "1"}, []string{"hset", "x", "f", "1"})
+	c := connect(t, s)
+
+	var kvs []ssdb.KeyValue
+	err := c.ScanKV("user:", 2, func(page []ssdb.KeyValue) error {
+		if len(page) > 2 {
+			t.Fatalf("page of %d", len(page))
+		}
+		kvs = append(kvs, page...)
+		return nil
+	})
+	if err != nil || len(kvs) != 5 || kvs[0] != (ssdb.KeyValue{Key: "user:1", Value: "vuser:1"}) || kvs[4].Key != "user:5" {
+		t.Fatalf("scan kv %v %v", kvs, err)
+	}
+
+	var keys []string
+	r := ssdb.KeyRange{Prefix: "user:", Start: "user:2", End: "user:4"}
+	err = c.ScanNamesIn(ssdb.TypeKV, r, 2, func(names []string) error {
+		keys = append(keys, names...)
+		return nil
+	})
+	if want := []string{"user:3", "user:4"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Fatalf("names in %+v: %v %v", r, keys, err)
+	}
+	var hashes []string
+	err = c.ScanNames(ssdb.TypeHash, "", 1, func(names []string) error {
+		hashes = append(hashes, names...)
+		return nil
+	})
+	if want := []string{"h", "user:h", "x"}; err != nil || !reflect.DeepEqual(hashes, want) {
+		t.Fatalf("hash names %v %v", hashes, err)
+	}
+
+	var fields []ssdb.KeyValue
+	err = c.ScanHash("h", 2, func(page []ssdb.KeyValue) error {
+		fields = append(fields, page...)
+		return nil
+	})
+	if err != nil || len(fields) != 5 || fields[4] != (ssdb.KeyValue{Key: "f4", Value: "4"}) {
+		t.Fatalf("hash %v %v", fields, err)
+	}
+
+	// by score, negative scores first
+	var items []ssdb.ZsetItem
+	err = c.ScanZset("z", 2, func(page []ssdb.ZsetItem) error {
+		items = append(items, page...)
+		return nil
+	})
+	if err != nil || len(items) != 5 || items[0] != (ssdb.ZsetItem{Member: "m4", Score: -2}) || items[4] != (ssdb.ZsetItem{Member: "m0", Score: 2}) {
+		t.Fatalf("zset %v %v", items, err)
+	}
+
+	var queue []string
+	err = c.ScanQueue("q", 2, func(offset int64, page []string) error {
+		if offset != int64(len(queue)) {
+			t.Fatalf("page at offset %d after %d items", offset, len(queue))
+		}
+		queue = append(queue, page...)
+		return nil
+	})
+	if want := []string{"i0", "i1", "i2", "i3", "i4"}; err != nil || !reflect.DeepEqual(queue, want) {
+		t.Fatalf("queue %v %v", queue, err)
+	}
+
+	ttls, err := c.TTLs([]string{"user:1", "user:2"})
+	if err != nil || ttls[0] != -1 || ttls[1] <= 0 || ttls[1] > 100 {
+		t.Fatalf("ttls %v %v", ttls, err)
+	}
+
+	// an error of fn stops the walk
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = c.ScanKV("", 1, func([]ssdb.KeyValue) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("walk went on after an error: %v, %d calls", err, calls)
+	}
+}
@@ -3,6 +3,7 @@ package ssdb
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"fmt"
 	_ "io"
@@ -14,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	_ "syscall"
 	"time"
 )
@@ -33,6 +35,19 @@ type Client struct {
 	Closed      bool
 	init        bool
 	skipReceive bool
+	protocol    Protocol
+
+	hookMu       sync.RWMutex
+	interceptors []Interceptor
+	handler      Handler
+	breakers     []*CircuitBreaker
+	metrics      clientMetrics
+	slowLog      slowLog
+
+	endpoints     []Node
+	active        int
+	tried         int
+	onStateChange func(StateChange)
 }
 
 type ClientResult struct {
@@ -87,7 +102,10 @@ func (c *Client) Debug(flag bool) bool {
 }
 
 func (c *Client) Connect() error {
-	log.Printf("Client[%s] connect to %s:%d\n", c.Id, c.Ip, c.Port)
+	c.mu.Lock()
+	ip, port, password := c.Ip, c.Port, c.Password
+	c.mu.Unlock()
+	log.Printf("Client[%s] connect to %s:%d\n", c.Id, ip, port)
 	/*addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", c.Ip, c.Port))
 	if err != nil {
 		log.Println("Client ResolveTCPAddr failed:", err)
@@ -95,8 +113,9 @@ func (c *Client) Connect() error {
 	}*/
 	seconds := 60
 	timeOut := time.Duration(seconds) * time.Second
-	sock, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.Ip, c.Port), timeOut)
+	sock, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), timeOut)
 	if err != nil {
+		atomic.AddUint64(&c.metrics.dialFailures, 1)
 		log.Println("SSDB Client dial failed:", err, c.Id)
 		return err
 	}
@@ -105,22 +124,37 @@ func (c *Client) Connect() error {
 		log.Println("SSDB Client dial failed:", err, c.Id)
 		return err
 	}*/
+	c.mu.Lock()
+	if c.Closed {
+		// closed while dialing, Close didn't see this socket
+		c.mu.Unlock()
+		sock.Close()
+		return fmt.Errorf("client closed")
+	}
 	c.sock = sock
 	c.Connected = true
-	if c.Retry {
-		log.Printf("Client[%s] retry connect to %s:%d success.", c.Id, c.Ip, c.Port)
-	} else {
-		log.Printf("Client[%s] connect to %s:%d success\n", c.Id, c.Ip, c.Port)
-	}
+	retry := c.Retry
 	c.Retry = false
-	if !c.init {
+	c.tried = 0
+	start := !c.init
+	if start {
 		c.process = make(chan []interface{})
 		c.result = make(chan ClientResult)
-		go c.processDo()
 		c.init = true
 	}
-	if c.Password != "" {
-		c.Auth(c.Password)
+	c.mu.Unlock()
+	if retry {
+		atomic.AddUint64(&c.metrics.reconnects, 1)
+		log.Printf("Client[%s] retry connect to %s:%d success.", c.Id, ip, port)
+	} else {
+		log.Printf("Client[%s] connect to %s:%d success\n", c.Id, ip, port)
+	}
+	c.stateChanged(StateConnected, nil)
+	if start {
+		go c.processDo()
+	}
+	if password != "" {
+		c.Auth(password)
 	}
 
 	return nil
@@ -139,7 +173,7 @@ func (c *Client) HealthCheck() {
 	//wait client connect to server
 	//time.Sleep(5 * time.Second)
 	for {
-		if c.Connected && !c.Retry && !c.Closed {
+		if c.ready() {
 			result, err := c.Do("ping")
 			if err != nil {
 				log.Printf("Client Health Check Failed[%s]:%v\n", c.Id, err)
@@ -154,45 +188,105 @@ func (c *Client) HealthCheck() {
 }
 
 func (c *Client) RetryConnect() {
-	if !c.Retry {
+	if c.startRetry() {
+		c.reconnect()
+	}
+}
+
+// startRetry marks the client as reconnecting and counts the retry, it
+// returns false when a reconnect is already running.
+func (c *Client) startRetry() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Retry {
+		return false
+	}
+	c.Retry = true
+	c.Connected = false
+	atomic.AddUint64(&c.metrics.retries, 1)
+	return true
+}
+
+// reconnect connects again until it succeeds or the client is closed.
+func (c *Client) reconnect() {
+	c.stateChanged(StateDisconnected, nil)
+	addr := c.addr()
+	log.Printf("Client[%s] retry connect to %s\n", c.Id, addr)
+	for {
 		c.mu.Lock()
-		c.Retry = true
-		c.Connected = false
+		connected, closed := c.Connected, c.Closed
 		c.mu.Unlock()
-		log.Printf("Client[%s] retry connect to %s:%d Connected:%v Closed:%v\n", c.Id, c.Ip, c.Port, c.Connected, c.Closed)
-		for {
-			if !c.Connected && !c.Closed {
-				log.Printf("Client[%s] retry connect to %s:%d\n", c.Id, c.Ip, c.Port)
-				err := c.Connect()
-				if err != nil {
-					log.Printf("Client[%s] Retry connect to %s:%d Failed. Error:%v\n", c.Id, c.Ip, c.Port, err)
-					time.Sleep(5 * time.Second)
-				}
-			} else {
-				log.Printf("Client[%s] Retry connect to %s:%d stop by conn:%v closed:%v\n.", c.Id, c.Ip, c.Port, c.Connected, c.Closed)
-				break
+		addr = c.addr()
+		if connected || closed {
+			log.Printf("Client[%s] Retry connect to %s stop by conn:%v closed:%v\n.", c.Id, addr, connected, closed)
+			break
+		}
+		log.Printf("Client[%s] retry connect to %s\n", c.Id, addr)
+		err := c.Connect()
+		if err != nil {
+			log.Printf("Client[%s] Retry connect to %s Failed. Error:%v\n", c.Id, addr, err)
+			if c.nextEndpoint(err) {
+				continue
 			}
+			time.Sleep(5 * time.Second)
 		}
 	}
 }
 
+// CheckError drops the connection after a network error and reconnects in
+// the background. The client is marked as reconnecting before it returns,
+// so the command that failed sees the retry.
 func (c *Client) CheckError(err error) {
 	//if err == io.EOF || strings.Contains(err.Error(), "connection") || strings.Contains(err.Error(), "timed out") || strings.Contains(err.Error(), "route") {
 	if err != nil {
-		if !c.Closed {
+		c.mu.Lock()
+		closed, sock := c.Closed, c.sock
+		c.mu.Unlock()
+		if !closed {
 			log.Printf("Check Error:%v Retry connect.\n", err)
-			c.sock.Close()
-			go c.RetryConnect()
+			sock.Close()
+			if c.startRetry() {
+				go c.reconnect()
+			}
 		}
 
 	}
 }
 
+// ready reports whether the client is connected and neither reconnecting nor closed.
+func (c *Client) ready() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Connected && !c.Retry && !c.Closed
+}
+
+// connected reports whether the client has a connection.
+func (c *Client) connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Connected
+}
+
+// addr returns the host:port of the active endpoint.
+func (c *Client) addr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("%s:%d", c.Ip, c.Port)
+}
+
 func (c *Client) processDo() {
 	for args := range c.process {
 		runId := args[0].(string)
-		runArgs := args[1:]
-		result, err := c.do(runArgs)
+		cmd := args[1].(*Cmd)
+		var result []string
+		var err error
+		if cmd.run != nil {
+			err = cmd.run()
+		} else if cmd.Batch != nil {
+			err = c.pipeline(cmd.Batch)
+		} else {
+			result, err = c.do(cmd.Wire())
+		}
 		c.result <- ClientResult{Id: runId, Data: result, Error: err}
 		/*if c.Connected && !c.Retry && !c.Closed {
 			c.result <- ClientResult{Id: runId, Data: result, Error: err}
@@ -211,23 +305,19 @@ func ArrayAppendToFirst(src []interface{}, dst []interface{}) []interface{} {
 }
 
 func (c *Client) Do(args ...interface{}) ([]string, error) {
-	if c.Connected && !c.Retry && !c.Closed {
-		runId := fmt.Sprintf("%d", time.Now().UnixNano())
-		args = ArrayAppendToFirst([]interface{}{runId}, args)
-		c.process <- args
-		for result := range c.result {
-			if result.Id == runId {
-				return result.Data, result.Error
-			} else {
-				c.result <- result
-			}
-		}
-	}
-	return nil, fmt.Errorf("Connection has closed.")
+	return c.DoContext(context.Background(), args...)
+}
+
+// DoContext is Do with a context, which is handed to the interceptors (e.g. for tracing).
+// A done context fails the command before it is sent, a command already sent is not cancelled.
+func (c *Client) DoContext(ctx context.Context, args ...interface{}) ([]string, error) {
+	cmd := newCmd(args)
+	cmd.Ctx = ctx
+	return c.handle(cmd)
 }
 
 func (c *Client) do(args []interface{}) ([]string, error) {
-	if c.Connected {
+	if c.connected() {
 		err := c.send(args)
 		if err != nil {
 			if debug {
@@ -253,70 +343,60 @@ func (c *Client) do(args []interface{}) ([]string, error) {
 }
 
 func (c *Client) ProcessCmd(cmd string, args []interface{}) (interface{}, error) {
-	if c.Connected {
-		args = ArrayAppendToFirst([]interface{}{cmd}, args)
-		runId := fmt.Sprintf("%d", time.Now().UnixNano())
-		args = ArrayAppendToFirst([]interface{}{runId}, args)
-		var err error
-		c.process <- args
-		var resResult ClientResult
-		for result := range c.result {
-			if result.Id == runId {
-				resResult = result
-				break
-			} else {
-				c.result <- result
+	return c.ProcessCmdContext(context.Background(), cmd, args)
+}
+
+// ProcessCmdContext is ProcessCmd with a context, which is handed to the interceptors.
+func (c *Client) ProcessCmdContext(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+	if !c.connected() {
+		return nil, fmt.Errorf("lost connection")
+	}
+	resp, err := c.handle(&Cmd{Ctx: ctx, Name: cmd, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	args = ArrayAppendToFirst([]interface{}{cmd}, args)
+	if len(resp) == 2 && resp[0] == "ok" {
+		switch cmd {
+		case "set", "del":
+			return true, nil
+		case "expire", "setnx", "auth", "exists", "hexists":
+			if resp[1] == "1" {
+				return true, nil
 			}
-		}
-		if resResult.Error != nil {
-			return nil, resResult.Error
+			return false, nil
+		case "hsize":
+			val, err := strconv.ParseInt(resp[1], 10, 64)
+			return val, err
+		default:
+			return resp[1], nil
 		}
 
-		resp := resResult.Data
-		if len(resp) == 2 && resp[0] == "ok" {
+	} else if len(resp) == 1 && resp[0] == "not_found" {
+		return nil, fmt.Errorf("%v", resp[0])
+	} else {
+		if len(resp) >= 1 && resp[0] == "ok" {
+			//fmt.Println("Process:",args,resp)
 			switch cmd {
-			case "set", "del":
-				return true, nil
-			case "expire", "setnx", "auth", "exists", "hexists":
-				if resp[1] == "1" {
-					return true, nil
+			case "hgetall", "hscan", "hrscan", "multi_hget", "multi_get", "scan", "rscan":
+				list := make(map[string]string)
+				length := len(resp[1:])
+				data := resp[1:]
+				for i := 0; i < length; i += 2 {
+					list[data[i]] = data[i+1]
 				}
-				return false, nil
-			case "hsize":
-				val, err := strconv.ParseInt(resp[1], 10, 64)
-				return val, err
+				return list, nil
 			default:
-				return resp[1], nil
-			}
-
-		} else if len(resp) == 1 && resp[0] == "not_found" {
-			return nil, fmt.Errorf("%v", resp[0])
-		} else {
-			if len(resp) >= 1 && resp[0] == "ok" {
-				//fmt.Println("Process:",args,resp)
-				switch cmd {
-				case "hgetall", "hscan", "hrscan", "multi_hget", "scan", "rscan":
-					list := make(map[string]string)
-					length := len(resp[1:])
-					data := resp[1:]
-					for i := 0; i < length; i += 2 {
-						list[data[i]] = data[i+1]
-					}
-					return list, nil
-				default:
-					return resp[1:], nil
-				}
+				return resp[1:], nil
 			}
 		}
-		if len(resp) == 2 && strings.Contains(resp[1], "connection") {
-			c.sock.Close()
-			go c.RetryConnect()
-		}
-		log.Printf("SSDB Client Error Response:%v args:%v Error:%v", resp, args, err)
-		return nil, fmt.Errorf("bad response:%v args:%v", resp, args)
-	} else {
-		return nil, fmt.Errorf("lost connection")
 	}
+	if len(resp) == 2 && strings.Contains(resp[1], "connection") {
+		c.sock.Close()
+		go c.RetryConnect()
+	}
+	log.Printf("SSDB Client Error Response:%v args:%v Error:%v", resp, args, err)
+	return nil, fmt.Errorf("bad response:%v args:%v", resp, args)
 }
 
 func (c *Client) Auth(pwd string) (interface{}, error) {
@@ -382,6 +462,35 @@ func (c *Client) Exists(key string) (interface{}, error) {
 	return c.ProcessCmd("exists", params)
 }
 
+func (c *Client) MultiGet(keys []string) (map[string]string, error) {
+	params := []interface{}{}
+	for _, v := range keys {
+		params = append(params, v)
+	}
+	val, err := c.ProcessCmd("multi_get", params)
+	if err != nil {
+		return nil, err
+	}
+	return val.(map[string]string), nil
+}
+
+func (c *Client) MultiSet(data map[string]string) (interface{}, error) {
+	params := []interface{}{}
+	for k, v := range data {
+		params = append(params, k)
+		params = append(params, v)
+	}
+	return c.ProcessCmd("multi_set", params)
+}
+
+func (c *Client) MultiDel(keys []string) (interface{}, error) {
+	params := []interface{}{}
+	for _, v := range keys {
+		params = append(params, v)
+	}
+	return c.ProcessCmd("multi_del", params)
+}
+
 func (c *Client) HashSet(hash string, key string, val string) (interface{}, error) {
 	params := []interface{}{hash, key, val}
 	return c.ProcessCmd("hset", params)
@@ -437,30 +546,60 @@ func (c *Client) MultiHashSet(parts []HashData, connNum int) (interface{}, error
 }
 
 func (c *Client) MultiMode(args [][]interface{}) ([]string, error) {
-	if c.Connected {
-		for _, v := range args {
-			err := c.send(v)
-			if err != nil {
-				log.Printf("SSDB Client[%s] Do Send Error:%v Data:%v\n", c.Id, err, args)
-				c.CheckError(err)
-				return nil, err
-			}
+	if c.connected() {
+		cmd := newBatch(args)
+		if _, err := c.handle(cmd); err != nil {
+			return nil, err
 		}
 		var resps []string
-		for i := 0; i < len(args); i++ {
-			resp, err := c.recv()
-			if err != nil {
-				log.Printf("SSDB Client[%s] Do Receive Error:%v Data:%v\n", c.Id, err, args)
-				c.CheckError(err)
-				return nil, err
-			}
-			resps = append(resps, strings.Join(resp, ","))
+		for _, v := range cmd.Batch {
+			resps = append(resps, strings.Join(v.Resp, ","))
 		}
 		return resps, nil
 	}
 	return nil, fmt.Errorf("lost connection")
 }
 
+// Pipeline sends all commands in one round trip and returns the raw response of each.
+func (c *Client) Pipeline(args [][]interface{}) ([][]string, error) {
+	if c.connected() {
+		cmd := newBatch(args)
+		if _, err := c.handle(cmd); err != nil {
+			return nil, err
+		}
+		resps := make([][]string, len(cmd.Batch))
+		for i, v := range cmd.Batch {
+			resps[i] = v.Resp
+		}
+		return resps, nil
+	}
+	return nil, fmt.Errorf("lost connection")
+}
+
+func (c *Client) pipeline(batch []*Cmd) error {
+	if !c.connected() {
+		return fmt.Errorf("lost connection")
+	}
+	for _, v := range batch {
+		err := c.send(v.Wire())
+		if err != nil {
+			log.Printf("SSDB Client[%s] Do Send Error:%v Data:%v\n", c.Id, err, v.Wire())
+			c.CheckError(err)
+			return err
+		}
+	}
+	for _, v := range batch {
+		resp, err := c.recv()
+		if err != nil {
+			log.Printf("SSDB Client[%s] Do Receive Error:%v Data:%v\n", c.Id, err, v.Wire())
+			c.CheckError(err)
+			return err
+		}
+		v.Resp = resp
+	}
+	return nil
+}
+
 func (c *Client) HashGet(hash string, key string) (interface{}, error) {
 	params := []interface{}{hash, key}
 	return c.ProcessCmd("hget", params)
@@ -669,39 +808,47 @@ func (c *Client) Send(args ...interface{}) error {
 	return c.send(args)
 }
 
+func argToString(arg interface{}) (string, error) {
+	switch arg := arg.(type) {
+	case string:
+		return arg, nil
+	case []byte:
+		return string(arg), nil
+	case int:
+		return fmt.Sprintf("%d", arg), nil
+	case int64:
+		return fmt.Sprintf("%d", arg), nil
+	case float64:
+		return fmt.Sprintf("%f", arg), nil
+	case bool:
+		if arg {
+			return "1", nil
+		}
+		return "0", nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("bad arguments")
+}
+
 func (c *Client) send(args []interface{}) error {
+	if c.protocol == ProtocolRESP {
+		return c.sendRESP(args)
+	}
 	var buf bytes.Buffer
 	for _, arg := range args {
-		var s string
-		switch arg := arg.(type) {
-		case string:
-			s = arg
-		case []byte:
-			s = string(arg)
-		case []string:
-			for _, s := range arg {
+		if list, ok := arg.([]string); ok {
+			for _, s := range list {
 				buf.WriteString(fmt.Sprintf("%d", len(s)))
 				buf.WriteByte('\n')
 				buf.WriteString(s)
 				buf.WriteByte('\n')
 			}
 			continue
-		case int:
-			s = fmt.Sprintf("%d", arg)
-		case int64:
-			s = fmt.Sprintf("%d", arg)
-		case float64:
-			s = fmt.Sprintf("%f", arg)
-		case bool:
-			if arg {
-				s = "1"
-			} else {
-				s = "0"
-			}
-		case nil:
-			s = ""
-		default:
-			return fmt.Errorf("bad arguments")
+		}
+		s, err := argToString(arg)
+		if err != nil {
+			return err
 		}
 		buf.WriteString(fmt.Sprintf("%d", len(s)))
 		buf.WriteByte('\n')
@@ -709,7 +856,8 @@ func (c *Client) send(args []interface{}) error {
 		buf.WriteByte('\n')
 	}
 	buf.WriteByte('\n')
-	_, err := c.sock.Write(buf.Bytes())
+	n, err := c.sock.Write(buf.Bytes())
+	atomic.AddUint64(&c.metrics.bytesOut, uint64(n))
 	return err
 }
 
@@ -721,7 +869,15 @@ func (c *Client) recv() ([]string, error) {
 	//tmp := make([]byte, 102400)
 	var tmp [102400]byte
 	for {
-		resp := c.parse()
+		var resp []string
+		if c.protocol == ProtocolRESP {
+			var err error
+			if resp, err = c.parseRESP(); err != nil {
+				return nil, err
+			}
+		} else {
+			resp = c.parse()
+		}
 		if resp == nil || len(resp) > 0 {
 			//log.Println("SSDB Receive:",resp)
 			if len(resp) > 0 && resp[0] == "zip" {
@@ -735,6 +891,7 @@ func (c *Client) recv() ([]string, error) {
 			return resp, nil
 		}
 		n, err := c.sock.Read(tmp[0:])
+		atomic.AddUint64(&c.metrics.bytesIn, uint64(n))
 		if err != nil {
 			return nil, err
 		}
@@ -832,13 +989,20 @@ func (c *Client) UnZip(data []byte) []string {
 
 // Close The Client Connection
 func (c *Client) Close() error {
-	if !c.Closed {
-		c.mu.Lock()
-		c.Connected = false
-		c.Closed = true
-		c.mu.Unlock()
-		close(c.process)
-		c.sock.Close()
+	c.mu.Lock()
+	closed, process, sock := c.Closed, c.process, c.sock
+	c.Connected = false
+	c.Closed = true
+	c.mu.Unlock()
+	if !closed {
+		c.stateChanged(StateClosed, nil)
+		// a client that never connected has neither
+		if process != nil {
+			close(process)
+		}
+		if sock != nil {
+			sock.Close()
+		}
 		c = nil
 	}
 	return nil
@@ -0,0 +1,122 @@
+package ssdbtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// slave is a sync140 connection served by the server.
+type slave struct {
+	addr    string
+	typ     string
+	status  string
+	lastSeq uint64
+}
+
+// upstream is a master the server replicates from (slaveof).
+type upstream struct {
+	id        string
+	addr      string
+	consumer  *ssdb.BinlogConsumer
+	cancel    context.CancelFunc
+	copyCount uint64
+	syncCount uint64
+}
+
+// slaveOf serves "slaveof id host port [auth [last_seq last_key]]", s.mu is held.
+func (s *Server) slaveOf(a []string) []string {
+	if len(a) < 3 {
+		return clientError("wrong number of arguments")
+	}
+	port, err := strconv.Atoi(a[2])
+	if err != nil {
+		return clientError("invalid port")
+	}
+	var auth string
+	var from ssdb.Checkpoint
+	if len(a) > 3 {
+		auth = a[3]
+	}
+	if len(a) > 5 {
+		from.LastSeq, _ = strconv.ParseUint(a[4], 10, 64)
+		from.LastKey = a[5]
+	}
+	for _, u := range s.masters {
+		if u.id == a[0] {
+			return clientError("slave id exists")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &upstream{
+		id:       a[0],
+		addr:     net.JoinHostPort(a[1], a[2]),
+		consumer: ssdb.NewBinlogConsumer(a[1], port, auth, from),
+		cancel:   cancel,
+	}
+	s.masters = append(s.masters, u)
+	go u.consumer.Run(ctx, func(ev ssdb.Event) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ev.Copy {
+			u.copyCount++
+		} else {
+			u.syncCount++
+		}
+		if args := eventArgs(ev); args != nil {
+			s.exec(args[0], args[1:])
+		}
+		return nil
+	})
+	return ok()
+}
+
+// eventArgs returns the command applying a replicated event.
+func eventArgs(ev ssdb.Event) []string {
+	switch ev.Op {
+	case "set":
+		return []string{"set", ev.Key, ev.Value}
+	case "hset", "zset":
+		return []string{ev.Op, ev.Key, ev.Field, ev.Value}
+	case "del":
+		return []string{"del", ev.Key}
+	case "hdel", "zdel":
+		return []string{ev.Op, ev.Key, ev.Field}
+	case "qpush_back", "qset":
+		return []string{"qpush_back", ev.Key, ev.Value}
+	case "qpush_front":
+		return []string{"qpush_front", ev.Key, ev.Value}
+	case "qpop_back", "qpop_front":
+		return []string{ev.Op, ev.Key, "1"}
+	}
+	return nil
+}
+
+// replicationInfo lists the replication entries of info, s.mu is held.
+func (s *Server) replicationInfo() []string {
+	var list []string
+	var slaves []*slave
+	for _, sl := range s.slaves {
+		slaves = append(slaves, sl)
+	}
+	sort.Slice(slaves, func(i, j int) bool {
+		return slaves[i].addr < slaves[j].addr
+	})
+	for _, sl := range slaves {
+		list = append(list, "replication", fmt.Sprintf(
+			"client %s\n    type     : %s\n    status   : %s\n    last_seq : %d",
+			sl.addr, sl.typ, sl.status, sl.lastSeq))
+	}
+	for _, u := range s.masters {
+		status := strings.ToUpper(u.consumer.Phase())
+		list = append(list, "replication", fmt.Sprintf(
+			"slaveof %s\n    id         : %s\n    type       : sync\n    status     : %s\n    last_seq   : %d\n    copy_count : %d\n    sync_count : %d",
+			u.addr, u.id, status, u.consumer.Checkpoint().LastSeq, u.copyCount, u.syncCount))
+	}
+	return list
+}
@@ -0,0 +1,1136 @@
+// Package ssdbtest provides an in-process stand-in for an SSDB server,
+// speaking the native protocol (or RESP, like ssdb-server) with an in-memory
+// data set, for tests and local tools. It keeps a binlog of every write and serves it to slaves
+// (sync140), and recorded binlog frames can be replayed to them.
+package ssdbtest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+// first sequence of queue items, like QITEM_SEQ_INIT of ssdb
+const queueSeqInit = uint64(1) << 63
+
+type queue struct {
+	front uint64
+	items []string
+}
+
+// HandlerFunc serves one command, args[0] is the command name.
+type HandlerFunc func(args []string) []string
+
+// Server is an in-memory SSDB server.
+type Server struct {
+	Ip   string
+	Port int
+	// Password is asked from every connection, set it before the server is
+	// used or change it with SetPassword.
+	Password string
+	// NoopInterval is how often slaves get a noop heartbeat, default 1s.
+	NoopInterval time.Duration
+
+	listener net.Listener
+	mu       sync.Mutex
+	kv       map[string]string
+	expire   map[string]time.Time
+	hashes   map[string]map[string]string
+	zsets    map[string]map[string]int64
+	queues   map[string]*queue
+	handlers map[string]HandlerFunc
+	binlog   [][][]byte // frames: encoded binlog and optional value
+	minSeq   uint64
+	seq      uint64
+	changed  chan struct{}
+	conns    map[net.Conn]bool
+	slaves   map[net.Conn]*slave
+	masters  []*upstream
+	calls    uint64
+	closed   bool
+}
+
+// NewServer starts a server on a random port of 127.0.0.1.
+func NewServer() *Server {
+	s, err := NewServerAt("127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ssdbtest: %v", err))
+	}
+	return s
+}
+
+// NewServerAt starts a server listening on addr.
+func NewServerAt(addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		kv:       make(map[string]string),
+		expire:   make(map[string]time.Time),
+		hashes:   make(map[string]map[string]string),
+		zsets:    make(map[string]map[string]int64),
+		queues:   make(map[string]*queue),
+		handlers: make(map[string]HandlerFunc),
+		changed:  make(chan struct{}),
+		conns:    make(map[net.Conn]bool),
+		slaves:   make(map[net.Conn]*slave),
+		minSeq:   1,
+	}
+	tcp := l.Addr().(*net.TCPAddr)
+	s.Ip = tcp.IP.String()
+	s.Port = tcp.Port
+	go s.accept()
+	return s, nil
+}
+
+func (s *Server) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Ip, s.Port)
+}
+
+// Close stops listening and drops every connection.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, u := range s.masters {
+		u.cancel()
+	}
+	s.mu.Unlock()
+	s.listener.Close()
+	s.DropConnections()
+}
+
+// DropConnections closes every client connection, the server keeps listening.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.conns = make(map[net.Conn]bool)
+}
+
+// SetPassword changes the password asked from new connections and checked
+// by auth, while clients are connected.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	s.Password = password
+	s.mu.Unlock()
+}
+
+func (s *Server) password() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Password
+}
+
+// Handle overrides or adds a command.
+func (s *Server) Handle(name string, fn HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[name] = fn
+	s.mu.Unlock()
+}
+
+// Seq returns the sequence of the last binlog record.
+func (s *Server) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// Replay appends recorded binlog frames (the encoded ssdb.Binlog and the
+// optional value) to the binlog, applies them to the data set and streams
+// them to the connected slaves.
+func (s *Server) Replay(frames ...[][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range frames {
+		if len(f) == 0 {
+			continue
+		}
+		rec, err := ssdb.ParseBinlog(f[0])
+		if err != nil {
+			return err
+		}
+		var value []byte
+		if len(f) > 1 {
+			value = f[1]
+		}
+		if rec.Type == ssdb.BinlogSync || rec.Type == ssdb.BinlogMirror || rec.Type == ssdb.BinlogCopy {
+			if ev, err := ssdb.DecodeEvent(rec, value); err == nil {
+				s.apply(ev)
+			}
+		}
+		s.binlog = append(s.binlog, f)
+		if rec.Seq > s.seq {
+			s.seq = rec.Seq
+		}
+	}
+	s.notify()
+	return nil
+}
+
+// TrimBinlog drops the binlog before seq, slaves asking for older records get OUT_OF_SYNC.
+func (s *Server) TrimBinlog(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept [][][]byte
+	for _, f := range s.binlog {
+		rec, _ := ssdb.ParseBinlog(f[0])
+		if rec.Seq >= seq {
+			kept = append(kept, f)
+		}
+	}
+	s.binlog = kept
+	s.minSeq = seq
+}
+
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// record appends a sync binlog record for a write, s.mu is held.
+func (s *Server) record(cmd ssdb.BinlogCommand, key []byte, value ...string) {
+	s.seq++
+	frame := [][]byte{ssdb.Binlog{Seq: s.seq, Type: ssdb.BinlogSync, Cmd: cmd, Key: key}.Encode()}
+	for _, v := range value {
+		frame = append(frame, []byte(v))
+	}
+	s.binlog = append(s.binlog, frame)
+	s.notify()
+}
+
+// apply changes the data set for a replayed event, s.mu is held.
+func (s *Server) apply(ev ssdb.Event) {
+	switch ev.Op {
+	case "set":
+		s.kv[ev.Key] = ev.Value
+	case "del":
+		delete(s.kv, ev.Key)
+		delete(s.expire, ev.Key)
+	case "hset":
+		s.hash(ev.Key, true)[ev.Field] = ev.Value
+	case "hdel":
+		if h := s.hash(ev.Key, false); h != nil {
+			delete(h, ev.Field)
+		}
+	case "zset":
+		score, _ := strconv.ParseInt(ev.Value, 10, 64)
+		s.zset(ev.Key, true)[ev.Field] = score
+	case "zdel":
+		if z := s.zset(ev.Key, false); z != nil {
+			delete(z, ev.Field)
+		}
+	case "qset":
+		if q := s.queue(ev.Key, false); q != nil && ev.QueueSeq-q.front < uint64(len(q.items)) {
+			q.items[ev.QueueSeq-q.front] = ev.Value
+		}
+	case "qpush_back":
+		q := s.queue(ev.Key, true)
+		q.items = append(q.items, ev.Value)
+	case "qpush_front":
+		q := s.queue(ev.Key, true)
+		q.items = append([]string{ev.Value}, q.items...)
+		q.front--
+	case "qpop_front":
+		if q := s.queue(ev.Key, false); q != nil && len(q.items) > 0 {
+			q.items = q.items[1:]
+			q.front++
+		}
+	case "qpop_back":
+		if q := s.queue(ev.Key, false); q != nil && len(q.items) > 0 {
+			q.items = q.items[:len(q.items)-1]
+		}
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	password := s.password()
+	authed := password == ""
+	// like ssdb-server, a connection starting with '*' speaks RESP
+	first, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+	var redis *ssdb.RESPReader
+	if first[0] == '*' {
+		redis = ssdb.NewRESPReader(r)
+	}
+	for {
+		var args []string
+		if redis != nil {
+			v, err := redis.Read()
+			if err != nil {
+				return
+			}
+			args = v.Strings()
+		} else {
+			frame, err := ssdb.ReadFrame(r)
+			if err != nil {
+				return
+			}
+			args = make([]string, len(frame))
+			for i, v := range frame {
+				args[i] = string(v)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+		var resp []string
+		switch {
+		case args[0] == "auth":
+			if len(args) == 2 && args[1] == s.password() {
+				authed = true
+				resp = []string{"ok", "1"}
+			} else {
+				resp = []string{"error", "invalid password"}
+			}
+		case !authed:
+			resp = []string{"noauth", "authentication required"}
+		case args[0] == "sync140" && redis == nil:
+			s.sync(c, args)
+			return
+		default:
+			resp = s.Exec(args)
+		}
+		if redis != nil {
+			if err := ssdb.WriteRESP(c, respReply(resp)); err != nil {
+				return
+			}
+			continue
+		}
+		blocks := make([][]byte, len(resp))
+		for i, v := range resp {
+			blocks[i] = []byte(v)
+		}
+		if err := ssdb.WriteFrame(c, blocks...); err != nil {
+			return
+		}
+	}
+}
+
+// respReply maps a native response to a RESP reply.
+func respReply(resp []string) ssdb.RESPValue {
+	switch {
+	case len(resp) == 0:
+		return ssdb.RESPValue{Type: '-', Str: "ERR empty response"}
+	case resp[0] == "not_found":
+		return ssdb.RESPValue{Type: '$', Null: true}
+	case resp[0] != "ok":
+		msg := resp[0]
+		if len(resp) > 1 {
+			msg = resp[1]
+		}
+		return ssdb.RESPValue{Type: '-', Str: "ERR " + msg}
+	case len(resp) == 1:
+		return ssdb.RESPValue{Type: '+', Str: "OK"}
+	case len(resp) == 2:
+		return ssdb.RESPValue{Type: '$', Str: resp[1]}
+	}
+	return ssdb.RESPCommand(resp[1:])
+}
+
+// Exec runs one command against the data set and returns the response.
+func (s *Server) Exec(args []string) []string {
+	s.mu.Lock()
+	s.calls++
+	fn, found := s.handlers[args[0]]
+	s.mu.Unlock()
+	if found {
+		return fn(args)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireKeys()
+	resp, found := s.exec(args[0], args[1:])
+	if !found {
+		return []string{"client_error", "Unknown Command: " + args[0]}
+	}
+	return resp
+}
+
+func (s *Server) expireKeys() {
+	now := time.Now()
+	for k, t := range s.expire {
+		if now.After(t) {
+			delete(s.kv, k)
+			delete(s.expire, k)
+			s.record(ssdb.BinlogKDel, ssdb.EncodeKVKey(k))
+		}
+	}
+}
+
+func (s *Server) hash(name string, create bool) map[string]string {
+	h, ok := s.hashes[name]
+	if !ok && create {
+		h = make(map[string]string)
+		s.hashes[name] = h
+	}
+	return h
+}
+
+func (s *Server) zset(name string, create bool) map[string]int64 {
+	z, ok := s.zsets[name]
+	if !ok && create {
+		z = make(map[string]int64)
+		s.zsets[name] = z
+	}
+	return z
+}
+
+func (s *Server) queue(name string, create bool) *queue {
+	q, ok := s.queues[name]
+	if !ok && create {
+		q = &queue{front: queueSeqInit}
+		s.queues[name] = q
+	}
+	return q
+}
+
+func (s *Server) gc() {
+	for k, h := range s.hashes {
+		if len(h) == 0 {
+			delete(s.hashes, k)
+		}
+	}
+	for k, z := range s.zsets {
+		if len(z) == 0 {
+			delete(s.zsets, k)
+		}
+	}
+	for k, q := range s.queues {
+		if len(q.items) == 0 {
+			delete(s.queues, k)
+		}
+	}
+}
+
+func ok(v ...string) []string {
+	return append([]string{"ok"}, v...)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func boolStr(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func clientError(msg string) []string {
+	return []string{"client_error", msg}
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// scanRange returns the sorted keys in (start, end], reversed for rscan
+// style commands where the range is (end, start].
+func scanRange(keys []string, start string, end string, limit int64, reverse bool) []string {
+	sort.Strings(keys)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	var list []string
+	for _, k := range keys {
+		if int64(len(list)) >= limit {
+			break
+		}
+		if !reverse {
+			if start != "" && k <= start || end != "" && k > end {
+				continue
+			}
+		} else {
+			if start != "" && k >= start || end != "" && k < end {
+				continue
+			}
+		}
+		list = append(list, k)
+	}
+	return list
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type zitem struct {
+	key   string
+	score int64
+}
+
+func sortedZset(z map[string]int64, reverse bool) []zitem {
+	var items []zitem
+	for k, v := range z {
+		items = append(items, zitem{k, v})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if reverse {
+			a, b = b, a
+		}
+		if a.score != b.score {
+			return a.score < b.score
+		}
+		return a.key < b.key
+	})
+	return items
+}
+
+func (s *Server) exec(cmd string, a []string) ([]string, bool) {
+	need := func(n int) bool {
+		return len(a) >= n
+	}
+	wrong := clientError("wrong number of arguments")
+	switch cmd {
+	case "ping":
+		return ok(), true
+	case "info":
+		return s.info(), true
+	case "slaveof":
+		return s.slaveOf(a), true
+	case "dbsize":
+		return ok(itoa(int64(len(s.kv) + len(s.hashes) + len(s.zsets) + len(s.queues)))), true
+	case "version":
+		return ok("1.9.9"), true
+
+	// kv
+	case "set", "setx", "setnx":
+		if !need(2) {
+			return wrong, true
+		}
+		if _, exists := s.kv[a[0]]; cmd == "setnx" && exists {
+			return ok("0"), true
+		}
+		s.kv[a[0]] = a[1]
+		delete(s.expire, a[0])
+		s.record(ssdb.BinlogKSet, ssdb.EncodeKVKey(a[0]), a[1])
+		if cmd == "setx" && need(3) {
+			s.expire[a[0]] = time.Now().Add(time.Duration(atoi(a[2])) * time.Second)
+		}
+		return ok("1"), true
+	case "get":
+		if !need(1) {
+			return wrong, true
+		}
+		if v, exists := s.kv[a[0]]; exists {
+			return ok(v), true
+		}
+		return []string{"not_found"}, true
+	case "getset":
+		if !need(2) {
+			return wrong, true
+		}
+		old, exists := s.kv[a[0]]
+		s.kv[a[0]] = a[1]
+		s.record(ssdb.BinlogKSet, ssdb.EncodeKVKey(a[0]), a[1])
+		if !exists {
+			return []string{"not_found"}, true
+		}
+		return ok(old), true
+	case "del":
+		if !need(1) {
+			return wrong, true
+		}
+		if _, exists := s.kv[a[0]]; exists {
+			delete(s.kv, a[0])
+			delete(s.expire, a[0])
+			s.record(ssdb.BinlogKDel, ssdb.EncodeKVKey(a[0]))
+		}
+		return ok("1"), true
+	case "incr", "decr":
+		if !need(1) {
+			return wrong, true
+		}
+		by := int64(1)
+		if need(2) {
+			by = atoi(a[1])
+		}
+		if cmd == "decr" {
+			by = -by
+		}
+		v := atoi(s.kv[a[0]]) + by
+		s.kv[a[0]] = itoa(v)
+		s.record(ssdb.BinlogKSet, ssdb.EncodeKVKey(a[0]), s.kv[a[0]])
+		return ok(itoa(v)), true
+	case "exists":
+		if !need(1) {
+			return wrong, true
+		}
+		_, exists := s.kv[a[0]]
+		return ok(boolStr(exists)), true
+	case "strlen":
+		if !need(1) {
+			return wrong, true
+		}
+		return ok(itoa(int64(len(s.kv[a[0]])))), true
+	case "ttl":
+		if !need(1) {
+			return wrong, true
+		}
+		if t, exists := s.expire[a[0]]; exists {
+			return ok(itoa(int64(time.Until(t).Seconds() + 0.5))), true
+		}
+		return ok("-1"), true
+	case "expire":
+		if !need(2) {
+			return wrong, true
+		}
+		if _, exists := s.kv[a[0]]; !exists {
+			return ok("0"), true
+		}
+		s.expire[a[0]] = time.Now().Add(time.Duration(atoi(a[1])) * time.Second)
+		return ok("1"), true
+	case "scan", "rscan", "keys", "rkeys":
+		if !need(3) {
+			return wrong, true
+		}
+		keys := scanRange(mapKeys(s.kv), a[0], a[1], atoi(a[2]), cmd[0] == 'r')
+		resp := ok()
+		for _, k := range keys {
+			resp = append(resp, k)
+			if strings.HasSuffix(cmd, "scan") {
+				resp = append(resp, s.kv[k])
+			}
+		}
+		return resp, true
+	case "multi_get", "multi_exists":
+		resp := ok()
+		for _, k := range a {
+			v, exists := s.kv[k]
+			if cmd == "multi_exists" {
+				resp = append(resp, k, boolStr(exists))
+			} else if exists {
+				resp = append(resp, k, v)
+			}
+		}
+		return resp, true
+	case "multi_set":
+		for i := 0; i+1 < len(a); i += 2 {
+			s.kv[a[i]] = a[i+1]
+			s.record(ssdb.BinlogKSet, ssdb.EncodeKVKey(a[i]), a[i+1])
+		}
+		return ok(itoa(int64(len(a) / 2))), true
+	case "multi_del":
+		for _, k := range a {
+			if _, exists := s.kv[k]; exists {
+				delete(s.kv, k)
+				s.record(ssdb.BinlogKDel, ssdb.EncodeKVKey(k))
+			}
+		}
+		return ok(itoa(int64(len(a)))), true
+
+	// hash
+	case "hset":
+		if !need(3) {
+			return wrong, true
+		}
+		h := s.hash(a[0], true)
+		_, exists := h[a[1]]
+		h[a[1]] = a[2]
+		s.record(ssdb.BinlogHSet, ssdb.EncodeHashKey(a[0], a[1]), a[2])
+		return ok(boolStr(!exists)), true
+	case "hget":
+		if !need(2) {
+			return wrong, true
+		}
+		if v, exists := s.hash(a[0], false)[a[1]]; exists {
+			return ok(v), true
+		}
+		return []string{"not_found"}, true
+	case "hdel":
+		if !need(2) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		if _, exists := h[a[1]]; !exists {
+			return ok("0"), true
+		}
+		delete(h, a[1])
+		s.gc()
+		s.record(ssdb.BinlogHDel, ssdb.EncodeHashKey(a[0], a[1]))
+		return ok("1"), true
+	case "hincr", "hdecr":
+		if !need(2) {
+			return wrong, true
+		}
+		by := int64(1)
+		if need(3) {
+			by = atoi(a[2])
+		}
+		if cmd == "hdecr" {
+			by = -by
+		}
+		h := s.hash(a[0], true)
+		v := atoi(h[a[1]]) + by
+		h[a[1]] = itoa(v)
+		s.record(ssdb.BinlogHSet, ssdb.EncodeHashKey(a[0], a[1]), h[a[1]])
+		return ok(itoa(v)), true
+	case "hexists":
+		if !need(2) {
+			return wrong, true
+		}
+		_, exists := s.hash(a[0], false)[a[1]]
+		return ok(boolStr(exists)), true
+	case "hsize":
+		if !need(1) {
+			return wrong, true
+		}
+		return ok(itoa(int64(len(s.hash(a[0], false))))), true
+	case "hlist", "hrlist":
+		if !need(3) {
+			return wrong, true
+		}
+		return ok(scanRange(mapKeys(s.hashes), a[0], a[1], atoi(a[2]), cmd == "hrlist")...), true
+	case "hkeys", "hscan", "hrscan":
+		if !need(4) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		keys := scanRange(mapKeys(h), a[1], a[2], atoi(a[3]), cmd == "hrscan")
+		resp := ok()
+		for _, k := range keys {
+			resp = append(resp, k)
+			if cmd != "hkeys" {
+				resp = append(resp, h[k])
+			}
+		}
+		return resp, true
+	case "hgetall":
+		if !need(1) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		resp := ok()
+		for _, k := range scanRange(mapKeys(h), "", "", int64(len(h)), false) {
+			resp = append(resp, k, h[k])
+		}
+		return resp, true
+	case "hclear":
+		if !need(1) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		for k := range h {
+			s.record(ssdb.BinlogHDel, ssdb.EncodeHashKey(a[0], k))
+		}
+		delete(s.hashes, a[0])
+		return ok(itoa(int64(len(h)))), true
+	case "multi_hset":
+		if !need(1) {
+			return wrong, true
+		}
+		h := s.hash(a[0], true)
+		for i := 1; i+1 < len(a); i += 2 {
+			h[a[i]] = a[i+1]
+			s.record(ssdb.BinlogHSet, ssdb.EncodeHashKey(a[0], a[i]), a[i+1])
+		}
+		return ok(itoa(int64(len(a) / 2))), true
+	case "multi_hget":
+		if !need(1) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		resp := ok()
+		for _, k := range a[1:] {
+			if v, exists := h[k]; exists {
+				resp = append(resp, k, v)
+			}
+		}
+		return resp, true
+	case "multi_hdel":
+		if !need(1) {
+			return wrong, true
+		}
+		h := s.hash(a[0], false)
+		var n int64
+		for _, k := range a[1:] {
+			if _, exists := h[k]; exists {
+				delete(h, k)
+				n++
+				s.record(ssdb.BinlogHDel, ssdb.EncodeHashKey(a[0], k))
+			}
+		}
+		s.gc()
+		return ok(itoa(n)), true
+
+	// zset
+	case "zset":
+		if !need(3) {
+			return wrong, true
+		}
+		z := s.zset(a[0], true)
+		_, exists := z[a[1]]
+		z[a[1]] = atoi(a[2])
+		s.record(ssdb.BinlogZSet, ssdb.EncodeZsetKey(a[0], a[1]), itoa(z[a[1]]))
+		return ok(boolStr(!exists)), true
+	case "zget":
+		if !need(2) {
+			return wrong, true
+		}
+		if v, exists := s.zset(a[0], false)[a[1]]; exists {
+			return ok(itoa(v)), true
+		}
+		return []string{"not_found"}, true
+	case "zdel":
+		if !need(2) {
+			return wrong, true
+		}
+		z := s.zset(a[0], false)
+		if _, exists := z[a[1]]; !exists {
+			return ok("0"), true
+		}
+		delete(z, a[1])
+		s.gc()
+		s.record(ssdb.BinlogZDel, ssdb.EncodeZsetKey(a[0], a[1]))
+		return ok("1"), true
+	case "zincr", "zdecr":
+		if !need(2) {
+			return wrong, true
+		}
+		by := int64(1)
+		if need(3) {
+			by = atoi(a[2])
+		}
+		if cmd == "zdecr" {
+			by = -by
+		}
+		z := s.zset(a[0], true)
+		z[a[1]] += by
+		s.record(ssdb.BinlogZSet, ssdb.EncodeZsetKey(a[0], a[1]), itoa(z[a[1]]))
+		return ok(itoa(z[a[1]])), true
+	case "zexists":
+		if !need(2) {
+			return wrong, true
+		}
+		_, exists := s.zset(a[0], false)[a[1]]
+		return ok(boolStr(exists)), true
+	case "zsize":
+		if !need(1) {
+			return wrong, true
+		}
+		return ok(itoa(int64(len(s.zset(a[0], false))))), true
+	case "zlist", "zrlist":
+		if !need(3) {
+			return wrong, true
+		}
+		return ok(scanRange(mapKeys(s.zsets), a[0], a[1], atoi(a[2]), cmd == "zrlist")...), true
+	case "zkeys", "zscan", "zrscan":
+		// name key_start score_start score_end limit
+		if !need(5) {
+			return wrong, true
+		}
+		reverse := cmd == "zrscan"
+		limit := atoi(a[4])
+		resp := ok()
+		var n int64
+		for _, it := range sortedZset(s.zset(a[0], false), reverse) {
+			if n >= limit {
+				break
+			}
+			if a[2] != "" {
+				start := atoi(a[2])
+				if !reverse && it.score < start || reverse && it.score > start {
+					continue
+				}
+				if it.score == start && a[1] != "" && (!reverse && it.key <= a[1] || reverse && it.key >= a[1]) {
+					continue
+				}
+			}
+			if a[3] != "" {
+				end := atoi(a[3])
+				if !reverse && it.score > end || reverse && it.score < end {
+					break
+				}
+			}
+			n++
+			resp = append(resp, it.key)
+			if cmd != "zkeys" {
+				resp = append(resp, itoa(it.score))
+			}
+		}
+		return resp, true
+	case "zrange", "zrrange":
+		if !need(3) {
+			return wrong, true
+		}
+		items := sortedZset(s.zset(a[0], false), cmd == "zrrange")
+		offset, limit := atoi(a[1]), atoi(a[2])
+		resp := ok()
+		for i := offset; i < int64(len(items)) && i < offset+limit; i++ {
+			resp = append(resp, items[i].key, itoa(items[i].score))
+		}
+		return resp, true
+	case "zcount":
+		if !need(3) {
+			return wrong, true
+		}
+		var n int64
+		for _, score := range s.zset(a[0], false) {
+			if (a[1] == "" || score >= atoi(a[1])) && (a[2] == "" || score <= atoi(a[2])) {
+				n++
+			}
+		}
+		return ok(itoa(n)), true
+	case "zrank", "zrrank":
+		if !need(2) {
+			return wrong, true
+		}
+		for i, it := range sortedZset(s.zset(a[0], false), cmd == "zrrank") {
+			if it.key == a[1] {
+				return ok(itoa(int64(i))), true
+			}
+		}
+		return ok("-1"), true
+	case "zclear":
+		if !need(1) {
+			return wrong, true
+		}
+		z := s.zset(a[0], false)
+		for k := range z {
+			s.record(ssdb.BinlogZDel, ssdb.EncodeZsetKey(a[0], k))
+		}
+		delete(s.zsets, a[0])
+		return ok(itoa(int64(len(z)))), true
+	case "multi_zset":
+		if !need(1) {
+			return wrong, true
+		}
+		z := s.zset(a[0], true)
+		for i := 1; i+1 < len(a); i += 2 {
+			z[a[i]] = atoi(a[i+1])
+			s.record(ssdb.BinlogZSet, ssdb.EncodeZsetKey(a[0], a[i]), itoa(z[a[i]]))
+		}
+		return ok(itoa(int64(len(a) / 2))), true
+	case "multi_zget":
+		if !need(1) {
+			return wrong, true
+		}
+		z := s.zset(a[0], false)
+		resp := ok()
+		for _, k := range a[1:] {
+			if v, exists := z[k]; exists {
+				resp = append(resp, k, itoa(v))
+			}
+		}
+		return resp, true
+	case "multi_zdel":
+		if !need(1) {
+			return wrong, true
+		}
+		z := s.zset(a[0], false)
+		var n int64
+		for _, k := range a[1:] {
+			if _, exists := z[k]; exists {
+				delete(z, k)
+				n++
+				s.record(ssdb.BinlogZDel, ssdb.EncodeZsetKey(a[0], k))
+			}
+		}
+		s.gc()
+		return ok(itoa(n)), true
+
+	// queue
+	case "qpush", "qpush_back", "qpush_front":
+		if !need(2) {
+			return wrong, true
+		}
+		q := s.queue(a[0], true)
+		for _, v := range a[1:] {
+			if cmd == "qpush_front" {
+				q.front--
+				q.items = append([]string{v}, q.items...)
+				s.record(ssdb.BinlogQPushFront, ssdb.EncodeQueueItemKey(a[0], q.front), v)
+			} else {
+				q.items = append(q.items, v)
+				s.record(ssdb.BinlogQPushBack, ssdb.EncodeQueueItemKey(a[0], q.front+uint64(len(q.items))-1), v)
+			}
+		}
+		return ok(itoa(int64(len(q.items)))), true
+	case "qpop", "qpop_front", "qpop_back":
+		if !need(1) {
+			return wrong, true
+		}
+		n := int64(1)
+		if need(2) {
+			n = atoi(a[1])
+		}
+		q := s.queue(a[0], false)
+		resp := ok()
+		for ; q != nil && n > 0 && len(q.items) > 0; n-- {
+			if cmd == "qpop_back" {
+				resp = append(resp, q.items[len(q.items)-1])
+				q.items = q.items[:len(q.items)-1]
+				s.record(ssdb.BinlogQPopBack, []byte(a[0]))
+			} else {
+				resp = append(resp, q.items[0])
+				q.items = q.items[1:]
+				q.front++
+				s.record(ssdb.BinlogQPopFront, []byte(a[0]))
+			}
+		}
+		s.gc()
+		return resp, true
+	case "qsize":
+		if !need(1) {
+			return wrong, true
+		}
+		if q := s.queue(a[0], false); q != nil {
+			return ok(itoa(int64(len(q.items)))), true
+		}
+		return ok("0"), true
+	case "qfront", "qback", "qget":
+		if !need(1) {
+			return wrong, true
+		}
+		q := s.queue(a[0], false)
+		if q == nil || len(q.items) == 0 {
+			return []string{"not_found"}, true
+		}
+		i := int64(0)
+		switch cmd {
+		case "qback":
+			i = int64(len(q.items) - 1)
+		case "qget":
+			if !need(2) {
+				return wrong, true
+			}
+			i = atoi(a[1])
+			if i < 0 {
+				i += int64(len(q.items))
+			}
+		}
+		if i < 0 || i >= int64(len(q.items)) {
+			return []string{"not_found"}, true
+		}
+		return ok(q.items[i]), true
+	case "qset":
+		if !need(3) {
+			return wrong, true
+		}
+		q := s.queue(a[0], false)
+		i := atoi(a[1])
+		if q != nil && i < 0 {
+			i += int64(len(q.items))
+		}
+		if q == nil || i < 0 || i >= int64(len(q.items)) {
+			return clientError("index out of range"), true
+		}
+		q.items[i] = a[2]
+		s.record(ssdb.BinlogQSet, ssdb.EncodeQueueItemKey(a[0], q.front+uint64(i)), a[2])
+		return ok(), true
+	case "qrange", "qslice":
+		if !need(3) {
+			return wrong, true
+		}
+		q := s.queue(a[0], false)
+		if q == nil {
+			return ok(), true
+		}
+		size := int64(len(q.items))
+		begin, end := atoi(a[1]), atoi(a[2])
+		if cmd == "qrange" {
+			if begin < 0 {
+				begin += size
+			}
+			if end < 0 {
+				end = size
+			} else {
+				end = begin + end
+			}
+		} else {
+			if begin < 0 {
+				begin += size
+			}
+			if end < 0 {
+				end += size
+			}
+			end++
+		}
+		begin = max(begin, 0)
+		end = min(end, size)
+		if begin >= end {
+			return ok(), true
+		}
+		return ok(q.items[begin:end]...), true
+	case "qlist", "qrlist":
+		if !need(3) {
+			return wrong, true
+		}
+		return ok(scanRange(mapKeys(s.queues), a[0], a[1], atoi(a[2]), cmd == "qrlist")...), true
+	case "qclear":
+		if !need(1) {
+			return wrong, true
+		}
+		q := s.queue(a[0], false)
+		if q == nil {
+			return ok("0"), true
+		}
+		for range q.items {
+			s.record(ssdb.BinlogQPopFront, []byte(a[0]))
+		}
+		delete(s.queues, a[0])
+		return ok(itoa(int64(len(q.items)))), true
+	}
+	return nil, false
+}
+
+func (s *Server) info() []string {
+	minSeq := s.minSeq
+	if len(s.binlog) == 0 {
+		minSeq = s.seq
+	}
+	resp := ok(
+		"ssdb-server",
+		"version", "1.9.9",
+		"links", itoa(int64(len(s.conns))),
+		"total_calls", strconv.FormatUint(s.calls, 10),
+		"dbsize", itoa(int64(len(s.kv)+len(s.hashes)+len(s.zsets)+len(s.queues))),
+		"binlogs", fmt.Sprintf("    capacity : 20000000\n    min_seq  : %d\n    max_seq  : %d", minSeq, s.seq),
+	)
+	return append(resp, s.replicationInfo()...)
+}
@@ -0,0 +1,154 @@
+package ssdbtest
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/matishsiao/gossdb/ssdb"
+)
+
+type copyRecord struct {
+	cmd   ssdb.BinlogCommand
+	key   []byte
+	value string
+}
+
+// snapshot lists the whole data set in storage key order, s.mu is held.
+func (s *Server) snapshot() []copyRecord {
+	var list []copyRecord
+	for k, v := range s.kv {
+		list = append(list, copyRecord{ssdb.BinlogKSet, ssdb.EncodeKVKey(k), v})
+	}
+	for name, h := range s.hashes {
+		for k, v := range h {
+			list = append(list, copyRecord{ssdb.BinlogHSet, ssdb.EncodeHashKey(name, k), v})
+		}
+	}
+	for name, z := range s.zsets {
+		for k, v := range z {
+			list = append(list, copyRecord{ssdb.BinlogZSet, ssdb.EncodeZsetKey(name, k), itoa(v)})
+		}
+	}
+	for name, q := range s.queues {
+		for i, v := range q.items {
+			list = append(list, copyRecord{ssdb.BinlogQPushBack, ssdb.EncodeQueueItemKey(name, q.front+uint64(i)), v})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].key, list[j].key) < 0
+	})
+	return list
+}
+
+// sync serves a slave: "sync140 last_seq last_key sync|mirror".
+// A fresh slave (last_seq 0) or one resuming a copy (last_key set) gets a
+// copy of the data set first, then the binlog is streamed from last_seq.
+func (s *Server) sync(c net.Conn, args []string) {
+	var lastSeq uint64
+	var lastKey string
+	if len(args) > 1 {
+		lastSeq, _ = strconv.ParseUint(args[1], 10, 64)
+	}
+	if len(args) > 2 {
+		lastKey = args[2]
+	}
+	noop := s.NoopInterval
+	if noop <= 0 {
+		noop = time.Second
+	}
+
+	typ := "sync"
+	if len(args) > 3 {
+		typ = args[3]
+	}
+	st := &slave{addr: c.RemoteAddr().String(), typ: typ, status: "INIT", lastSeq: lastSeq}
+	defer func() {
+		s.mu.Lock()
+		delete(s.slaves, c)
+		s.mu.Unlock()
+	}()
+
+	s.mu.Lock()
+	s.slaves[c] = st
+	if lastSeq != 0 && lastKey == "" && lastSeq+1 < s.minSeq {
+		st.status = "OUT_OF_SYNC"
+		s.mu.Unlock()
+		rec := ssdb.Binlog{Seq: lastSeq, Type: ssdb.BinlogCtrl, Key: []byte("OUT_OF_SYNC")}
+		ssdb.WriteFrame(c, rec.Encode())
+		return
+	}
+	if lastSeq == 0 || lastKey != "" {
+		copySeq := s.seq
+		if lastKey != "" {
+			copySeq = lastSeq
+		}
+		records := s.snapshot()
+		st.status = "COPY"
+		s.mu.Unlock()
+		begin := ssdb.Binlog{Seq: copySeq, Type: ssdb.BinlogCopy, Cmd: ssdb.BinlogBegin}
+		if err := ssdb.WriteFrame(c, begin.Encode(), []byte("copy_begin")); err != nil {
+			return
+		}
+		for _, r := range records {
+			if lastKey != "" && string(r.key) <= lastKey {
+				continue
+			}
+			rec := ssdb.Binlog{Seq: copySeq, Type: ssdb.BinlogCopy, Cmd: r.cmd, Key: r.key}
+			if err := ssdb.WriteFrame(c, rec.Encode(), []byte(r.value)); err != nil {
+				return
+			}
+		}
+		end := ssdb.Binlog{Seq: copySeq, Type: ssdb.BinlogCopy, Cmd: ssdb.BinlogEnd}
+		if err := ssdb.WriteFrame(c, end.Encode(), []byte("copy_end")); err != nil {
+			return
+		}
+		lastSeq = copySeq
+		s.mu.Lock()
+	}
+	st.status = "SYNC"
+
+	// stream the binlog after lastSeq
+	next := 0
+	for {
+		var frames [][][]byte
+		for ; next < len(s.binlog); next++ {
+			rec, _ := ssdb.ParseBinlog(s.binlog[next][0])
+			if rec.Seq > lastSeq {
+				frames = append(frames, s.binlog[next])
+			}
+		}
+		changed := s.changed
+		seq := s.seq
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+		for _, f := range frames {
+			if err := ssdb.WriteFrame(c, f...); err != nil {
+				return
+			}
+			rec, _ := ssdb.ParseBinlog(f[0])
+			lastSeq = rec.Seq
+		}
+		if len(frames) == 0 {
+			select {
+			case <-changed:
+			case <-time.After(noop):
+				rec := ssdb.Binlog{Seq: seq, Type: ssdb.BinlogNoop}
+				if err := ssdb.WriteFrame(c, rec.Encode()); err != nil {
+					return
+				}
+			}
+		}
+		s.mu.Lock()
+		st.lastSeq = lastSeq
+		if next > len(s.binlog) {
+			// binlog was trimmed
+			next = 0
+		}
+	}
+}